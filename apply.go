@@ -1,9 +1,39 @@
 package dragon
 
+// What MakeMove changes that UnmakeMove can't recover from the board and the
+// move. It has no pointers, so it may be kept in a search stack, or copied
+// and serialized.
+type Undo struct {
+	Captured      Piece // the piece captured, Pawn for en passant, or Nothing
+	Castled       bool  // whether the move castled
+	Castlerights  uint8 // the castling rights before the move
+	Enpassant     uint8 // the en passant square before the move, or 0
+	Halfmoveclock uint8
+	Hash          uint64
+}
+
 // Applies a move to the board, and returns a function that can be used to unapply it.
 // This function assumes that the given move is valid (i.e., is in the set of moves found by GenerateLegalMoves()).
 // If the move is not valid, this function has undefined behavior.
+// It allocates the returned closure; MakeMove and UnmakeMove don't.
 func (b *Board) Apply(m Move) func() {
+	var u Undo
+	b.MakeMove(m, &u)
+	return func() {
+		b.UnmakeMove(m, &u)
+	}
+}
+
+// Applies a move to the board, filling in u so that UnmakeMove can take it
+// back. Like Apply, it assumes that the move is legal.
+func (b *Board) MakeMove(m Move, u *Undo) {
+	*u = Undo{
+		Castlerights:  b.castlerights,
+		Enpassant:     b.enpassant,
+		Halfmoveclock: b.Halfmoveclock,
+		Hash:          b.hash,
+	}
+
 	// Configure data about which pieces move
 	var ourBitboardPtr, oppBitboardPtr *Bitboards
 	var epDelta int8                                // add this to the e.p. square to find the captured pawn
@@ -11,6 +41,8 @@ func (b *Board) Apply(m Move) func() {
 	// the constant that represents the index into pieceSquareZobristC for the pawn of our color
 	var ourPiecesPawnZobristIndex int
 	var oppPiecesPawnZobristIndex int
+	// the castlerights indices of our and our opponent's queenside rights; kingside is one more
+	var ourQueenside, oppQueenside int
 	if b.Wtomove {
 		ourBitboardPtr = &(b.White)
 		oppBitboardPtr = &(b.Black)
@@ -19,6 +51,7 @@ func (b *Board) Apply(m Move) func() {
 		ourStartingRankBb = RankMasks[0]
 		ourPiecesPawnZobristIndex = 0
 		oppPiecesPawnZobristIndex = 6
+		ourQueenside, oppQueenside = whiteQueenside, blackQueenside
 	} else {
 		ourBitboardPtr = &(b.Black)
 		oppBitboardPtr = &(b.White)
@@ -28,18 +61,23 @@ func (b *Board) Apply(m Move) func() {
 		b.Fullmoveno++ // increment after black's move
 		ourPiecesPawnZobristIndex = 6
 		oppPiecesPawnZobristIndex = 0
+		ourQueenside, oppQueenside = blackQueenside, whiteQueenside
+	}
+	info := b.MoveInfo(m)
+	var ourColor uint8 // for squares
+	if !b.Wtomove {
+		ourColor = blackPiece
 	}
 	fromBitboard := (uint64(1) << m.From())
-	toBitboard := (uint64(1) << m.To())
-	pieceType, pieceTypeBitboard := determinePieceType(ourBitboardPtr, fromBitboard)
-	castleStatus := 0
+	pieceType := info.Piece()
+	pieceTypeBitboard := pieceBitboard(ourBitboardPtr, pieceType)
+	// Remove the en passant key while the pawns are where it was computed for
+	b.hash ^= b.enpassantZobrist()
 	var oldRookLoc, newRookLoc uint8
-	var flippedKsCastle, flippedQsCastle, flippedOppKsCastle, flippedOppQsCastle bool
+	to := m.To() // where the moving piece lands; for castling, not always m.To()
 
 	// If it is any kind of capture or pawn move, reset halfmove clock.
-	resetHalfmoveClockFrom := -1
-	if IsCapture(m, b) || pieceType == Pawn {
-		resetHalfmoveClockFrom = int(b.Halfmoveclock)
+	if info.IsCapture() || pieceType == Pawn {
 		b.Halfmoveclock = 0 // reset halfmove clock
 	} else {
 		b.Halfmoveclock++
@@ -47,46 +85,41 @@ func (b *Board) Apply(m Move) func() {
 
 	// King moves strip castling rights
 	if pieceType == King {
-		// TODO(noahklein): do this without a branch
-		if m.To()-m.From() == 2 { // castle short
-			castleStatus = 1
-			oldRookLoc = m.To() + 1
-			newRookLoc = m.To() - 1
-		} else if int(m.To())-int(m.From()) == -2 { // castle long
-			castleStatus = -1
-			oldRookLoc = m.To() - 2
-			newRookLoc = m.To() + 1
+		if info.IsCastle() {
+			u.Castled = true
+			right, _ := b.castlingRight(m)
+			rank := m.From() &^ 7
+			kingFile, rookFile := castlingTargets(right)
+			oldRookLoc = rank + b.rookFiles[right]
+			newRookLoc = rank + rookFile
+			to = rank + kingFile
 		}
 		// King moves always strip castling rights
 		if b.canCastleKingside() {
 			b.flipKingsideCastle()
-			flippedKsCastle = true
 		}
 		if b.canCastleQueenside() {
 			b.flipQueensideCastle()
-			flippedQsCastle = true
 		}
 	}
 
+	toBitboard := (uint64(1) << to)
+
 	// Rook moves strip castling rights
-	if pieceType == Rook {
-		if b.canCastleKingside() && (fromBitboard&FileMasks[7] != 0) &&
-			fromBitboard&ourStartingRankBb != 0 { // king's rook
-			flippedKsCastle = true
+	if pieceType == Rook && fromBitboard&ourStartingRankBb != 0 {
+		if b.canCastleKingside() && m.From()%8 == b.rookFiles[ourQueenside+1] { // king's rook
 			b.flipKingsideCastle()
-		} else if b.canCastleQueenside() && (fromBitboard&FileMasks[0] != 0) &&
-			fromBitboard&ourStartingRankBb != 0 { // queen's rook
-			flippedQsCastle = true
+		} else if b.canCastleQueenside() && m.From()%8 == b.rookFiles[ourQueenside] { // queen's rook
 			b.flipQueensideCastle()
 		}
 	}
 
-	// Apply the castling rook movement
-	if castleStatus != 0 {
-		ourBitboardPtr.Rooks |= (uint64(1) << newRookLoc)
-		ourBitboardPtr.All |= (uint64(1) << newRookLoc)
+	// Lift the castling rook. It is put down after the king has moved, since in
+	// Chess960 the king may land where the rook was, or the rook where the king was.
+	if u.Castled {
 		ourBitboardPtr.Rooks &= ^(uint64(1) << oldRookLoc)
 		ourBitboardPtr.All &= ^(uint64(1) << oldRookLoc)
+		b.squares[oldRookLoc] = 0
 		// Update rook location in hash
 		// (Rook - 1) assumes that "Nothing" precedes "Rook" in the Piece constants list
 		b.hash ^= pieceSquareZobristC[ourPiecesPawnZobristIndex+(Rook-1)][oldRookLoc]
@@ -94,149 +127,145 @@ func (b *Board) Apply(m Move) func() {
 	}
 
 	// Is this an e.p. capture? Strip the opponent pawn and reset the e.p. square
-	oldEpCaptureSquare := b.enpassant
-	var actuallyPerformedEpCapture bool = false
-	if pieceType == Pawn && m.To() == oldEpCaptureSquare && oldEpCaptureSquare != 0 {
-		actuallyPerformedEpCapture = true
-		epOpponentPawnLocation := uint8(int8(oldEpCaptureSquare) + epDelta)
+	if info.IsEnPassant() {
+		epOpponentPawnLocation := uint8(int8(b.enpassant) + epDelta)
 		oppBitboardPtr.Pawns &= ^(uint64(1) << epOpponentPawnLocation)
 		oppBitboardPtr.All &= ^(uint64(1) << epOpponentPawnLocation)
+		b.squares[epOpponentPawnLocation] = 0
 		// Remove the opponent pawn from the board hash.
 		b.hash ^= pieceSquareZobristC[oppPiecesPawnZobristIndex][epOpponentPawnLocation]
 	}
 	// Update the en passant square
-	if pieceType == Pawn && (int8(m.To())+2*epDelta == int8(m.From())) { // pawn double push
-		b.enpassant = uint8(int8(m.To()) + epDelta)
+	if info.IsDoublePush() {
+		b.enpassant = uint8(int8(to) + epDelta)
 	} else {
 		b.enpassant = 0
 	}
 
 	// Is this a promotion?
-	var destTypeBitboard *uint64
-	var promotedToPieceType Piece // if not promoted, same as pieceType
-	switch m.Promote() {
-	case Queen:
-		destTypeBitboard = &(ourBitboardPtr.Queens)
-		promotedToPieceType = Queen
-	case Knight:
-		destTypeBitboard = &(ourBitboardPtr.Knights)
-		promotedToPieceType = Knight
-	case Rook:
-		destTypeBitboard = &(ourBitboardPtr.Rooks)
-		promotedToPieceType = Rook
-	case Bishop:
-		destTypeBitboard = &(ourBitboardPtr.Bishops)
-		promotedToPieceType = Bishop
-	default:
-		destTypeBitboard = pieceTypeBitboard
-		promotedToPieceType = pieceType
+	destTypeBitboard, promotedToPieceType := pieceTypeBitboard, pieceType // if not promoted, same as pieceType
+	if m.Promote() != Nothing {
+		destTypeBitboard, promotedToPieceType = pieceBitboard(ourBitboardPtr, m.Promote()), m.Promote()
 	}
 
 	// Apply the move
-	capturedPieceType, capturedBitboard := determinePieceType(oppBitboardPtr, toBitboard)
+	u.Captured = info.Captured()
 	ourBitboardPtr.All &= ^fromBitboard // remove at "from"
 	ourBitboardPtr.All |= toBitboard    // add at "to"
 	*pieceTypeBitboard &= ^fromBitboard // remove at "from"
 	*destTypeBitboard |= toBitboard     // add at "to"
-	if capturedPieceType != Nothing {   // This does not account for e.p. captures
-		*capturedBitboard &= ^toBitboard
+	b.squares[m.From()] = 0
+	b.squares[to] = uint8(promotedToPieceType) | ourColor
+	if u.Captured != Nothing && !info.IsEnPassant() {
+		*pieceBitboard(oppBitboardPtr, u.Captured) &= ^toBitboard
 		oppBitboardPtr.All &= ^toBitboard
-		b.hash ^= pieceSquareZobristC[oppPiecesPawnZobristIndex+(int(capturedPieceType)-1)][m.To()] // remove the captured piece from the hash
+		b.hash ^= pieceSquareZobristC[oppPiecesPawnZobristIndex+(int(u.Captured)-1)][to] // remove the captured piece from the hash
+	}
+	b.hash ^= pieceSquareZobristC[(int(pieceType)-1)+ourPiecesPawnZobristIndex][m.From()]     // remove piece at "from"
+	b.hash ^= pieceSquareZobristC[(int(promotedToPieceType)-1)+ourPiecesPawnZobristIndex][to] // add piece at "to"
+
+	// Put down the castling rook
+	if u.Castled {
+		ourBitboardPtr.Rooks |= (uint64(1) << newRookLoc)
+		ourBitboardPtr.All |= (uint64(1) << newRookLoc)
+		b.squares[newRookLoc] = Rook | ourColor
 	}
-	b.hash ^= pieceSquareZobristC[(int(pieceType)-1)+ourPiecesPawnZobristIndex][m.From()]         // remove piece at "from"
-	b.hash ^= pieceSquareZobristC[(int(promotedToPieceType)-1)+ourPiecesPawnZobristIndex][m.To()] // add piece at "to"
 
 	// If a rook was captured, it strips castling rights
-	if capturedPieceType == Rook {
-		if m.To()%8 == 7 && toBitboard&oppStartingRankBb != 0 && b.oppCanCastleKingside() { // captured king rook
+	if u.Captured == Rook && toBitboard&oppStartingRankBb != 0 {
+		if b.oppCanCastleKingside() && to%8 == b.rookFiles[oppQueenside+1] { // captured king rook
 			b.flipOppKingsideCastle()
-			flippedOppKsCastle = true
-		} else if m.To()%8 == 0 && toBitboard&oppStartingRankBb != 0 && b.oppCanCastleQueenside() { // queen rooks
+		} else if b.oppCanCastleQueenside() && to%8 == b.rookFiles[oppQueenside] { // queen rooks
 			b.flipOppQueensideCastle()
-			flippedOppQsCastle = true
 		}
 	}
 	// flip the side to move in the hash
 	b.hash ^= whiteToMoveZobristC
 	b.Wtomove = !b.Wtomove
 
-	// remove the old en passant square from the hash, and add the new one
-	b.hash ^= uint64(oldEpCaptureSquare)
-	b.hash ^= uint64(b.enpassant)
-
-	// Return the unapply function (closure)
-	unapply := func() {
-		// Flip the player to move
-		b.hash ^= whiteToMoveZobristC
-		b.Wtomove = !b.Wtomove
-
-		// Restore the halfmove clock
-		if resetHalfmoveClockFrom == -1 {
-			b.Halfmoveclock--
-		} else {
-			b.Halfmoveclock = uint8(resetHalfmoveClockFrom)
-		}
+	// add the new en passant square to the hash
+	b.hash ^= b.enpassantZobrist()
+}
 
-		// Unapply move
-		ourBitboardPtr.All &= ^toBitboard                                                             // remove at "to"
-		ourBitboardPtr.All |= fromBitboard                                                            // add at "from"
-		*destTypeBitboard &= ^toBitboard                                                              // remove at "to"
-		*pieceTypeBitboard |= fromBitboard                                                            // add at "from"
-		b.hash ^= pieceSquareZobristC[(int(promotedToPieceType)-1)+ourPiecesPawnZobristIndex][m.To()] // remove the piece at "to"
-		b.hash ^= pieceSquareZobristC[(int(pieceType)-1)+ourPiecesPawnZobristIndex][m.From()]         // add the piece at "from"
+// Takes back a move made by MakeMove, given the same move and the Undo it
+// filled in. Moves must be unmade in the reverse of the order they were made.
+func (b *Board) UnmakeMove(m Move, u *Undo) {
+	b.Wtomove = !b.Wtomove
+	if !b.Wtomove {
+		b.Fullmoveno-- // decrement after undoing black's move
+	}
+	b.castlerights = u.Castlerights
+	b.enpassant = u.Enpassant
+	b.Halfmoveclock = u.Halfmoveclock
+	b.hash = u.Hash
 
-		// Restore captured piece (excluding e.p.)
-		if capturedPieceType != Nothing { // doesn't consider e.p. captures
-			*capturedBitboard |= toBitboard
-			oppBitboardPtr.All |= toBitboard
-			// restore the captured piece to the hash (excluding e.p.)
-			b.hash ^= pieceSquareZobristC[oppPiecesPawnZobristIndex+(int(capturedPieceType)-1)][m.To()]
-		}
+	ourBitboardPtr, oppBitboardPtr, epDelta := &(b.White), &(b.Black), int8(-8)
+	ourColor, oppColor := uint8(0), uint8(blackPiece) // for squares
+	if !b.Wtomove {
+		ourBitboardPtr, oppBitboardPtr, epDelta = &(b.Black), &(b.White), 8
+		ourColor, oppColor = oppColor, ourColor
+	}
+	fromBitboard := uint64(1) << m.From()
 
-		// Restore rooks from castling move
-		if castleStatus != 0 {
-			ourBitboardPtr.Rooks &= ^(uint64(1) << newRookLoc)
-			ourBitboardPtr.All &= ^(uint64(1) << newRookLoc)
-			ourBitboardPtr.Rooks |= (uint64(1) << oldRookLoc)
-			ourBitboardPtr.All |= (uint64(1) << oldRookLoc)
-			// Revert castling rook move
-			b.hash ^= pieceSquareZobristC[ourPiecesPawnZobristIndex+(Rook-1)][oldRookLoc]
-			b.hash ^= pieceSquareZobristC[ourPiecesPawnZobristIndex+(Rook-1)][newRookLoc]
-		}
+	if u.Castled {
+		// Lift both pieces before putting either down, as in MakeMove.
+		right, _ := b.castlingRightOf(m)
+		rank := m.From() &^ 7
+		kingFile, rookFile := castlingTargets(right)
+		kingBitboard := uint64(1) << (rank + kingFile)
+		rookBitboard := uint64(1) << (rank + rookFile)
+		ourBitboardPtr.Kings &^= kingBitboard
+		ourBitboardPtr.Rooks &^= rookBitboard
+		ourBitboardPtr.All &^= kingBitboard | rookBitboard
+		oldRookBitboard := uint64(1) << (rank + b.rookFiles[right])
+		ourBitboardPtr.Kings |= fromBitboard
+		ourBitboardPtr.Rooks |= oldRookBitboard
+		ourBitboardPtr.All |= fromBitboard | oldRookBitboard
+		b.squares[rank+kingFile], b.squares[rank+rookFile] = 0, 0
+		b.squares[m.From()], b.squares[rank+b.rookFiles[right]] = King|ourColor, Rook|ourColor
+		return
+	}
 
-		// Unapply en-passant square change, and capture if necessary
-		b.hash ^= uint64(b.enpassant)        // undo the new en passant square from the hash
-		b.hash ^= uint64(oldEpCaptureSquare) // restore the old one to the hash
-		b.enpassant = oldEpCaptureSquare
-		if actuallyPerformedEpCapture {
-			epOpponentPawnLocation := uint8(int8(oldEpCaptureSquare) + epDelta)
-			oppBitboardPtr.Pawns |= (uint64(1) << epOpponentPawnLocation)
-			oppBitboardPtr.All |= (uint64(1) << epOpponentPawnLocation)
-			// Add the opponent pawn to the board hash.
-			b.hash ^= pieceSquareZobristC[oppPiecesPawnZobristIndex][epOpponentPawnLocation]
-		}
+	// Move the piece back, as a pawn if it promoted
+	toBitboard := uint64(1) << m.To()
+	pieceType := Piece(b.squares[m.To()] & 7)
+	destTypeBitboard := pieceBitboard(ourBitboardPtr, pieceType)
+	if m.Promote() != Nothing {
+		pieceType = Pawn
+	}
+	*destTypeBitboard &^= toBitboard
+	*pieceBitboard(ourBitboardPtr, pieceType) |= fromBitboard
+	ourBitboardPtr.All = ourBitboardPtr.All&^toBitboard | fromBitboard
+	b.squares[m.To()] = 0
+	b.squares[m.From()] = uint8(pieceType) | ourColor
 
-		// Decrement move clock
-		if !b.Wtomove {
-			b.Fullmoveno-- // decrement after undoing black's move
+	// Restore the captured piece
+	if u.Captured != Nothing {
+		capturedSquare := m.To()
+		if u.Captured == Pawn && m.To() == b.enpassant && b.enpassant != 0 { // the e.p. square is always empty
+			capturedSquare = uint8(int8(b.enpassant) + epDelta)
 		}
+		*pieceBitboard(oppBitboardPtr, u.Captured) |= uint64(1) << capturedSquare
+		oppBitboardPtr.All |= uint64(1) << capturedSquare
+		b.squares[capturedSquare] = uint8(u.Captured) | oppColor
+	}
+}
 
-		// Restore castling flags
-		// Must update castling flags AFTER turn swap
-		if flippedKsCastle {
-			b.flipKingsideCastle()
-		}
-		if flippedQsCastle {
-			b.flipQueensideCastle()
-		}
-		if flippedOppKsCastle {
-			b.flipOppKingsideCastle()
-		}
-		if flippedOppQsCastle {
-			b.flipOppQueensideCastle()
-		}
+// The bitboard of a piece type.
+func pieceBitboard(bitboards *Bitboards, piece Piece) *uint64 {
+	switch piece {
+	case Pawn:
+		return &(bitboards.Pawns)
+	case Knight:
+		return &(bitboards.Knights)
+	case Bishop:
+		return &(bitboards.Bishops)
+	case Rook:
+		return &(bitboards.Rooks)
+	case Queen:
+		return &(bitboards.Queens)
 	}
-	return unapply
+	return &(bitboards.Kings)
 }
 
 func determinePieceType(ourBitboardPtr *Bitboards, squareMask uint64) (Piece, *uint64) {
@@ -264,22 +293,31 @@ func determinePieceType(ourBitboardPtr *Bitboards, squareMask uint64) (Piece, *u
 	return pieceType, pieceTypeBitboard
 }
 
-// TODO: still missing something, seems to cause problems.
+// Passes the turn to the opponent without moving a piece, and returns a
+// function that can be used to undo it. Used for null-move pruning in search.
+// The en passant square is cleared, the halfmove clock advances, and the
+// fullmove number increments after black's null move, just as for a real move.
+// The side to move must not be in check.
 func (b *Board) NullMove() func() {
-	b.Wtomove = !b.Wtomove
 	oldEpCaptureSquare := b.enpassant
-	b.enpassant = 0
-
+	oldHalfmoveclock := b.Halfmoveclock
+	b.hash ^= b.enpassantZobrist()
 	b.hash ^= whiteToMoveZobristC
-	b.hash ^= uint64(oldEpCaptureSquare)
-	b.hash ^= uint64(b.enpassant)
+	if !b.Wtomove {
+		b.Fullmoveno++
+	}
+	b.Wtomove = !b.Wtomove
+	b.enpassant = 0
+	b.Halfmoveclock++
 
 	return func() {
-		b.hash ^= uint64(b.enpassant)
-		b.hash ^= uint64(oldEpCaptureSquare)
 		b.hash ^= whiteToMoveZobristC
-
 		b.enpassant = oldEpCaptureSquare
+		b.Halfmoveclock = oldHalfmoveclock
 		b.Wtomove = !b.Wtomove
+		if !b.Wtomove {
+			b.Fullmoveno--
+		}
+		b.hash ^= b.enpassantZobrist()
 	}
 }
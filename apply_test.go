@@ -57,6 +57,17 @@ func TestApplyUnapply(t *testing.T) {
 		"r3k2r/Pppp1ppp/1b3nbN/nPB5/2P1P3/qB3N2/P2P2PP/r2Q1RK1 b kq - 0 0": parseMove("a1a2"),
 		// Moving toward a forced mate
 		"5k2/5p2/5P2/8/8/2r5/2rR2K1/4B2R w - - 0 1": parseMove("h1h8"),
+		// Chess960: king and rook swap squares
+		"4k3/8/8/8/8/8/8/5KR1 w K - 0 0": parseMove("f1g1"),
+		// Chess960: black long, the rook passing the king's square
+		"1r2k3/8/8/8/8/8/8/1R2K3 b q - 0 0": parseMove("e8b8"),
+		// Chess960: capturing the castling rook strips its right
+		"1r2k3/8/8/8/8/8/8/1R2K3 w q - 0 0": parseMove("b1b8"),
+		// Chess960: castling with the inner rook
+		"4k3/8/8/8/8/8/8/RR2K3 w B - 0 0": parseMove("e1b1"),
+		// Chess960: moving the other rook keeps the right
+		"4k3/8/8/8/8/8/8/RR2K3 b B - 0 0":    parseMove("e8d8"),
+		"1r2k3/8/8/8/8/8/8/RR2K3 w Bq - 0 0": parseMove("a1a2"),
 	}
 	results := map[string]string{
 		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 0":                "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 0",
@@ -79,6 +90,12 @@ func TestApplyUnapply(t *testing.T) {
 		"r3k2r/Pppp1ppp/1b3nbN/nPB5/B1P1P3/q4N2/P2P2PP/r2Q1RK1 w kq - 0 0":        "r3k2r/Pppp1ppp/1b3nbN/nPB5/B1P1P3/q4N2/P2P2PP/Q4RK1 b kq - 0 0",
 		"r3k2r/Pppp1ppp/1b3nbN/nPB5/2P1P3/qB3N2/P2P2PP/r2Q1RK1 b kq - 0 0":        "r3k2r/Pppp1ppp/1b3nbN/nPB5/2P1P3/qB3N2/r2P2PP/3Q1RK1 w kq - 0 1",
 		"5k2/5p2/5P2/8/8/2r5/2rR2K1/4B2R w - - 0 1":                               "5k1R/5p2/5P2/8/8/2r5/2rR2K1/4B3 b - - 1 1",
+		"4k3/8/8/8/8/8/8/5KR1 w K - 0 0":                                          "4k3/8/8/8/8/8/8/5RK1 b - - 1 0",
+		"1r2k3/8/8/8/8/8/8/1R2K3 b q - 0 0":                                       "2kr4/8/8/8/8/8/8/1R2K3 w - - 1 1",
+		"1r2k3/8/8/8/8/8/8/1R2K3 w q - 0 0":                                       "1R2k3/8/8/8/8/8/8/4K3 b - - 0 0",
+		"4k3/8/8/8/8/8/8/RR2K3 w B - 0 0":                                         "4k3/8/8/8/8/8/8/R1KR4 b - - 1 0",
+		"4k3/8/8/8/8/8/8/RR2K3 b B - 0 0":                                         "3k4/8/8/8/8/8/8/RR2K3 w B - 1 1",
+		"1r2k3/8/8/8/8/8/8/RR2K3 w Bq - 0 0":                                      "1r2k3/8/8/8/8/8/R7/1R2K3 b Qq - 1 0",
 	}
 	for k, v := range movesMap {
 		b := ParseFen(k)
@@ -139,6 +156,141 @@ func TestApplyUnapply(t *testing.T) {
 	}
 }
 
+// Walks perft trees, checking that UnmakeMove restores every position exactly.
+func TestMakeUnmakeMove(t *testing.T) {
+	positions := []string{
+		Startpos,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"1r2k3/8/8/8/8/8/8/RR2K3 w Bq - 0 1",
+		"4k3/8/8/8/8/8/8/5KR1 w K - 0 1",
+	}
+	var walk func(b *Board, depth int)
+	walk = func(b *Board, depth int) {
+		var moves MoveList
+		b.GenerateLegalMovesInto(&moves)
+		for _, m := range moves.Slice() {
+			before := *b
+			var undo Undo
+			b.MakeMove(m, &undo)
+			if b.Hash() != recomputeBoardHash(b) {
+				t.Fatal("Wrong hash after", &m, "in", before.ToFen())
+			}
+			if sq, ok := mailboxMismatch(b); !ok {
+				t.Fatal("Wrong piece on", IndexToAlgebraic(sq), "after", &m, "in", before.ToFen())
+			}
+			if depth > 1 {
+				walk(b, depth-1)
+			}
+			b.UnmakeMove(m, &undo)
+			if *b != before {
+				t.Fatal("UnmakeMove of", &m, "didn't restore", before.ToFen(), "\ngot", b.ToFen())
+			}
+		}
+	}
+	for _, fen := range positions {
+		b := ParseFen(fen)
+		walk(&b, 3)
+	}
+}
+
+// Checks Board.squares against the bitboards, returning the first square where
+// they differ.
+func mailboxMismatch(b *Board) (Square, bool) {
+	for sq := Square(0); sq < 64; sq++ {
+		white, _ := determinePieceType(&b.White, uint64(1)<<sq)
+		black, _ := determinePieceType(&b.Black, uint64(1)<<sq)
+		piece, color, ok := b.PieceAt(sq)
+		switch {
+		case white != Nothing && (piece != white || color != White),
+			black != Nothing && (piece != black || color != Black),
+			white == Nothing && black == Nothing && ok:
+			return sq, false
+		}
+	}
+	return 0, true
+}
+
+func TestPutPiece(t *testing.T) {
+	want := ParseFen("4k3/8/8/3pP3/8/8/8/4K2R w K d6 0 1")
+	b := ParseFen("4k3/8/8/3p4/8/8/8/4K2R w K d6 0 1")
+	b.PutPiece(Square(36), Queen, Black) // e5
+	b.PutPiece(Square(36), Pawn, White)  // replacing the queen
+	b.PutPiece(Square(0), Knight, Black) // a1
+	b.RemovePiece(Square(0))
+	b.RemovePiece(Square(1)) // already empty
+	if b != want {
+		t.Errorf("Wrong board after editing: %v\nexpected %v", b.ToFen(), want.ToFen())
+	}
+	if b.Hash() != recomputeBoardHash(&b) {
+		t.Error("Wrong hash after editing")
+	}
+	if p, c, ok := b.PieceAt(Square(35)); p != Pawn || c != Black || !ok {
+		t.Error("Wrong piece on d5:", p, c, ok)
+	}
+	if p, _, ok := b.PieceAt(Square(27)); p != Nothing || ok {
+		t.Error("Expected d4 to be empty")
+	}
+}
+
+// A board whose bitboards are written directly is made whole by Sync.
+func TestSync(t *testing.T) {
+	want := ParseFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	b := want
+	b.White, b.Black = Bitboards{}, Bitboards{}
+	b.squares, b.hash = [64]uint8{}, 0
+	for _, pair := range [2][2]*Bitboards{{&b.White, &want.White}, {&b.Black, &want.Black}} {
+		side, from := pair[0], pair[1]
+		side.Pawns, side.Knights, side.Bishops = from.Pawns, from.Knights, from.Bishops
+		side.Rooks, side.Queens, side.Kings = from.Rooks, from.Queens, from.Kings
+	}
+	b.Sync()
+	if b != want {
+		t.Errorf("Wrong board after Sync: %v\nexpected %v", b.ToFen(), want.ToFen())
+	}
+}
+
+func TestUndoCaptured(t *testing.T) {
+	cases := []struct {
+		fen      string
+		move     string
+		captured Piece
+		castled  bool
+	}{
+		{Startpos, "e2e4", Nothing, false},
+		{"r3k3/1ppp1ppr/8/3Pp3/8/8/1PP1PPPP/R3K2R w - e6 3 0", "d5e6", Pawn, false},
+		{"r3k1Q1/1pp5/4N3/3br3/8/2p3n1/1p2PP2/R1B1K2n b - - 0 0", "b2c1b", Bishop, false},
+		{"r3k2r/Pppp1ppp/1b3nbN/nPB5/B1P1P3/q4N2/P2P2PP/r2Q1RK1 w kq - 0 0", "d1a1", Rook, false},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQK2R w KQkq - 0 0", "e1g1", Nothing, true},
+		{"4k3/8/8/8/8/8/8/5KR1 w K - 0 0", "f1g1", Nothing, true},
+	}
+	for _, c := range cases {
+		b := ParseFen(c.fen)
+		var undo Undo
+		b.MakeMove(parseMove(c.move), &undo)
+		if undo.Captured != c.captured || undo.Castled != c.castled {
+			t.Errorf("%s in %s: got %+v", c.move, c.fen, undo)
+		}
+	}
+}
+
+func TestMakeMoveAllocs(t *testing.T) {
+	b := ParseFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	var moves MoveList
+	b.GenerateLegalMovesInto(&moves)
+	allocs := testing.AllocsPerRun(10, func() {
+		for _, m := range moves.Slice() {
+			var undo Undo
+			b.MakeMove(m, &undo)
+			b.UnmakeMove(m, &undo)
+		}
+	})
+	if allocs != 0 {
+		t.Error("MakeMove and UnmakeMove allocated", allocs, "times")
+	}
+}
+
 func TestNullMoveHash(t *testing.T) {
 	b := ParseFen(Startpos)
 
@@ -153,3 +305,94 @@ func TestNullMoveHash(t *testing.T) {
 		t.Errorf("Bad hash after unmove")
 	}
 }
+
+func TestNullMoveState(t *testing.T) {
+	positions := map[string]string{
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1": "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 1 2",
+		"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 7 20":                       "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 8 20",
+	}
+	for fen, want := range positions {
+		b := ParseFen(fen)
+		unmove := b.NullMove()
+		if b.ToFen() != want {
+			t.Error("Null move produced\n", b.ToFen(), "\ninstead of\n", want)
+		}
+		if b.Hash() != recomputeBoardHash(&b) {
+			t.Error("Null move hash differs from recomputed hash for", fen)
+		}
+		moves, _ := b.GenerateLegalMoves()
+		for _, m := range moves {
+			unapply := b.Apply(m)
+			unapply()
+		}
+		unmove()
+		if b.ToFen() != fen || b.Hash() != recomputeBoardHash(&b) {
+			t.Error("Null move undo failed for", fen, "\ngot", b.ToFen())
+		}
+	}
+}
+
+// Hash values must not change without an increment of HashVersion. Under
+// HashVersion 1 they are Polyglot keys; these are the published examples.
+func TestHashStability(t *testing.T) {
+	if HashVersion != 1 {
+		t.Fatal("Update the expected hashes for the new HashVersion")
+	}
+	hashes := map[string]uint64{
+		Startpos: 0x463b96181691fc9c,
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1":   0x823c9b50fd114196,
+		"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2": 0x0756b94461c50fb0,
+		"rnbqkbnr/ppp1pppp/8/3pP3/8/8/PPPP1PPP/RNBQKBNR b KQkq - 0 2":   0x662fafb965db29d4,
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3": 0x22a48b5a8e47ff78,
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPPKPPP/RNBQ1BNR b kq - 0 3":    0x652a607ca3f242c1,
+		"rnbq1bnr/ppp1pkpp/8/3pPp2/8/8/PPPPKPPP/RNBQ1BNR w - - 0 4":     0x00fdd303c946bdd9,
+		"rnbqkbnr/p1pppppp/8/8/PpP4P/8/1P1PPPP1/RNBQKBNR b KQkq c3 0 3": 0x3c8123ea7b067637,
+		"rnbqkbnr/p1pppppp/8/8/P6P/R1p5/1P1PPPP1/1NBQKBNR b Kkq - 0 4":  0x5c3f9b829b279560,
+	}
+	for fen, want := range hashes {
+		b := ParseFen(fen)
+		if b.Hash() != want {
+			t.Errorf("Hash of %v is %#016x, expected %#016x", fen, b.Hash(), want)
+		}
+	}
+}
+
+func TestHashEnPassant(t *testing.T) {
+	// An e.p. square that no pawn can capture on doesn't affect the hash
+	b1 := ParseFen("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1")
+	b2 := ParseFen("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1")
+	if b1.Hash() != b2.Hash() {
+		t.Error("Uncapturable e.p. square changed the hash")
+	}
+	// but one that can be captured on does, depending on its file
+	b1 = ParseFen("rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3")
+	b2 = ParseFen("rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq - 0 3")
+	b3 := ParseFen("rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 3")
+	if b1.Hash() == b2.Hash() || b1.Hash() == b3.Hash() || b2.Hash() == b3.Hash() {
+		t.Error("Capturable e.p. squares didn't change the hash")
+	}
+	// A double push next to an enemy pawn, reached by different move orders,
+	// agrees with the hash computed from scratch, and is undone cleanly.
+	b := ParseFen("4k3/8/8/8/1p6/8/P1P5/4K3 w - - 0 1")
+	for _, movestr := range []string{"a2a4", "c2c4"} {
+		before := b.Hash()
+		unapply := b.Apply(parseMove(movestr))
+		if b.Hash() != recomputeBoardHash(&b) {
+			t.Error("Hash after", movestr, "differs from recomputed hash")
+		}
+		capture := b.Apply(parseMove("b4" + movestr[2:3] + "3"))
+		if b.Hash() != recomputeBoardHash(&b) {
+			t.Error("Hash after e.p. capture differs from recomputed hash")
+		}
+		capture()
+		unmove := b.NullMove()
+		if b.Hash() != recomputeBoardHash(&b) {
+			t.Error("Hash after null move differs from recomputed hash")
+		}
+		unmove()
+		unapply()
+		if b.Hash() != before {
+			t.Error("Hash not restored after undoing", movestr)
+		}
+	}
+}
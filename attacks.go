@@ -0,0 +1,162 @@
+package dragon
+
+import (
+	"math/bits"
+)
+
+// The squares a knight on a square attacks.
+func KnightAttacks(sq Square) uint64 {
+	return knightMasks[sq]
+}
+
+// The squares a king on a square attacks.
+func KingAttacks(sq Square) uint64 {
+	return kingMasks[sq]
+}
+
+// The squares a pawn of a color on a square attacks.
+func PawnAttacks(sq Square, c Color) uint64 {
+	return pawnAttacks(uint64(1)<<sq, c == White)
+}
+
+// The pieces of a color that attack a square, as if only the occupied squares
+// held pieces: pieces elsewhere don't attack, and sliders see through empty
+// squares. Pass the board's own occupancy, White.All | Black.All, for the
+// attackers in the position.
+func (b *Board) AttackersTo(sq Square, c Color, occupied uint64) uint64 {
+	return b.attackersTo(uint8(sq), c == Black, occupied)
+}
+
+// The squares that the pieces of a color attack, whether empty or occupied by
+// either side. Sliders are blocked by the opposing king, like any other piece,
+// so the squares behind a king in check from a slider aren't included even
+// though the king can't move to them.
+func (b *Board) AttackedBy(c Color) uint64 {
+	pieces := &(b.White)
+	if c == Black {
+		pieces = &(b.Black)
+	}
+	occupied := b.White.All | b.Black.All
+	attacked := pawnAttacks(pieces.Pawns, c == White)
+	for knights := pieces.Knights; knights != 0; knights &= knights - 1 {
+		attacked |= knightMasks[bits.TrailingZeros64(knights)]
+	}
+	for diagonal := pieces.Bishops | pieces.Queens; diagonal != 0; diagonal &= diagonal - 1 {
+		attacked |= CalculateBishopMoveBitboard(uint8(bits.TrailingZeros64(diagonal)), occupied)
+	}
+	for orthogonal := pieces.Rooks | pieces.Queens; orthogonal != 0; orthogonal &= orthogonal - 1 {
+		attacked |= CalculateRookMoveBitboard(uint8(bits.TrailingZeros64(orthogonal)), occupied)
+	}
+	if pieces.Kings != 0 {
+		attacked |= kingMasks[bits.TrailingZeros64(pieces.Kings)]
+	}
+	return attacked
+}
+
+// The opponent pieces giving check to the side to move.
+func (b *Board) Checkers() uint64 {
+	king := b.White.Kings
+	if !b.Wtomove {
+		king = b.Black.Kings
+	}
+	if king == 0 {
+		return 0
+	}
+	return b.attackersTo(uint8(bits.TrailingZeros64(king)), b.Wtomove, b.White.All|b.Black.All)
+}
+
+// Whether a legal move checks the opponent's king, without making the move:
+// directly, by uncovering a slider (including by an en passant capture), with
+// the piece a pawn promotes to, or with the rook when castling.
+func (b *Board) GivesCheck(m Move) bool {
+	opp := &(b.Black)
+	if !b.Wtomove {
+		opp = &(b.White)
+	}
+	if opp.Kings == 0 {
+		return false
+	}
+	king := uint8(bits.TrailingZeros64(opp.Kings))
+	from, to := m.From(), m.To()
+	fromBitboard, toBitboard := uint64(1)<<from, uint64(1)<<to
+	occupied := (b.White.All | b.Black.All) &^ fromBitboard
+	if right, ok := b.castlingRight(m); ok {
+		kingFile, rookFile := castlingTargets(right)
+		rank := from &^ 7
+		rookFrom, rookTo := rank+b.rookFiles[right], rank+rookFile
+		occupied = occupied&^(uint64(1)<<rookFrom) | uint64(1)<<(rank+kingFile) | uint64(1)<<rookTo
+		// The king may land on the rook's old square, so don't count the rook there.
+		return CalculateRookMoveBitboard(rookTo, occupied)&opp.Kings != 0 ||
+			b.attackersTo(king, !b.Wtomove, occupied)&^(uint64(1)<<rookFrom) != 0
+	}
+	piece := Piece(b.squares[from] & 7)
+	occupied |= toBitboard
+	if piece == Pawn && to == b.enpassant && b.enpassant != 0 {
+		occupied &^= uint64(1) << (from&^7 | to&7)
+	}
+	// The moving piece has left the occupied squares, so these are discoveries;
+	// the opponent wasn't in check, so no other piece can attack the king.
+	if b.attackersTo(king, !b.Wtomove, occupied) != 0 {
+		return true
+	}
+	if m.Promote() != Nothing {
+		piece = m.Promote()
+	}
+	switch piece {
+	case Pawn:
+		return pawnAttacks(toBitboard, b.Wtomove)&opp.Kings != 0
+	case Knight:
+		return knightMasks[to]&opp.Kings != 0
+	case Bishop:
+		return CalculateBishopMoveBitboard(to, occupied)&opp.Kings != 0
+	case Rook:
+		return CalculateRookMoveBitboard(to, occupied)&opp.Kings != 0
+	case Queen:
+		return (CalculateBishopMoveBitboard(to, occupied)|CalculateRookMoveBitboard(to, occupied))&opp.Kings != 0
+	}
+	return false
+}
+
+// The pieces of a color that are pinned to their king: those that are the only
+// piece between it and an opponent bishop, rook or queen that would otherwise
+// attack it.
+func (b *Board) Pinned(c Color) uint64 {
+	pinned, _ := b.pins(c)
+	return pinned
+}
+
+// The opponent bishops, rooks and queens that pin pieces of a color to their
+// king, as found by Pinned.
+func (b *Board) Pinners(c Color) uint64 {
+	_, pinners := b.pins(c)
+	return pinners
+}
+
+func (b *Board) pins(c Color) (pinned, pinners uint64) {
+	ours, opp := &(b.White), &(b.Black)
+	if c == Black {
+		ours, opp = &(b.Black), &(b.White)
+	}
+	if ours.Kings == 0 {
+		return 0, 0
+	}
+	king := uint8(bits.TrailingZeros64(ours.Kings))
+	occupied := b.White.All | b.Black.All
+	// Sliders that would attack the king on an empty board.
+	orthogonal := CalculateRookMoveBitboard(king, 0) & (opp.Rooks | opp.Queens)
+	diagonal := CalculateBishopMoveBitboard(king, 0) & (opp.Bishops | opp.Queens)
+	for snipers := orthogonal | diagonal; snipers != 0; snipers &= snipers - 1 {
+		sniper := uint8(bits.TrailingZeros64(snipers))
+		var between uint64
+		if orthogonal&(uint64(1)<<sniper) != 0 {
+			between = CalculateRookMoveBitboard(sniper, uint64(1)<<king) & CalculateRookMoveBitboard(king, uint64(1)<<sniper)
+		} else {
+			between = CalculateBishopMoveBitboard(sniper, uint64(1)<<king) & CalculateBishopMoveBitboard(king, uint64(1)<<sniper)
+		}
+		if blockers := between & occupied; bits.OnesCount64(blockers) == 1 && blockers&ours.All != 0 {
+			pinned |= blockers
+			pinners |= uint64(1) << sniper
+		}
+	}
+	return pinned, pinners
+}
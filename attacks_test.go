@@ -0,0 +1,189 @@
+package dragon
+
+import (
+	"testing"
+)
+
+func TestPieceAttacks(t *testing.T) {
+	cases := []struct {
+		name      string
+		got, want uint64
+	}{
+		{"knight on a1", KnightAttacks(0), 1<<17 | 1<<10},
+		{"knight on e4", KnightAttacks(28), 1<<11 | 1<<13 | 1<<18 | 1<<22 | 1<<34 | 1<<38 | 1<<43 | 1<<45},
+		{"king on a1", KingAttacks(0), 1<<1 | 1<<8 | 1<<9},
+		{"white pawn on e4", PawnAttacks(28, White), 1<<35 | 1<<37},
+		{"white pawn on h2", PawnAttacks(15, White), 1 << 22},
+		{"black pawn on a7", PawnAttacks(48, Black), 1 << 41},
+	}
+	for _, c := range cases {
+		if c.got != c.want {
+			t.Errorf("Wrong attacks for a %s: %x, expected %x", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestAttackersTo(t *testing.T) {
+	b := ParseFen(Startpos)
+	occupied := b.White.All | b.Black.All
+	if got := b.AttackersTo(21, White, occupied); got != 1<<6|1<<12|1<<14 { // f3
+		t.Errorf("Wrong attackers of f3: %x", got)
+	}
+	if got := b.AttackersTo(21, Black, occupied); got != 0 {
+		t.Errorf("Wrong black attackers of f3: %x", got)
+	}
+
+	// Removing a piece from the occupancy reveals the piece behind it.
+	b = ParseFen("4k3/8/8/8/8/8/8/R2Q3K w - - 0 1")
+	occupied = b.White.All | b.Black.All
+	if got := b.AttackersTo(4, White, occupied); got != 1<<3 { // e1
+		t.Errorf("Wrong attackers of e1: %x", got)
+	}
+	if got := b.AttackersTo(4, White, occupied&^(1<<3)); got != 1<<0 {
+		t.Errorf("Wrong attackers of e1 without the queen: %x", got)
+	}
+}
+
+func TestAttackedBy(t *testing.T) {
+	b := ParseFen("4k3/8/8/8/8/8/8/R1n4K w - - 0 1")
+	white := FileMasks[0]&^1 | 1<<1 | 1<<2 | 1<<6 | 1<<14 | 1<<15
+	if got := b.AttackedBy(White); got != white {
+		t.Errorf("Wrong squares attacked by white: %x, expected %x", got, white)
+	}
+	black := uint64(1)<<59 | 1<<61 | 1<<51 | 1<<52 | 1<<53 | 1<<8 | 1<<17 | 1<<19 | 1<<12
+	if got := b.AttackedBy(Black); got != black {
+		t.Errorf("Wrong squares attacked by black: %x, expected %x", got, black)
+	}
+}
+
+func TestCheckersAndPins(t *testing.T) {
+	b := ParseFen("4k3/8/8/8/1b6/8/4r3/R3K2R w KQ - 0 0")
+	if got := b.Checkers(); got != 1<<25|1<<12 {
+		t.Errorf("Wrong checkers: %x", got)
+	}
+	if got := ParseFen(Startpos); got.Checkers() != 0 {
+		t.Error("Checkers in the start position")
+	}
+
+	// Pins on a file and a diagonal; two pieces between a queen and the king;
+	// and a black piece between a black rook and the white king.
+	b = ParseFen("4k3/4r3/8/8/1b2B2q/6P1/3N1P2/rn2K3 w - - 0 1")
+	if got := b.Pinned(White); got != 1<<28|1<<11 {
+		t.Errorf("Wrong pinned white pieces: %x", got)
+	}
+	if got := b.Pinners(White); got != 1<<52|1<<25 {
+		t.Errorf("Wrong pinners of white pieces: %x", got)
+	}
+	if b.Pinned(Black) != 0 || b.Pinners(Black) != 0 {
+		t.Errorf("Wrong black pins: %x %x", b.Pinned(Black), b.Pinners(Black))
+	}
+}
+
+// Checkers and Pinned agree with the move generator throughout a perft tree.
+func TestAttacksAgreeWithMoveGeneration(t *testing.T) {
+	var walk func(b *Board, depth int)
+	walk = func(b *Board, depth int) {
+		side := White
+		if !b.Wtomove {
+			side = Black
+		}
+		var scratch MoveList
+		if pinned := b.generatePinnedMoves(&scratch, ^uint64(0), genAll); b.Pinned(side) != pinned {
+			t.Fatalf("Pinned is %x, expected %x in %s", b.Pinned(side), pinned, b.ToFen())
+		}
+		if (b.Checkers() != 0) != b.OurKingInCheck() {
+			t.Fatal("Checkers disagrees with OurKingInCheck in", b.ToFen())
+		}
+		if depth == 0 {
+			return
+		}
+		var moves MoveList
+		b.GenerateLegalMovesInto(&moves)
+		for _, m := range moves.Slice() {
+			var undo Undo
+			b.MakeMove(m, &undo)
+			walk(b, depth-1)
+			b.UnmakeMove(m, &undo)
+		}
+	}
+	for _, fen := range []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+	} {
+		b := ParseFen(fen)
+		walk(&b, 3)
+	}
+}
+
+func TestGivesCheck(t *testing.T) {
+	cases := []struct {
+		fen   string
+		move  string
+		check bool
+	}{
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 0 1", "a1a8", true},      // direct
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 0 1", "a1a7", false},     //
+		{"4k3/8/8/8/8/8/4N3/4R1K1 w - - 0 1", "e2c3", true},   // discovered
+		{"4k3/8/8/8/8/8/4N3/4R1K1 w - - 0 1", "e2f4", true},   //
+		{"4k3/8/8/8/8/8/4B3/4R1K1 w - - 0 1", "e2f3", true},   //
+		{"4k3/8/8/8/8/8/4P3/4R1K1 w - - 0 1", "e2e3", false},  // still blocking
+		{"8/3P4/8/8/8/8/k7/6K1 w - - 0 1", "d7d8q", false},    //
+		{"8/3P1k2/8/8/8/8/8/6K1 w - - 0 1", "d7d8n", true},    // promotion
+		{"8/3P1k2/8/8/8/8/8/6K1 w - - 0 1", "d7d8q", false},   //
+		{"3n1k2/4P3/8/8/8/8/8/6K1 w - - 0 1", "e7d8r", true},  // capture-promotion
+		{"5k2/8/8/8/8/8/8/4K2R w K - 0 1", "e1g1", true},      // castling rook
+		{"3k4/8/8/8/8/8/8/R3K3 w Q - 0 1", "e1c1", true},      //
+		{"2k5/8/8/8/8/8/8/R3K3 w Q - 0 1", "e1c1", false},     //
+		{"4k3/8/8/8/8/8/8/4K2R w K - 0 1", "e1g1", false},     //
+		{"5k2/8/8/8/8/8/8/5KR1 w G - 0 1", "f1g1", true},      // 960: the king takes the rook's square
+		{"8/8/8/KpP4k/8/8/8/8 w - b6 0 1", "c5b6", false},     // en passant
+		{"8/8/8/RpP4k/8/8/8/K7 w - b6 0 1", "c5b6", true},     // discovery by both pawns leaving
+		{"5k2/8/8/1pP5/8/B7/8/4K3 w - b6 0 1", "c5b6", true},  //
+		{"8/8/8/1pP5/8/8/6k1/B3K3 w - b6 0 1", "c5b6", false}, //
+		{"8/8/k7/1pP5/8/8/8/4K3 w - b6 0 1", "c5b6", false},   //
+		{"8/2k5/8/1pP5/8/8/8/4K3 w - b6 0 1", "c5b6", true},   // direct, from the e.p. square
+		{"8/8/8/2k5/8/4K3/8/8 w - - 0 1", "e3d3", false},      // kings never check
+		{"4r3/8/8/8/8/8/3k4/4K3 b - - 0 1", "d2d1", true},     // a king move discovering check
+		{"8/8/8/8/8/8/4p1k1/2K5 b - - 0 1", "e2e1q", true},    // black promotion
+		{"rnbqkbnr/ppppp1pp/8/5p2/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 1", "d1h5", true},
+	}
+	for _, c := range cases {
+		b := ParseFen(c.fen)
+		if got := b.GivesCheck(parseMove(c.move)); got != c.check {
+			t.Errorf("GivesCheck(%s) is %v in %s", c.move, got, c.fen)
+		}
+	}
+}
+
+// GivesCheck agrees with making each move, through perft trees.
+func TestGivesCheckAgreesWithMakeMove(t *testing.T) {
+	var walk func(b *Board, depth int)
+	walk = func(b *Board, depth int) {
+		var moves MoveList
+		b.GenerateLegalMovesInto(&moves)
+		for _, m := range moves.Slice() {
+			givesCheck := b.GivesCheck(m)
+			var undo Undo
+			b.MakeMove(m, &undo)
+			if givesCheck != b.OurKingInCheck() {
+				b.UnmakeMove(m, &undo)
+				t.Fatalf("GivesCheck(%v) is %v in %s", &m, givesCheck, b.ToFen())
+			}
+			if depth > 1 {
+				walk(b, depth-1)
+			}
+			b.UnmakeMove(m, &undo)
+		}
+	}
+	for _, fen := range []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"1r2k3/8/8/8/8/8/8/RR2K3 w Bq - 0 1",
+		"2r1kr2/8/8/8/8/8/8/1R2K1R1 w GBfc - 0 1",
+	} {
+		b := ParseFen(fen)
+		walk(&b, 4)
+	}
+}
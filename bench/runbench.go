@@ -34,6 +34,24 @@ func main() {
 	printResultLine(testing.Benchmark(benchmarkKiwipete), "Kiwipete position", kpResult, 5)
 	printResultLine(testing.Benchmark(benchmarkDense), "Dense position", denseResult, 6)
 	printResultLine(testing.Benchmark(benchmarkEndgameRP), "Endgame R/P position", endgameResult, 7)
+	fmt.Println("\nMOVE LIST: GenerateLegalMoves vs. GenerateLegalMovesInto")
+	printAllocsLine(testing.Benchmark(benchmarkKiwipeteSlices), "Kiwipete, slices", kpSlicesResult, 4)
+	moveList := testing.Benchmark(benchmarkKiwipeteMoveList)
+	printAllocsLine(moveList, "Kiwipete, MoveList", kpMoveListResult, 4)
+	fmt.Println("\nMAKE/UNMAKE: Apply vs. MakeMove and UnmakeMove")
+	printAllocsLine(moveList, "Kiwipete, Apply", kpMoveListResult, 4)
+	printAllocsLine(testing.Benchmark(benchmarkKiwipeteMakeMove), "Kiwipete, MakeMove", kpMakeMoveResult, 4)
+	// Perft can't be run without the mailbox, so its effect there was measured
+	// across the commit that added it, with Kiwipete to depth 4 (medians of 6
+	// runs): Apply 56.7ms before and 58.9ms after, MakeMove 46.1ms before and
+	// 50.3ms after, which is within this benchmark's noise. What it speeds up
+	// is finding the piece on a square:
+	fmt.Println("\nMAILBOX: piece lookups on every square, bitboards vs. PieceAt")
+	printLookupLine(testing.Benchmark(benchmarkLookupBitboards), "Kiwipete, bitboards")
+	printLookupLine(testing.Benchmark(benchmarkLookupMailbox), "Kiwipete, PieceAt")
+	fmt.Println("\nPARALLEL AND HASHED PERFT")
+	printResultLine(testing.Benchmark(benchmarkStartposParallel), "Start, parallel", startposParallelResult, 6)
+	printResultLine(testing.Benchmark(benchmarkStartposHashed), "Start, parallel+hash", startposHashedResult, 6)
 	fmt.Println()
 }
 
@@ -42,6 +60,15 @@ func printResultLine(res testing.BenchmarkResult, name string, perftValue int64,
 		perftValue, float64(perftValue)/(float64(res.NsPerOp())/nsPerS))
 }
 
+func printAllocsLine(res testing.BenchmarkResult, name string, perftValue int64, depth int) {
+	fmt.Printf("%-22s depth %-3d %8dms %12d nodes  %11.0fnps %10d allocs\n", name+":", depth, res.NsPerOp()/nsPerMs,
+		perftValue, float64(perftValue)/(float64(res.NsPerOp())/nsPerS), res.AllocsPerOp())
+}
+
+func printLookupLine(res testing.BenchmarkResult, name string) {
+	fmt.Printf("%-22s %8dns per 64 squares\n", name+":", res.NsPerOp())
+}
+
 // -----------------
 // BENCHMARK HELPERS
 // -----------------
@@ -95,3 +122,135 @@ func benchmarkEndgameRP(b *testing.B) {
 		endgameResult = dragon.Perft(&board, 7)
 	}
 }
+
+// Perft as it was before MoveList, allocating a slice of moves at every node.
+func perftSlices(b *dragon.Board, n int) int64 {
+	if n <= 0 {
+		return 1
+	}
+	moves, _ := b.GenerateLegalMoves()
+	if n == 1 {
+		return int64(len(moves))
+	}
+	var count int64 = 0
+	for _, move := range moves {
+		unapply := b.Apply(move)
+		count += perftSlices(b, n-1)
+		unapply()
+	}
+	return count
+}
+
+var kpSlicesResult int64 = 0
+
+func benchmarkKiwipeteSlices(b *testing.B) {
+	pos := "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0"
+	board := dragon.ParseFen(pos)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		kpSlicesResult = perftSlices(&board, 4)
+	}
+}
+
+// Perft with GenerateLegalMovesInto and Apply, as it was before MakeMove,
+// allocating a closure to unapply each move but not a slice of moves.
+func perftApply(b *dragon.Board, n int) int64 {
+	if n <= 0 {
+		return 1
+	}
+	var moves dragon.MoveList
+	b.GenerateLegalMovesInto(&moves)
+	if n == 1 {
+		return int64(moves.Count)
+	}
+	var count int64 = 0
+	for _, move := range moves.Slice() {
+		unapply := b.Apply(move)
+		count += perftApply(b, n-1)
+		unapply()
+	}
+	return count
+}
+
+var kpMoveListResult int64 = 0
+
+// Also the Apply line of the make/unmake comparison.
+func benchmarkKiwipeteMoveList(b *testing.B) {
+	pos := "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0"
+	board := dragon.ParseFen(pos)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		kpMoveListResult = perftApply(&board, 4)
+	}
+}
+
+var kpMakeMoveResult int64 = 0
+
+func benchmarkKiwipeteMakeMove(b *testing.B) {
+	pos := "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0"
+	board := dragon.ParseFen(pos)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		kpMakeMoveResult = dragon.Perft(&board, 4)
+	}
+}
+
+// Finds the piece on a square as the board did before it kept a mailbox, by
+// testing each bitboard in turn.
+func pieceFromBitboards(b *dragon.Board, sq dragon.Square) (dragon.Piece, dragon.Color, bool) {
+	mask := uint64(1) << sq
+	for color, bb := range [2]*dragon.Bitboards{&b.White, &b.Black} {
+		if bb.All&mask == 0 {
+			continue
+		}
+		for piece, pieces := range [7]uint64{0, bb.Pawns, bb.Knights, bb.Bishops, bb.Rooks, bb.Queens, bb.Kings} {
+			if pieces&mask != 0 {
+				return dragon.Piece(piece), dragon.Color(color), true
+			}
+		}
+	}
+	return dragon.Nothing, dragon.White, false
+}
+
+var lookupResult int = 0
+
+func benchmarkLookupBitboards(b *testing.B) {
+	board := dragon.ParseFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0")
+	for i := 0; i < b.N; i++ {
+		for sq := dragon.Square(0); sq < 64; sq++ {
+			if _, _, ok := pieceFromBitboards(&board, sq); ok {
+				lookupResult++
+			}
+		}
+	}
+}
+
+func benchmarkLookupMailbox(b *testing.B) {
+	board := dragon.ParseFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0")
+	for i := 0; i < b.N; i++ {
+		for sq := dragon.Square(0); sq < 64; sq++ {
+			if _, _, ok := board.PieceAt(sq); ok {
+				lookupResult++
+			}
+		}
+	}
+}
+
+var startposParallelResult int64 = 0
+
+func benchmarkStartposParallel(b *testing.B) {
+	board := dragon.ParseFen(dragon.Startpos)
+	for i := 0; i < b.N; i++ {
+		startposParallelResult = dragon.PerftParallel(&board, 6, 0)
+	}
+}
+
+var startposHashedResult int64 = 0
+
+func benchmarkStartposHashed(b *testing.B) {
+	board := dragon.ParseFen(dragon.Startpos)
+	for i := 0; i < b.N; i++ {
+		table := dragon.NewPerftTable(64)
+		startposHashedResult = table.PerftParallel(&board, 6, 0)
+	}
+}
@@ -0,0 +1,252 @@
+// Package book reads and writes opening books in the Polyglot .bin format.
+//
+// A book is a sequence of 16-byte entries sorted by position key, each
+// holding a move and a weight, so moves are looked up by binary search.
+// Polyglot keys are Zobrist hashes computed from the table of 781 random
+// numbers published with Polyglot, which dragon's Board.Hash uses too.
+package book
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+
+	"github.com/noahklein/dragon"
+)
+
+// The size of a book entry, in bytes.
+const EntrySize = 16
+
+var ErrBadBook = errors.New("book: size is not a multiple of 16 bytes")
+
+// A raw book entry.
+type Entry struct {
+	Key    uint64
+	Move   uint16 // the Polyglot move encoding; see DecodeMove
+	Weight uint16
+	Learn  uint32
+}
+
+// A book move, and its share of the weight of all the book moves in its position.
+type WeightedMove struct {
+	Move   dragon.Move
+	Weight int
+}
+
+// An opening book. Entries are read as they are needed, so large books
+// needn't fit in memory. Safe for concurrent use, if its reader is.
+type Book struct {
+	r      io.ReaderAt
+	n      int       // the number of entries
+	closer io.Closer // or nil
+}
+
+// Opens a book file, which stays open until Close.
+func Open(path string) (*Book, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	bk, err := NewBook(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	bk.closer = f
+	return bk, nil
+}
+
+// Creates a book that reads size bytes of entries, sorted by key, from r.
+func NewBook(r io.ReaderAt, size int64) (*Book, error) {
+	if size%EntrySize != 0 {
+		return nil, ErrBadBook
+	}
+	return &Book{r: r, n: int(size / EntrySize)}, nil
+}
+
+// Reads a whole book into memory from a stream, which must hold entries
+// sorted by key.
+func Read(r io.Reader) (*Book, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewBook(bytes.NewReader(data), int64(len(data)))
+}
+
+// Closes the file of a book made by Open.
+func (bk *Book) Close() error {
+	if bk.closer == nil {
+		return nil
+	}
+	return bk.closer.Close()
+}
+
+// The number of entries in the book.
+func (bk *Book) Len() int {
+	return bk.n
+}
+
+// Reads the i'th entry.
+func (bk *Book) Entry(i int) (Entry, error) {
+	var e [EntrySize]byte
+	if _, err := bk.r.ReadAt(e[:], int64(i)*EntrySize); err != nil {
+		return Entry{}, fmt.Errorf("book: reading entry %d: %w", i, err)
+	}
+	return Entry{
+		Key:    binary.BigEndian.Uint64(e[:]),
+		Move:   binary.BigEndian.Uint16(e[8:]),
+		Weight: binary.BigEndian.Uint16(e[10:]),
+		Learn:  binary.BigEndian.Uint32(e[12:]),
+	}, nil
+}
+
+// Returns the legal book moves for a position, heaviest first. Moves with
+// zero weight, and entries that are not legal in the position (eg: from a
+// key collision), are left out.
+func (bk *Book) Lookup(b *dragon.Board) ([]WeightedMove, error) {
+	key := Key(b)
+	var err error
+	i := sort.Search(bk.n, func(i int) bool {
+		e, readErr := bk.Entry(i)
+		if readErr != nil {
+			err = readErr
+			return true
+		}
+		return e.Key >= key
+	})
+	if err != nil {
+		return nil, err
+	}
+	var moves []WeightedMove
+	for ; i < bk.n; i++ {
+		e, err := bk.Entry(i)
+		if err != nil {
+			return nil, err
+		}
+		if e.Key != key {
+			break
+		}
+		m := DecodeMove(b, e.Move)
+		if e.Weight == 0 || !b.IsLegal(m) {
+			continue
+		}
+		moves = append(moves, WeightedMove{m, int(e.Weight)})
+	}
+	sort.SliceStable(moves, func(i, j int) bool { return moves[i].Weight > moves[j].Weight })
+	return moves, nil
+}
+
+// Picks a book move at random, with probability proportional to its weight.
+// Returns false if the position is not in the book.
+func (bk *Book) Pick(b *dragon.Board, r *rand.Rand) (dragon.Move, bool, error) {
+	moves, err := bk.Lookup(b)
+	if err != nil {
+		return 0, false, err
+	}
+	total := 0
+	for _, m := range moves {
+		total += m.Weight
+	}
+	if total == 0 {
+		return 0, false, nil
+	}
+	n := r.Intn(total)
+	for _, m := range moves {
+		if n < m.Weight {
+			return m.Move, true, nil
+		}
+		n -= m.Weight
+	}
+	panic("unreachable")
+}
+
+// Returns the Polyglot key of a position, which is its hash.
+func Key(b *dragon.Board) uint64 {
+	return b.Hash()
+}
+
+// Converts a Polyglot move into a dragon Move in the given position.
+// Polyglot encodes castling as the king capturing its own rook (eg: e1h1),
+// which is translated into the king's two-square move (e1g1), unless the
+// board is in Chess960 mode, where dragon uses the same encoding.
+//
+// Polyglot move layout, from the LSB:
+// 3 bits: destination file
+// 3 bits: destination rank
+// 3 bits: origin file
+// 3 bits: origin rank
+// 3 bits: promotion piece (0: none, 1: knight, 2: bishop, 3: rook, 4: queen)
+func DecodeMove(b *dragon.Board, pm uint16) dragon.Move {
+	to := uint8(pm & 0x3f)
+	from := uint8(pm>>6) & 0x3f
+	var m dragon.Move
+	m.Setfrom(dragon.Square(from)).Setto(dragon.Square(to))
+	if promote := pm >> 12 & 7; promote != 0 {
+		m.Setpromote(dragon.Piece(promote + 1))
+	}
+	kings, rooks := b.White.Kings, b.White.Rooks
+	if !b.Wtomove {
+		kings, rooks = b.Black.Kings, b.Black.Rooks
+	}
+	if !b.Chess960 && kings&(uint64(1)<<from) != 0 && rooks&(uint64(1)<<to) != 0 && (from == 4 || from == 60) {
+		switch to {
+		case from + 3:
+			m.Setto(dragon.Square(from + 2))
+		case from - 4:
+			m.Setto(dragon.Square(from - 2))
+		}
+	}
+	return m
+}
+
+// Converts a dragon Move into a Polyglot move, in the given position.
+// The inverse of DecodeMove.
+func EncodeMove(b *dragon.Board, m dragon.Move) uint16 {
+	from, to := m.From(), m.To()
+	kings := b.White.Kings
+	if !b.Wtomove {
+		kings = b.Black.Kings
+	}
+	if kings&(uint64(1)<<from) != 0 && (from == 4 || from == 60) {
+		switch int(to) - int(from) {
+		case 2:
+			to = from + 3
+		case -2:
+			to = from - 4
+		}
+	}
+	pm := uint16(to) | uint16(from)<<6
+	if promote := m.Promote(); promote != dragon.Nothing {
+		pm |= uint16(promote-1) << 12
+	}
+	return pm
+}
+
+// Writes entries in the book format. The entries must be sorted by key.
+func WriteEntries(w io.Writer, entries []Entry) error {
+	var buf [EntrySize]byte
+	for i, e := range entries {
+		if i > 0 && entries[i-1].Key > e.Key {
+			return fmt.Errorf("book: entries out of order at %d", i)
+		}
+		binary.BigEndian.PutUint64(buf[:], e.Key)
+		binary.BigEndian.PutUint16(buf[8:], e.Move)
+		binary.BigEndian.PutUint16(buf[10:], e.Weight)
+		binary.BigEndian.PutUint32(buf[12:], e.Learn)
+		if _, err := w.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package book
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/noahklein/dragon"
+)
+
+// The keys published with the Polyglot book format.
+func TestPolyglotKeys(t *testing.T) {
+	keys := map[string]uint64{
+		dragon.Startpos: 0x463b96181691fc9c,
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3": 0x22a48b5a8e47ff78,
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPPKPPP/RNBQ1BNR b kq - 0 3":    0x652a607ca3f242c1,
+		"rnbqkbnr/p1pppppp/8/8/PpP4P/8/1P1PPPP1/RNBQKBNR b KQkq c3 0 3": 0x3c8123ea7b067637,
+		"rnbqkbnr/p1pppppp/8/8/P6P/R1p5/1P1PPPP1/1NBQKBNR b Kkq - 0 4":  0x5c3f9b829b279560,
+	}
+	for fen, want := range keys {
+		b := dragon.ParseFen(fen)
+		if Key(&b) != want {
+			t.Errorf("Key of %v is %#016x, expected %#016x", fen, Key(&b), want)
+		}
+	}
+}
+
+func TestMoveEncoding(t *testing.T) {
+	// FEN -> dragon move -> Polyglot move
+	cases := []struct {
+		fen, move string
+		polyglot  uint16
+	}{
+		{dragon.Startpos, "e2e4", 12<<6 | 28},
+		{dragon.Startpos, "g1f3", 6<<6 | 21},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", 4<<6 | 7},   // e1h1
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1c1", 4<<6 | 0},   // e1a1
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8g8", 60<<6 | 63}, // e8h8
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8c8", 60<<6 | 56}, // e8a8
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1f1", 4<<6 | 5},
+		{"8/4P3/8/8/8/8/k7/4K3 w - - 0 1", "e7e8q", 4<<12 | 52<<6 | 60},
+		{"8/4P3/8/8/8/8/k7/4K3 w - - 0 1", "e7e8n", 1<<12 | 52<<6 | 60},
+	}
+	for _, c := range cases {
+		b := dragon.ParseFen(c.fen)
+		m, _ := dragon.ParseMove(c.move)
+		if got := EncodeMove(&b, m); got != c.polyglot {
+			t.Errorf("Encoded %v as %#x instead of %#x", c.move, got, c.polyglot)
+		}
+		if got := DecodeMove(&b, c.polyglot); got != m {
+			t.Errorf("Decoded %#x as %v instead of %v", c.polyglot, &got, c.move)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	start := dragon.ParseFen(dragon.Startpos)
+	e4, _ := dragon.ParseMove("e2e4")
+	d4, _ := dragon.ParseMove("d2d4")
+	a3, _ := dragon.ParseMove("a2a3")
+	e5, _ := dragon.ParseMove("e7e5")
+	other := start
+	other.Apply(e4)
+	entries := []Entry{
+		{Key: Key(&start), Move: EncodeMove(&start, d4), Weight: 10},
+		{Key: Key(&start), Move: EncodeMove(&start, e4), Weight: 30},
+		{Key: Key(&start), Move: EncodeMove(&start, a3), Weight: 0},   // never played
+		{Key: Key(&start), Move: EncodeMove(&other, e5), Weight: 100}, // illegal here
+		{Key: Key(&other), Move: EncodeMove(&other, e5), Weight: 1},
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	var buf bytes.Buffer
+	if err := WriteEntries(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+	bk, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, err := bk.Entry(3); err != nil || bk.Len() != len(entries) || e != entries[3] {
+		t.Error("Entries not read back:", bk.Len(), e, err)
+	}
+
+	moves, err := bk.Lookup(&start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 2 || moves[0] != (WeightedMove{e4, 30}) || moves[1] != (WeightedMove{d4, 10}) {
+		t.Error("Wrong book moves:", moves)
+	}
+	empty := dragon.ParseFen("8/8/8/8/8/8/8/K6k b - - 0 1")
+	if moves, err := bk.Lookup(&empty); err != nil || len(moves) != 0 {
+		t.Error("Expected no moves for a position not in the book:", moves, err)
+	}
+	if _, ok, err := bk.Pick(&empty, nil); err != nil || ok {
+		t.Error("Picked a move from a position not in the book:", err)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	counts := map[dragon.Move]int{}
+	for i := 0; i < 4000; i++ {
+		m, ok, err := bk.Pick(&start, r)
+		if err != nil || !ok {
+			t.Fatal("No move picked:", err)
+		}
+		counts[m]++
+	}
+	if len(counts) != 2 || counts[e4] < 2700 || counts[e4] > 3300 {
+		t.Error("Picks not proportional to weight:", counts)
+	}
+
+	if _, err := Read(bytes.NewReader(make([]byte, 17))); err != ErrBadBook {
+		t.Error("Expected ErrBadBook for a truncated book, got", err)
+	}
+	// A reader that ends halfway through the second of its two entries.
+	bk, err = NewBook(bytes.NewReader(make([]byte, EntrySize+8)), 2*EntrySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bk.Entry(1); !errors.Is(err, io.EOF) {
+		t.Error("Expected EOF reading past the end of the reader, got", err)
+	}
+	if _, err := bk.Lookup(&start); err == nil {
+		t.Error("Expected an error looking up an entry past the end of the reader")
+	}
+	unsorted := []Entry{{Key: 2}, {Key: 1}}
+	if err := WriteEntries(&bytes.Buffer{}, unsorted); err == nil {
+		t.Error("Expected an error writing unsorted entries")
+	}
+}
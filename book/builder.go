@@ -0,0 +1,155 @@
+package book
+
+import (
+	"io"
+	"sort"
+
+	"github.com/noahklein/dragon"
+	"github.com/noahklein/dragon/pgn"
+)
+
+// A Builder collects the moves played in games, and writes them as a book.
+// As in Polyglot, a move scores 2 points for each game won by the side that
+// played it, and 1 for each draw; its weight in the book is its score.
+// The zero value is an empty Builder, which includes every move played.
+type Builder struct {
+	MinGames  int // leave out moves played in fewer games than this
+	MinWeight int // leave out moves scoring less than this
+	MaxPly    int // only use the first MaxPly moves of each game; 0 for all
+
+	moves map[uint64]map[uint16]*moveStats
+}
+
+type moveStats struct {
+	games, score int
+}
+
+// Creates an empty Builder, which includes every move played.
+func NewBuilder() *Builder {
+	return &Builder{moves: make(map[uint64]map[uint16]*moveStats)}
+}
+
+// Adds the main line of a game to the book. Games read by a pgn.Reader carry
+// their positions; otherwise the moves are replayed from the starting
+// position, and must be legal. Null moves (Move 0) are played through, but
+// aren't added to the book.
+func (bd *Builder) AddGame(g *pgn.Game) error {
+	var whiteScore, blackScore int
+	switch g.Result {
+	case "1-0":
+		whiteScore = 2
+	case "0-1":
+		blackScore = 2
+	case "1/2-1/2":
+		whiteScore, blackScore = 1, 1
+	}
+	positions := g.Positions
+	if len(positions) < len(g.Moves) {
+		b, err := g.StartingPosition()
+		if err != nil {
+			return err
+		}
+		positions = make([]dragon.Board, len(g.Moves))
+		for i, n := range g.Moves {
+			positions[i] = b
+			if n.Move == 0 {
+				b.NullMove()
+			} else if _, err := b.ApplySafe(n.Move); err != nil {
+				return err
+			}
+		}
+	}
+	for i, n := range g.Moves {
+		if bd.MaxPly > 0 && i >= bd.MaxPly {
+			break
+		}
+		if n.Move == 0 {
+			continue
+		}
+		b := &positions[i]
+		key := Key(b)
+		if bd.moves == nil {
+			bd.moves = make(map[uint64]map[uint16]*moveStats)
+		}
+		if bd.moves[key] == nil {
+			bd.moves[key] = make(map[uint16]*moveStats)
+		}
+		pm := EncodeMove(b, n.Move)
+		stats := bd.moves[key][pm]
+		if stats == nil {
+			stats = &moveStats{}
+			bd.moves[key][pm] = stats
+		}
+		stats.games++
+		if b.Wtomove {
+			stats.score += whiteScore
+		} else {
+			stats.score += blackScore
+		}
+	}
+	return nil
+}
+
+// Reads every game from a PGN stream into the book. Games that fail to parse
+// are skipped; the first such error is returned after the stream is read.
+func (bd *Builder) AddPGN(r io.Reader) error {
+	var firstErr error
+	pr := pgn.NewReader(r)
+	for {
+		g, err := pr.Next()
+		if err == io.EOF {
+			return firstErr
+		}
+		if err == nil {
+			err = bd.AddGame(g)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+}
+
+// Returns the book's entries, sorted by key and then by descending weight.
+// Moves that never scored are left out, since they would never be picked.
+// Weights are scaled down where needed to fit in 16 bits.
+func (bd *Builder) Entries() []Entry {
+	var entries []Entry
+	for key, moves := range bd.moves {
+		start := len(entries)
+		max := 0
+		for pm, stats := range moves {
+			if stats.games < bd.MinGames || stats.score < bd.MinWeight || stats.score == 0 {
+				continue
+			}
+			entries = append(entries, Entry{Key: key, Move: pm})
+			if stats.score > max {
+				max = stats.score
+			}
+		}
+		for i := start; i < len(entries); i++ {
+			score := moves[entries[i].Move].score
+			if max > 0xffff {
+				score = score * 0xffff / max
+				if score == 0 {
+					score = 1
+				}
+			}
+			entries[i].Weight = uint16(score)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Key != entries[j].Key {
+			return entries[i].Key < entries[j].Key
+		}
+		if entries[i].Weight != entries[j].Weight {
+			return entries[i].Weight > entries[j].Weight
+		}
+		return entries[i].Move < entries[j].Move
+	})
+	return entries
+}
+
+// Writes the book in the Polyglot format.
+func (bd *Builder) Write(w io.Writer) error {
+	return WriteEntries(w, bd.Entries())
+}
@@ -0,0 +1,159 @@
+package book
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/noahklein/dragon"
+	"github.com/noahklein/dragon/pgn"
+)
+
+const games = `
+[Result "1-0"]
+1. e4 e5 2. Nf3 Nc6 3. Bb5 1-0
+
+[Result "1/2-1/2"]
+1. e4 e5 2. Nf3 Nf6 1/2-1/2
+
+[Result "0-1"]
+1. e4 c5 2. Nf3 0-1
+
+[Result "1-0"]
+1. d4 d5 2. c4 1-0
+
+[Result "1-0"]
+[FEN "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1"]
+1. O-O O-O-O 1-0
+`
+
+func TestBuilder(t *testing.T) {
+	bd := NewBuilder()
+	if err := bd.AddPGN(strings.NewReader(games)); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "book.bin")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bd.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	bk, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bk.Close()
+
+	// FEN -> expected book moves, as "move:weight"
+	positions := map[string]string{
+		// e4 scored a win and a draw for White; d4 a win
+		dragon.Startpos: "e2e4:3 d2d4:2",
+		// e5 scored a draw for Black; c5 a win
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1": "c7c5:2 e7e5:1",
+		// Nf3 was played in a win and a draw
+		"rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2": "g1f3:3",
+		// castling, stored as king-takes-rook; Black's losing move is left out
+		"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1":                     "e1g1:2",
+		"r3k2r/8/8/8/8/8/8/R4RK1 b kq - 1 1":                       "",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b KQkq - 0 1": "",
+	}
+	for fen, want := range positions {
+		b := dragon.ParseFen(fen)
+		var got []string
+		moves, err := bk.Lookup(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range moves {
+			got = append(got, m.Move.String()+":"+strconv.Itoa(m.Weight))
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("Book moves for %v: got %q, expected %q", fen, strings.Join(got, " "), want)
+		}
+	}
+	castle := dragon.ParseFen("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+	var prev Entry
+	for i := 0; i < bk.Len(); i++ {
+		e, err := bk.Entry(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Key < prev.Key {
+			t.Fatal("Book entries are not sorted")
+		}
+		if e.Key == Key(&castle) && e.Move != 4<<6|7 {
+			t.Errorf("Castling stored as %#x instead of e1h1", e.Move)
+		}
+		prev = e
+	}
+}
+
+func TestBuilderFilters(t *testing.T) {
+	bd := NewBuilder()
+	bd.MinGames = 2
+	bd.MaxPly = 2
+	if err := bd.AddPGN(strings.NewReader(games)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := bd.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	bk, _ := Read(&buf)
+	// Only 1. e4 (3 games) and 1... e5 (2 games) remain; Nf3 is beyond MaxPly.
+	if bk.Len() != 2 {
+		t.Error("Expected 2 entries, got", bk.Len())
+	}
+
+	bd = &Builder{MinWeight: 3} // the zero value is ready to use
+	g := &pgn.Game{Result: "1-0"}
+	e4, _ := dragon.ParseMove("e2e4")
+	g.Moves = []pgn.Node{{Move: e4}}
+	for i := 0; i < 2; i++ {
+		if err := bd.AddGame(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if entries := bd.Entries(); len(entries) != 1 || entries[0].Weight != 4 {
+		t.Error("Expected one entry of weight 4:", entries)
+	}
+	if err := bd.AddPGN(strings.NewReader("1. e4 e5 *\n\n1. e5 *\n")); err == nil {
+		t.Error("Expected an error for an illegal move")
+	}
+	g.Moves[0].Move, _ = dragon.ParseMove("a2e4")
+	if err := bd.AddGame(g); err == nil {
+		t.Error("Expected an error replaying an illegal move")
+	}
+}
+
+func TestBuilderNullMoves(t *testing.T) {
+	// The same game, with and without the positions that a pgn.Reader records.
+	g, err := pgn.NewReader(strings.NewReader("[Result \"1/2-1/2\"]\n1. e4 -- 2. d4 e5 1/2-1/2\n")).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := *g
+	replayed.Positions = nil
+	for _, g := range []*pgn.Game{g, &replayed} {
+		bd := NewBuilder()
+		if err := bd.AddGame(g); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		bd.Write(&buf)
+		bk, _ := Read(&buf)
+		if bk.Len() != 3 {
+			t.Errorf("Expected 3 entries, without the null move, got %d", bk.Len())
+		}
+		b := dragon.ParseFen("rnbqkbnr/pppppppp/8/8/3PP3/8/PPP2PPP/RNBQKBNR b KQkq - 0 2")
+		if moves, err := bk.Lookup(&b); err != nil || len(moves) != 1 || moves[0].Move.String() != "e7e5" {
+			t.Error("Wrong book moves after the null move:", moves, err)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+// Command dragon is a UCI chess engine built on the dragon move generator.
+// Run it from a GUI or tournament manager that speaks the Universal Chess
+// Interface protocol, such as cutechess-cli.
+package main
+
+import (
+	"log"
+	"os"
+)
+
+func main() {
+	if err := newEngine(os.Stdout).run(os.Stdin); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/noahklein/dragon"
+	"github.com/noahklein/dragon/search"
+)
+
+const (
+	engineName   = "dragon"
+	engineAuthor = "Noah Klein"
+)
+
+// The UCI protocol state machine. Commands are read from one stream, and
+// responses are written to another; searches run in the background.
+type engine struct {
+	out      io.Writer
+	outMu    sync.Mutex // guards out, which is shared with the search goroutine
+	board    dragon.Board
+	history  []uint64 // hashes of the positions leading up to board
+	searcher *search.Searcher
+	overhead time.Duration // "Move Overhead" option
+	chess960 bool          // "UCI_Chess960" option
+	job      *searchJob    // the running search, if any
+}
+
+// A background search, and the means to control it.
+type searchJob struct {
+	cancel    context.CancelFunc
+	ponderhit chan struct{} // closed by "ponderhit"
+	release   chan struct{} // closed by "stop"; an infinite search waits for it
+	done      chan struct{} // closed after "bestmove" is written
+	unbounded bool          // infinite or pondering: only "stop" ends it
+	stopOnce  sync.Once
+	hitOnce   sync.Once
+}
+
+// The limits given to a "go" command.
+type searchLimits struct {
+	depth                              int
+	nodes                              int64
+	movetime, wtime, btime, winc, binc time.Duration
+	movestogo                          int
+	infinite, ponder                   bool
+}
+
+func newEngine(out io.Writer) *engine {
+	return &engine{
+		out:      out,
+		board:    dragon.ParseFen(dragon.Startpos),
+		searcher: search.New(),
+		overhead: 10 * time.Millisecond,
+	}
+}
+
+func (e *engine) send(format string, args ...interface{}) {
+	e.outMu.Lock()
+	defer e.outMu.Unlock()
+	fmt.Fprintf(e.out, format+"\n", args...)
+}
+
+// Reads and executes commands until "quit" or the end of the input.
+// At the end of the input, a running search is allowed to finish, unless it is
+// infinite or pondering.
+func (e *engine) run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		cmd, args := fields[0], fields[1:]
+		switch cmd {
+		case "uci":
+			e.send("id name %s", engineName)
+			e.send("id author %s", engineAuthor)
+			e.send("option name Hash type spin default %d min 1 max 65536", search.DefaultHashMB)
+			e.send("option name Clear Hash type button")
+			e.send("option name Move Overhead type spin default 10 min 0 max 5000")
+			e.send("option name UCI_Chess960 type check default false")
+			e.send("uciok")
+		case "isready":
+			e.send("readyok")
+		case "ucinewgame":
+			e.stop()
+			e.board, e.history = dragon.ParseFen(dragon.Startpos), nil
+			e.searcher.Reset()
+		case "position":
+			e.stop()
+			if err := e.position(args); err != nil {
+				e.send("info string %v", err)
+			}
+		case "go":
+			e.stop()
+			e.goSearch(parseLimits(args))
+		case "stop":
+			e.stop()
+		case "ponderhit":
+			if e.job != nil {
+				e.job.hitOnce.Do(func() { close(e.job.ponderhit) })
+			}
+		case "setoption":
+			e.stop()
+			if err := e.setOption(args); err != nil {
+				e.send("info string %v", err)
+			}
+		case "quit":
+			e.stop()
+			return nil
+		case "d": // not UCI, but handy for debugging
+			e.send("%v\nFen: %s", &e.board, e.board.ToFen())
+		default:
+			e.send("info string unknown command: %s", cmd)
+		}
+	}
+	e.wait()
+	return scanner.Err()
+}
+
+// Handles "position [startpos | fen <fen>] [moves <move>...]".
+func (e *engine) position(args []string) error {
+	if len(args) == 0 {
+		return errors.New("position: missing argument")
+	}
+	var b dragon.Board
+	var rest []string
+	switch args[0] {
+	case "startpos":
+		b = dragon.ParseFen(dragon.Startpos)
+		rest = args[1:]
+	case "fen":
+		end := len(args)
+		for i, a := range args {
+			if a == "moves" {
+				end = i
+				break
+			}
+		}
+		var err error
+		if b, err = dragon.ParseFenStrict(strings.Join(args[1:end], " ")); err != nil {
+			return err
+		}
+		rest = args[end:]
+	default:
+		return fmt.Errorf("position: unknown argument %q", args[0])
+	}
+	b.Chess960 = b.Chess960 || e.chess960
+	g := dragon.NewGame(b)
+	if len(rest) > 0 && rest[0] == "moves" {
+		for _, movestr := range rest[1:] {
+			m, err := dragon.ParseMove(movestr)
+			if err != nil || g.Push(m) != nil {
+				return fmt.Errorf("position: illegal move %q", movestr)
+			}
+		}
+	}
+	e.board, e.history = g.Board, g.Hashes()
+	return nil
+}
+
+// Handles "setoption name <id> [value <x>]".
+func (e *engine) setOption(args []string) error {
+	var name, value []string
+	target := &name
+	for _, a := range args {
+		switch a {
+		case "name":
+			target = &name
+		case "value":
+			target = &value
+		default:
+			*target = append(*target, a)
+		}
+	}
+	switch strings.ToLower(strings.Join(name, " ")) {
+	case "hash":
+		mb, err := strconv.Atoi(strings.Join(value, " "))
+		if err != nil || mb < 1 {
+			return fmt.Errorf("setoption: bad Hash %q", strings.Join(value, " "))
+		}
+		e.searcher.TT = search.NewTranspositionTable(mb)
+	case "clear hash":
+		e.searcher.TT.Clear()
+	case "move overhead":
+		ms, err := strconv.Atoi(strings.Join(value, " "))
+		if err != nil || ms < 0 {
+			return fmt.Errorf("setoption: bad Move Overhead %q", strings.Join(value, " "))
+		}
+		e.overhead = time.Duration(ms) * time.Millisecond
+	case "uci_chess960":
+		on, err := strconv.ParseBool(strings.Join(value, " "))
+		if err != nil {
+			return fmt.Errorf("setoption: bad UCI_Chess960 %q", strings.Join(value, " "))
+		}
+		e.chess960 = on
+	default:
+		return fmt.Errorf("setoption: unknown option %q", strings.Join(name, " "))
+	}
+	return nil
+}
+
+func parseLimits(args []string) searchLimits {
+	var l searchLimits
+	for i := 0; i < len(args); i++ {
+		var n int64
+		if i+1 < len(args) {
+			n, _ = strconv.ParseInt(args[i+1], 10, 64)
+		}
+		ms := time.Duration(n) * time.Millisecond
+		switch args[i] {
+		case "infinite":
+			l.infinite = true
+			continue
+		case "ponder":
+			l.ponder = true
+			continue
+		case "depth":
+			l.depth = int(n)
+		case "nodes":
+			l.nodes = n
+		case "movetime":
+			l.movetime = ms
+		case "wtime":
+			l.wtime = ms
+		case "btime":
+			l.btime = ms
+		case "winc":
+			l.winc = ms
+		case "binc":
+			l.binc = ms
+		case "movestogo":
+			l.movestogo = int(n)
+		default:
+			continue
+		}
+		i++ // skip the argument's value
+	}
+	return l
+}
+
+// Computes how long to think, or zero for no time limit.
+func (e *engine) budget(l searchLimits) time.Duration {
+	if l.movetime > 0 {
+		return maxDuration(l.movetime-e.overhead, time.Millisecond)
+	}
+	remaining, inc := l.wtime, l.winc
+	if !e.board.Wtomove {
+		remaining, inc = l.btime, l.binc
+	}
+	if remaining <= 0 {
+		return 0
+	}
+	movesToGo := l.movestogo
+	if movesToGo <= 0 || movesToGo > 30 {
+		movesToGo = 30
+	}
+	alloc := remaining/time.Duration(movesToGo) + inc*3/4
+	return maxDuration(minDuration(alloc, remaining-e.overhead), time.Millisecond)
+}
+
+// Starts a background search, which writes "info" lines and a final "bestmove".
+func (e *engine) goSearch(l searchLimits) {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &searchJob{
+		cancel:    cancel,
+		ponderhit: make(chan struct{}),
+		release:   make(chan struct{}),
+		done:      make(chan struct{}),
+		unbounded: l.infinite || l.ponder,
+	}
+	e.job = job
+	budget := e.budget(l)
+	board := e.board
+	s := e.searcher
+	s.History = e.history
+
+	// Time control. While pondering, the clock starts at "ponderhit".
+	if !l.infinite {
+		go func() {
+			if l.ponder {
+				select {
+				case <-job.ponderhit:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if budget > 0 {
+				select {
+				case <-time.After(budget):
+					cancel()
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(job.done)
+		defer cancel()
+		start := time.Now()
+		s.Info = func(r search.Result) {
+			elapsed := time.Since(start)
+			nps := int64(float64(r.Nodes) / (elapsed.Seconds() + 1e-9))
+			e.send("info depth %d score %v nodes %d nps %d hashfull %d time %d pv %s",
+				r.Depth, r.Score, r.Nodes, nps, s.TT.Hashfull(), elapsed.Milliseconds(), formatPV(r.PV))
+		}
+		best := s.Search(ctx, board, search.Limits{Depth: l.depth, Nodes: l.nodes}).Move
+		// The GUI must not receive a bestmove for an infinite or pondering
+		// search until it says "stop" (or "ponderhit", when pondering).
+		if l.infinite {
+			<-job.release
+		} else if l.ponder {
+			select {
+			case <-job.release:
+			case <-job.ponderhit:
+			}
+		}
+		e.send("bestmove %v", &best)
+	}()
+}
+
+// Stops the running search, if any, and waits for its "bestmove".
+func (e *engine) stop() {
+	if e.job == nil {
+		return
+	}
+	e.job.stopOnce.Do(func() { close(e.job.release) })
+	e.job.cancel()
+	e.wait()
+}
+
+// Waits for the running search, if any, to finish on its own.
+// Infinite searches are stopped, since nothing else could end them.
+func (e *engine) wait() {
+	if e.job == nil {
+		return
+	}
+	e.job.stopOnce.Do(func() { close(e.job.release) })
+	if e.job.unbounded {
+		e.job.cancel()
+	}
+	<-e.job.done
+	e.job = nil
+}
+
+func formatPV(pv []dragon.Move) string {
+	strs := make([]string, len(pv))
+	for i := range pv {
+		strs[i] = pv[i].String()
+	}
+	return strings.Join(strs, " ")
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noahklein/dragon"
+)
+
+// Runs a script of UCI commands, returning the engine's output lines.
+func runScript(t *testing.T, script string) []string {
+	var out bytes.Buffer
+	e := newEngine(&out)
+	if err := e.run(strings.NewReader(script)); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(out.String()), "\n")
+}
+
+func lastLine(lines []string) string {
+	return lines[len(lines)-1]
+}
+
+func TestHandshake(t *testing.T) {
+	lines := runScript(t, "uci\nisready\nquit\n")
+	if lines[0] != "id name dragon" || lines[len(lines)-2] != "uciok" || lastLine(lines) != "readyok" {
+		t.Error("Bad handshake:", lines)
+	}
+}
+
+func TestPositionAndGo(t *testing.T) {
+	scripts := map[string]string{
+		// mate in one
+		"position fen 6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1\ngo depth 3\n": "bestmove a1a8",
+		// win the queen
+		"position fen 4k3/8/8/3q4/8/8/8/3RK3 w - - 0 1\ngo depth 2\n": "bestmove d1d5",
+		// only one legal move
+		"position fen 7k/8/8/8/8/8/r7/7K w - - 0 1\ngo nodes 10\n": "bestmove h1g1",
+		// a timed search, and the debugging display
+		"ucinewgame\nposition startpos moves e2e4\ngo movetime 50\nd\n": "",
+	}
+	for script, want := range scripts {
+		lines := runScript(t, script)
+		found := false
+		for _, line := range lines {
+			if strings.HasPrefix(line, "bestmove") {
+				found = want == "" || line == want
+			}
+		}
+		if !found {
+			t.Error("Script\n", script, "expected", want, "but got\n", strings.Join(lines, "\n"))
+		}
+	}
+}
+
+func TestMateScore(t *testing.T) {
+	lines := runScript(t, "position fen 6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1\ngo depth 2\n")
+	if !strings.Contains(strings.Join(lines, "\n"), "score mate 1") {
+		t.Error("Expected a mate score:", lines)
+	}
+	lines = runScript(t, "position fen 8/8/8/8/8/1qk5/7P/K7 w - - 0 1\ngo depth 3\n")
+	if !strings.Contains(strings.Join(lines, "\n"), "score mate -1") {
+		t.Error("Expected a negative mate score:", lines)
+	}
+}
+
+func TestInfiniteAndStop(t *testing.T) {
+	var out bytes.Buffer
+	e := newEngine(&out)
+	r, w := newPipe()
+	done := make(chan struct{})
+	go func() {
+		e.run(r)
+		close(done)
+	}()
+	w.write("go infinite\n")
+	time.Sleep(50 * time.Millisecond)
+	e.outMu.Lock()
+	early := strings.Contains(out.String(), "bestmove")
+	e.outMu.Unlock()
+	if early {
+		t.Error("Infinite search sent bestmove before stop")
+	}
+	w.write("stop\nisready\n")
+	w.close()
+	<-done
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if !strings.HasPrefix(lines[len(lines)-2], "bestmove") || lastLine(lines) != "readyok" {
+		t.Error("Expected bestmove after stop:", lines)
+	}
+}
+
+func TestPonder(t *testing.T) {
+	var out bytes.Buffer
+	e := newEngine(&out)
+	r, w := newPipe()
+	done := make(chan struct{})
+	go func() {
+		e.run(r)
+		close(done)
+	}()
+	w.write("position startpos moves e2e4\ngo ponder wtime 1000 btime 1000\n")
+	time.Sleep(50 * time.Millisecond)
+	w.write("ponderhit\n")
+	time.Sleep(200 * time.Millisecond) // the budget is about 1000/30ms
+	e.outMu.Lock()
+	found := strings.Contains(out.String(), "bestmove")
+	e.outMu.Unlock()
+	if !found {
+		t.Error("Expected bestmove after ponderhit and time expiry:", out.String())
+	}
+	w.close()
+	<-done
+}
+
+func TestHashOptions(t *testing.T) {
+	lines := runScript(t, "setoption name Hash value 1\nsetoption name Clear Hash\nposition startpos\ngo depth 3\n")
+	if !strings.Contains(strings.Join(lines, "\n"), "hashfull") || !strings.HasPrefix(lastLine(lines), "bestmove") {
+		t.Error("Expected hashfull in the search info:", lines)
+	}
+}
+
+func TestChess960(t *testing.T) {
+	lines := runScript(t, "setoption name UCI_Chess960 value true\nposition startpos moves e2e4 e7e5 g1f3 b8c6 f1c4 g8f6 e1h1\nd\n")
+	if !strings.Contains(lastLine(lines), "RNBQ1RK1 b kq") {
+		t.Error("Expected castling as king takes rook:", lines)
+	}
+	lines = runScript(t, "position fen 1r2k1r1/8/8/8/8/8/8/1R2K1R1 w GBgb - 0 1 moves e1b1\nd\n")
+	if !strings.Contains(lastLine(lines), "2KR2R1 b kq") {
+		t.Error("Expected a Shredder-FEN position to castle:", lines)
+	}
+}
+
+func TestBadCommands(t *testing.T) {
+	lines := runScript(t, "position fen 8/8/8/8/8/8/8/8 w - - 0 1\nposition startpos moves e2e5\nsetoption name Nonsense value 3\nsetoption name Move Overhead value 50\nsetoption name Hash value 0\nfoo\n")
+	if len(lines) != 5 {
+		t.Error("Expected an error message per bad command:", lines)
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "info string") {
+			t.Error("Expected an info string:", line)
+		}
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	l := parseLimits(strings.Fields("wtime 1000 btime 2000 winc 10 binc 20 movestogo 5 depth 7 nodes 99 infinite"))
+	if l.wtime != time.Second || l.btime != 2*time.Second || l.winc != 10*time.Millisecond ||
+		l.binc != 20*time.Millisecond || l.movestogo != 5 || l.depth != 7 || l.nodes != 99 || !l.infinite {
+		t.Error("Limits parsed incorrectly:", l)
+	}
+	e := newEngine(&bytes.Buffer{})
+	e.board = dragon.ParseFen(dragon.Startpos)
+	if b := e.budget(l); b != 200*time.Millisecond+7500*time.Microsecond {
+		t.Error("Wrong time budget:", b)
+	}
+}
+
+// A minimal line-oriented pipe for feeding commands to a running engine.
+type pipe struct {
+	lines chan string
+	buf   []byte
+}
+
+type pipeWriter struct{ p *pipe }
+
+func newPipe() (*pipe, pipeWriter) {
+	p := &pipe{lines: make(chan string, 16)}
+	return p, pipeWriter{p}
+}
+
+func (p *pipe) Read(b []byte) (int, error) {
+	if len(p.buf) == 0 {
+		line, ok := <-p.lines
+		if !ok {
+			return 0, io.EOF
+		}
+		p.buf = []byte(line)
+	}
+	n := copy(b, p.buf)
+	p.buf = p.buf[n:]
+	return n, nil
+}
+
+func (w pipeWriter) write(s string) { w.p.lines <- s }
+func (w pipeWriter) close()         { close(w.p.lines) }
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/noahklein/dragon"
+)
+
+// Reference divides, keyed by position and depth.
+type reference map[divideKey]map[string]int64
+
+// A position, by the first four fields of its FEN (so that move counters are
+// ignored), and a perft depth.
+type divideKey struct {
+	fen   string
+	depth int
+}
+
+func keyOf(b *dragon.Board, depth int) divideKey {
+	return divideKey{strings.Join(strings.Fields(b.ToFen())[:4], " "), depth}
+}
+
+var divideLine = regexp.MustCompile(`^([a-h][1-8][a-h][1-8][qrbn]?)\s*[:=]?\s*(\d+)$`)
+
+// Reads reference divides from a UCI engine session, eg:
+//
+//	position fen 8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1 moves b4b1
+//	go perft 2
+//	c7c6: 15
+//	...
+//
+// "position startpos" is also accepted. Other lines are ignored.
+func parseReference(r io.Reader) (reference, error) {
+	ref := make(reference)
+	b := dragon.ParseFen(dragon.Startpos)
+	var counts map[string]int64
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(text)
+		switch {
+		case len(fields) >= 2 && fields[0] == "position":
+			var err error
+			if b, err = parsePosition(fields[1:]); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			counts = nil
+		case len(fields) == 3 && fields[0] == "go" && fields[1] == "perft":
+			depth, err := strconv.Atoi(fields[2])
+			if err != nil || depth < 1 {
+				return nil, fmt.Errorf("line %d: bad depth %q", line, fields[2])
+			}
+			counts = make(map[string]int64)
+			ref[keyOf(&b, depth)] = counts
+		default:
+			if m := divideLine.FindStringSubmatch(text); m != nil && counts != nil {
+				count, _ := strconv.ParseInt(m[2], 10, 64)
+				counts[m[1]] = count
+			}
+		}
+	}
+	return ref, scanner.Err()
+}
+
+// Parses the arguments of a UCI "position" command.
+func parsePosition(args []string) (dragon.Board, error) {
+	var fen string
+	switch args[0] {
+	case "startpos":
+		fen, args = dragon.Startpos, args[1:]
+	case "fen":
+		end := 1
+		for end < len(args) && args[end] != "moves" {
+			end++
+		}
+		fen, args = strings.Join(args[1:end], " "), args[end:]
+	default:
+		return dragon.Board{}, fmt.Errorf("bad position %q", args[0])
+	}
+	b, err := dragon.ParseFenStrict(fen)
+	if err != nil {
+		return b, err
+	}
+	if len(args) > 0 && args[0] == "moves" {
+		for _, text := range args[1:] {
+			m, err := dragon.ParseMove(text)
+			if err != nil {
+				return b, fmt.Errorf("bad move %q: %w", text, err)
+			}
+			if _, err := b.ApplySafe(m); err != nil {
+				return b, err
+			}
+		}
+	}
+	return b, nil
+}
+
+// Where the move generator first disagrees with a reference.
+type divergence struct {
+	path  []step // the moves from the root to the position
+	fen   string
+	depth int
+	move  string // a move that only one side generated, or "" if there's none
+	extra bool   // move was generated, but isn't in the reference
+	noRef bool   // the reference has no divide for the position
+}
+
+// A move whose perft counts differ.
+type step struct {
+	move      string
+	got, want int64
+}
+
+// Follows the first move whose perft count differs from the reference down
+// the tree, to the position where the move generators disagree about the
+// legal moves themselves, or as far as the reference has divides. If depth is
+// 0, the deepest reference divide for the root is used.
+func findDivergence(b *dragon.Board, depth int, ref reference) divergence {
+	if depth <= 0 {
+		for key := range ref {
+			if key.fen == keyOf(b, 0).fen && key.depth > depth {
+				depth = key.depth
+			}
+		}
+	}
+	d := divergence{}
+	for {
+		d.fen, d.depth = b.ToFen(), depth
+		want, ok := ref[keyOf(b, depth)]
+		if depth < 1 || !ok {
+			d.noRef = true
+			return d
+		}
+		got := make(map[string]int64)
+		byName := make(map[string]dragon.Move)
+		for move, count := range dragon.Divide(b, depth) {
+			got[move.String()] = count
+			byName[move.String()] = move
+		}
+		moves := make([]string, 0, len(got)+len(want))
+		for move := range got {
+			moves = append(moves, move)
+		}
+		for move := range want {
+			if _, ok := got[move]; !ok {
+				moves = append(moves, move)
+			}
+		}
+		sort.Strings(moves)
+		differs := false
+		for _, move := range moves {
+			g, generated := got[move]
+			w, expected := want[move]
+			if !generated || !expected {
+				d.move, d.extra = move, generated
+				return d
+			}
+			if g != w {
+				b.Apply(byName[move])
+				d.path = append(d.path, step{move, g, w})
+				differs = true
+				break
+			}
+		}
+		if !differs {
+			return d
+		}
+		depth--
+	}
+}
+
+// Writes a divergence, and returns whether the generators agreed.
+func (r *runner) report(d divergence) bool {
+	for i, s := range d.path {
+		fmt.Fprintf(r.out, "%s%s: got %d, expected %d\n", strings.Repeat("  ", i), s.move, s.got, s.want)
+	}
+	switch {
+	case d.noRef:
+		fmt.Fprintf(r.out, "no reference divide for %s at depth %d; to continue, add the output of:\nposition fen %s\ngo perft %d\n",
+			d.fen, d.depth, d.fen, d.depth)
+	case d.extra:
+		fmt.Fprintf(r.out, "illegal move %s generated in %s\n", d.move, d.fen)
+	case d.move != "":
+		fmt.Fprintf(r.out, "legal move %s not generated in %s\n", d.move, d.fen)
+	default:
+		fmt.Fprintf(r.out, "all counts match at depth %d in %s\n", d.depth, d.fen)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+// Command perft validates the dragon move generator against perft results.
+//
+// Given an EPD perft suite, it counts the leaves of each position's perft tree
+// to the listed depths, and reports any that differ:
+//
+//	perft -depth 6 -timeout 5m -hash 256 perftsuite.epd
+//
+// Each line of a suite holds a FEN followed by the expected counts, eg:
+//
+//	rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1 ;D1 20 ;D2 400 ;D3 8902
+//
+// Given a reference divide file, it instead finds where the move generator
+// first disagrees with another, following the first move whose count differs
+// down the perft tree for as long as the file has divides for the positions
+// reached:
+//
+//	perft -fen "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1" -depth 4 -divide stockfish.txt
+//
+// The divide file is in the format of a UCI engine session running perft, such
+// as Stockfish's: "position" commands name positions, "go perft" commands
+// give depths, and "move: count" lines follow. Other lines are ignored.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/noahklein/dragon"
+)
+
+var (
+	maxDepth = flag.Int("depth", 0, "the deepest perft to run from a suite, or the depth to divide (default: all)")
+	timeout  = flag.Duration("timeout", time.Minute, "the time allowed for each position of a suite")
+	workers  = flag.Int("workers", 0, "the number of goroutines counting in parallel (default: one per CPU)")
+	hashMB   = flag.Int("hash", 64, "the size of the perft hash table in megabytes, or 0 for none")
+	fen      = flag.String("fen", dragon.Startpos, "the position to divide")
+	divide   = flag.String("divide", "", "a reference divide file to compare with")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: perft [flags] suite.epd\n       perft [flags] -divide reference.txt")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	r := &runner{out: os.Stdout, maxDepth: *maxDepth, timeout: *timeout, workers: *workers}
+	if *hashMB > 0 {
+		r.table = dragon.NewPerftTable(*hashMB)
+	}
+
+	if *divide != "" {
+		f, err := os.Open(*divide)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ref, err := parseReference(f)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		b, err := dragon.ParseFenStrict(*fen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !r.report(findDivergence(&b, r.maxDepth, ref)) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	suite, err := parseSuite(f)
+	f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !r.runSuite(suite) {
+		os.Exit(1)
+	}
+}
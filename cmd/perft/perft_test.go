@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noahklein/dragon"
+)
+
+func TestParseSuite(t *testing.T) {
+	input := `# the start position and Kiwipete
+rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1 ;D1 20 ;D2 400 ;D3 8902
+
+r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - ;D1 48 ;D2 2039
+`
+	suite, err := parseSuite(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suite) != 2 || suite[0].line != 2 || suite[1].line != 4 {
+		t.Fatalf("Wrong suite entries: %+v", suite)
+	}
+	if suite[0].counts[3] != 8902 || len(suite[0].counts) != 3 || suite[1].counts[2] != 2039 {
+		t.Errorf("Wrong suite counts: %+v", suite)
+	}
+	for _, bad := range []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1 ;D1 twenty",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1 ;P1 20",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1 ;D1 20",
+	} {
+		if _, err := parseSuite(strings.NewReader(bad)); err == nil {
+			t.Error("Expected an error for", bad)
+		}
+	}
+}
+
+func TestRunSuite(t *testing.T) {
+	suite := []suiteEntry{
+		{1, dragon.Startpos, map[int]int64{1: 20, 2: 400, 3: 8902}},
+		{2, "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", map[int]int64{1: 14, 2: 190, 3: 2812}},
+	}
+	var out bytes.Buffer
+	r := &runner{out: &out, timeout: time.Minute, workers: 2, table: dragon.NewPerftTable(1)}
+	if r.runSuite(suite) {
+		t.Error("A wrong count passed")
+	}
+	for _, want := range []string{"line 1: ok", "line 2: FAIL at D2: got 191, expected 190", "2 positions: 1 passed, 1 failed"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the report:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	r = &runner{out: &out, maxDepth: 1, timeout: time.Minute}
+	if !r.runSuite(suite) {
+		t.Error("Counts to depth 1 should pass:\n", out.String())
+	}
+
+	out.Reset()
+	r = &runner{out: &out, timeout: time.Nanosecond}
+	suite = []suiteEntry{{1, dragon.Startpos, map[int]int64{6: 119060324}}}
+	if !r.runSuite(suite) || !strings.Contains(out.String(), "TIMEOUT at D6") {
+		t.Error("Expected a timeout, and no failure:\n", out.String())
+	}
+}
+
+// Writes a divide, as a reference engine would.
+func writeDivide(w *bytes.Buffer, position string, depth int, counts map[string]int64) {
+	fmt.Fprintf(w, "position %s\ngo perft %d\n", position, depth)
+	for move, count := range counts {
+		fmt.Fprintf(w, "%s: %d\n", move, count)
+	}
+	fmt.Fprintf(w, "\nNodes searched: ...\n\n")
+}
+
+// Divides a position, with moves as strings.
+func divideOf(t *testing.T, position string, depth int) map[string]int64 {
+	b, err := parsePosition(strings.Fields(position))
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int64)
+	for move, count := range dragon.Divide(&b, depth) {
+		counts[move.String()] = count
+	}
+	return counts
+}
+
+func TestFindDivergence(t *testing.T) {
+	// A reference that disagrees with us about one legal move, three plies deep:
+	// as if we generated an illegal move that the reference doesn't.
+	var ref bytes.Buffer
+	root := divideOf(t, "startpos", 3)
+	root["e2e4"]--
+	writeDivide(&ref, "startpos", 3, root)
+	child := divideOf(t, "startpos moves e2e4", 2)
+	child["d7d5"]--
+	writeDivide(&ref, "startpos moves e2e4", 2, child)
+	grandchild := divideOf(t, "startpos moves e2e4 d7d5", 1)
+	delete(grandchild, "e4d5")
+	writeDivide(&ref, "startpos moves e2e4 d7d5", 1, grandchild)
+	writeDivide(&ref, "startpos", 2, divideOf(t, "startpos", 2))
+
+	parsed, err := parseReference(&ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := dragon.ParseFen(dragon.Startpos)
+	d := findDivergence(&b, 0, parsed)
+	want := "rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2"
+	if d.fen != want || d.move != "e4d5" || !d.extra || len(d.path) != 2 || d.path[1].move != "d7d5" {
+		t.Errorf("Wrong divergence: %+v", d)
+	}
+	var out bytes.Buffer
+	if (&runner{out: &out}).report(d) || !strings.Contains(out.String(), "illegal move e4d5 generated in "+want) {
+		t.Error("Wrong report:\n", out.String())
+	}
+
+	// The reference agrees at depth 2.
+	b = dragon.ParseFen(dragon.Startpos)
+	if d := findDivergence(&b, 2, parsed); d.move != "" || d.noRef || len(d.path) != 0 {
+		t.Errorf("Expected no divergence at depth 2, got %+v", d)
+	}
+
+	// Without a divide for the grandchild, the search stops at the child.
+	var partial bytes.Buffer
+	writeDivide(&partial, "startpos", 3, root)
+	writeDivide(&partial, "startpos moves e2e4", 2, child)
+	parsed, _ = parseReference(&partial)
+	b = dragon.ParseFen(dragon.Startpos)
+	if d := findDivergence(&b, 3, parsed); !d.noRef || d.depth != 1 || len(d.path) != 2 {
+		t.Errorf("Expected a missing reference divide, got %+v", d)
+	}
+
+	for _, bad := range []string{"startpos moves e2e4 e7e4", "startpos moves e2e4 x"} {
+		_, err := parseReference(strings.NewReader("go perft 1\nposition " + bad + "\ngo perft 1\n"))
+		move := bad[strings.LastIndex(bad, " ")+1:]
+		if err == nil || !strings.Contains(err.Error(), "line 2") || !strings.Contains(err.Error(), move) {
+			t.Errorf("Expected an error naming line 2 and move %s, got %v", move, err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/noahklein/dragon"
+)
+
+// A position from an EPD perft suite, and its expected perft counts.
+type suiteEntry struct {
+	line   int
+	fen    string
+	counts map[int]int64 // by depth
+}
+
+// Reads an EPD perft suite: one position per line, with a FEN and then
+// ";D<depth> <count>" fields. Blank lines and lines starting with # are skipped.
+func parseSuite(r io.Reader) ([]suiteEntry, error) {
+	var suite []suiteEntry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ";")
+		entry := suiteEntry{line: line, fen: strings.TrimSpace(fields[0]), counts: make(map[int]int64)}
+		if _, err := dragon.ParseFenStrict(entry.fen); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		for _, field := range fields[1:] {
+			var depth int
+			var count int64
+			if _, err := fmt.Sscanf(strings.TrimSpace(field), "D%d %d", &depth, &count); err != nil || depth < 1 {
+				return nil, fmt.Errorf("line %d: bad perft count %q", line, strings.TrimSpace(field))
+			}
+			entry.counts[depth] = count
+		}
+		suite = append(suite, entry)
+	}
+	return suite, scanner.Err()
+}
+
+// Runs perft suites and divides, writing a report.
+type runner struct {
+	out      io.Writer
+	maxDepth int           // the deepest perft to run; 0 for no limit
+	timeout  time.Duration // for each position
+	workers  int
+	table    *dragon.PerftTable // or nil
+}
+
+// Runs each position's perfts, shallowest first, until one differs from the
+// expected count or the position's time runs out. Returns whether no count
+// differed; timeouts are reported, but are not failures.
+func (r *runner) runSuite(suite []suiteEntry) bool {
+	passed, failed, timedOut := 0, 0, 0
+	start := time.Now()
+	for _, entry := range suite {
+		depths := make([]int, 0, len(entry.counts))
+		for depth := range entry.counts {
+			if r.maxDepth <= 0 || depth <= r.maxDepth {
+				depths = append(depths, depth)
+			}
+		}
+		sort.Ints(depths)
+		b := dragon.ParseFen(entry.fen)
+		ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+		posStart := time.Now()
+		status := "ok"
+		for _, depth := range depths {
+			var got int64
+			var err error
+			if r.table != nil {
+				got, err = r.table.PerftParallelContext(ctx, &b, depth, r.workers)
+			} else {
+				got, err = dragon.PerftParallelContext(ctx, &b, depth, r.workers)
+			}
+			if err != nil {
+				status = fmt.Sprintf("TIMEOUT at D%d", depth)
+				timedOut++
+				break
+			}
+			if want := entry.counts[depth]; got != want {
+				status = fmt.Sprintf("FAIL at D%d: got %d, expected %d", depth, got, want)
+				failed++
+				break
+			}
+		}
+		cancel()
+		if status == "ok" {
+			passed++
+		}
+		fmt.Fprintf(r.out, "line %d: %s (%v) %s\n", entry.line, status, time.Since(posStart).Round(time.Millisecond), entry.fen)
+	}
+	fmt.Fprintf(r.out, "%d positions: %d passed, %d failed, %d timed out in %v\n",
+		len(suite), passed, failed, timedOut, time.Since(start).Round(time.Millisecond))
+	return failed == 0
+}
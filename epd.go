@@ -0,0 +1,309 @@
+package dragon
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Errors reported by ParseEPD, wrapped together with the offending text.
+// Errors in the position are reported as by ParseFenStrict.
+var (
+	ErrEPDSyntax  = errors.New("malformed EPD operation")
+	ErrEPDOperand = errors.New("invalid EPD operand")
+)
+
+// An Extended Position Description record: a position, and operations that
+// describe it, as used by test suites such as WAC and STS.
+// The common opcodes have fields of their own; others are kept in Other.
+type EPD struct {
+	Board            Board      // the move counters come from the hmvc and fmvn operations, if present
+	ID               string     // id
+	BestMoves        []Move     // bm
+	AvoidMoves       []Move     // am
+	PV               []Move     // pv: the predicted variation, from Board
+	CentipawnEval    int        // ce, if HasCentipawnEval
+	HasCentipawnEval bool       // whether there is a ce operation
+	Depth            int        // acd: the depth the position was analysed to, or 0
+	Comments         [10]string // c0 to c9
+	Other            []EPDOperation
+}
+
+// An EPD operation without a field of its own in EPD.
+type EPDOperation struct {
+	Opcode   string
+	Operands []string
+}
+
+// Parses an EPD record: the first four fields of a FEN, then operations of an
+// opcode and operands, each ending with a semicolon, eg:
+//
+//	r1bqkb1r/pppp1ppp/2n2n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - bm Qxf7#; id "scholar";
+//
+// Moves are given in SAN, as the standard requires, but pure coordinate
+// notation is accepted too.
+func ParseEPD(epd string) (*EPD, error) {
+	fields := strings.Fields(epd)
+	if len(fields) < 4 {
+		return nil, &FenError{Fen: epd, Err: ErrFenFieldCount, Detail: strconv.Itoa(len(fields))}
+	}
+	b, err := ParseFenStrict(strings.Join(fields[:4], " "))
+	if err != nil {
+		return nil, err
+	}
+	e := &EPD{Board: b}
+
+	// Skip the position, then read operations.
+	rest := epd
+	for i := 0; i < 4; i++ {
+		rest = strings.TrimLeft(rest, " \t")
+		if end := strings.IndexAny(rest, " \t"); end >= 0 {
+			rest = rest[end:]
+		} else {
+			rest = ""
+		}
+	}
+	for rest = strings.TrimSpace(rest); rest != ""; {
+		var opcode string
+		var operands []string
+		opcode, operands, rest, err = nextEPDOperation(rest)
+		if err != nil {
+			return nil, err
+		}
+		if err := e.setOperation(opcode, operands); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// Splits the first operation off a string of operations.
+func nextEPDOperation(s string) (opcode string, operands []string, rest string, err error) {
+	end := strings.IndexAny(s, " \t;")
+	if end < 0 {
+		end = len(s)
+	}
+	opcode, s = s[:end], s[end:]
+	if !isEPDOpcode(opcode) {
+		return "", nil, "", fmt.Errorf("%w: %q", ErrEPDSyntax, opcode)
+	}
+	for {
+		s = strings.TrimLeft(s, " \t")
+		switch {
+		case s == "": // tolerate a missing final semicolon
+			return opcode, operands, "", nil
+		case s[0] == ';':
+			return opcode, operands, strings.TrimSpace(s[1:]), nil
+		case s[0] == '"':
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				return "", nil, "", fmt.Errorf("%w: unterminated string in %q", ErrEPDSyntax, opcode)
+			}
+			operands, s = append(operands, s[1:end+1]), s[end+2:]
+		default:
+			end := strings.IndexAny(s, " \t;")
+			if end < 0 {
+				end = len(s)
+			}
+			operands, s = append(operands, s[:end]), s[end:]
+		}
+	}
+}
+
+// An opcode starts with a letter, and holds up to 14 letters, digits and
+// underscores.
+func isEPDOpcode(s string) bool {
+	if s == "" || len(s) > 14 || !(s[0] >= 'a' && s[0] <= 'z' || s[0] >= 'A' && s[0] <= 'Z') {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *EPD) setOperation(opcode string, operands []string) error {
+	bad := func() error {
+		return fmt.Errorf("%w: %s %q", ErrEPDOperand, opcode, strings.Join(operands, " "))
+	}
+	var err error
+	switch opcode {
+	case "id":
+		if len(operands) != 1 {
+			return bad()
+		}
+		e.ID = operands[0]
+	case "bm", "am":
+		moves := make([]Move, len(operands))
+		for i, operand := range operands {
+			if moves[i], err = e.Board.parseEPDMove(operand); err != nil {
+				return fmt.Errorf("%s: %w", opcode, err)
+			}
+		}
+		if opcode == "bm" {
+			e.BestMoves = moves
+		} else {
+			e.AvoidMoves = moves
+		}
+	case "pv":
+		b := e.Board
+		e.PV = make([]Move, len(operands))
+		for i, operand := range operands {
+			if e.PV[i], err = b.parseEPDMove(operand); err != nil {
+				return fmt.Errorf("%s: %w", opcode, err)
+			}
+			b.Apply(e.PV[i])
+		}
+	case "ce":
+		if len(operands) != 1 {
+			return bad()
+		}
+		if e.CentipawnEval, err = strconv.Atoi(operands[0]); err != nil {
+			return bad()
+		}
+		e.HasCentipawnEval = true
+	case "acd":
+		if len(operands) != 1 {
+			return bad()
+		}
+		if e.Depth, err = strconv.Atoi(operands[0]); err != nil || e.Depth < 0 {
+			return bad()
+		}
+	case "c0", "c1", "c2", "c3", "c4", "c5", "c6", "c7", "c8", "c9":
+		if len(operands) != 1 {
+			return bad()
+		}
+		e.Comments[opcode[1]-'0'] = operands[0]
+	default:
+		if opcode == "hmvc" || opcode == "fmvn" {
+			if len(operands) != 1 {
+				return bad()
+			}
+			bitSize := 16
+			if opcode == "hmvc" {
+				bitSize = 8
+			}
+			n, err := strconv.ParseUint(operands[0], 10, bitSize)
+			if err != nil {
+				return bad()
+			}
+			if opcode == "hmvc" {
+				e.Board.Halfmoveclock = uint8(n)
+			} else {
+				e.Board.Fullmoveno = uint16(n)
+			}
+		}
+		e.Other = append(e.Other, EPDOperation{opcode, operands})
+	}
+	return nil
+}
+
+// Parses a legal move in SAN, or else in coordinate notation.
+func (b *Board) parseEPDMove(s string) (Move, error) {
+	m, sanErr := b.ParseSAN(s)
+	if sanErr == nil {
+		return m, nil
+	}
+	if m, err := ParseMove(s); err == nil && b.IsLegal(m) {
+		return m, nil
+	}
+	return 0, sanErr
+}
+
+// Writes the record in EPD form, with the common opcodes first, in a fixed
+// order, and then the others in order. Moves are written in SAN.
+func (e *EPD) String() string {
+	var s strings.Builder
+	s.WriteString(strings.Join(strings.Fields(e.Board.ToFen())[:4], " "))
+	op := func(opcode string, operands ...string) {
+		s.WriteString(" " + opcode)
+		for _, operand := range operands {
+			s.WriteString(" " + operand)
+		}
+		s.WriteString(";")
+	}
+	sans := func(b Board, moves []Move, advance bool) []string {
+		out := make([]string, len(moves))
+		for i, m := range moves {
+			out[i] = b.MoveToSAN(m)
+			if advance {
+				b.Apply(m)
+			}
+		}
+		return out
+	}
+	if len(e.BestMoves) > 0 {
+		op("bm", sans(e.Board, e.BestMoves, false)...)
+	}
+	if len(e.AvoidMoves) > 0 {
+		op("am", sans(e.Board, e.AvoidMoves, false)...)
+	}
+	if e.HasCentipawnEval {
+		op("ce", strconv.Itoa(e.CentipawnEval))
+	}
+	if e.Depth > 0 {
+		op("acd", strconv.Itoa(e.Depth))
+	}
+	if len(e.PV) > 0 {
+		op("pv", sans(e.Board, e.PV, true)...)
+	}
+	if e.ID != "" {
+		op("id", `"`+e.ID+`"`)
+	}
+	for i, c := range e.Comments {
+		if c != "" {
+			op("c"+strconv.Itoa(i), `"`+c+`"`)
+		}
+	}
+	for _, o := range e.Other {
+		operands := make([]string, len(o.Operands))
+		for i, operand := range o.Operands {
+			operands[i] = operand
+			if operand == "" || strings.ContainsAny(operand, " \t;\"") {
+				operands[i] = `"` + operand + `"`
+			}
+		}
+		op(o.Opcode, operands...)
+	}
+	return s.String()
+}
+
+// Reads EPD records, one per line, from a stream.
+type EPDReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// Creates an EPDReader that streams records from r.
+func NewEPDReader(r io.Reader) *EPDReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	return &EPDReader{scanner: scanner}
+}
+
+// Reads the next record from the stream, skipping blank lines. Returns io.EOF
+// when no records remain. A malformed record returns an error naming its line;
+// the EPDReader remains usable, so callers may skip it and continue.
+func (r *EPDReader) Next() (*EPD, error) {
+	for r.scanner.Scan() {
+		r.line++
+		text := strings.TrimSpace(r.scanner.Text())
+		if text == "" {
+			continue
+		}
+		e, err := ParseEPD(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		return e, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
@@ -0,0 +1,130 @@
+package dragon
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEPD(t *testing.T) {
+	e, err := ParseEPD(`2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - bm Qg6; id "WAC.001";`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != "WAC.001" || len(e.BestMoves) != 1 || e.BestMoves[0] != parseMove("g3g6") {
+		t.Errorf("Wrong WAC.001: %+v", e)
+	}
+
+	e, err = ParseEPD(`1k1r4/pp1b1R2/3q2pp/4p3/2B5/4Q3/PPP2B2/2K5 b - - bm Qd1+; id "BK.01";`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != "BK.01" || len(e.BestMoves) != 1 || e.BestMoves[0] != parseMove("d6d1") || e.Board.Wtomove {
+		t.Errorf("Wrong BK.01: %+v", e)
+	}
+
+	e, err = ParseEPD(`rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - am f3 g4 ;bm e4 d2d4; ce -15; ` +
+		`acd 12; pv e4 e5 Nf3; c0 "a comment; with a semicolon"; c7 "x"; hmvc 3; fmvn 9; sv Nc3 "two words";`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &EPD{
+		Board:            e.Board,
+		BestMoves:        []Move{parseMove("e2e4"), parseMove("d2d4")},
+		AvoidMoves:       []Move{parseMove("f2f3"), parseMove("g2g4")},
+		PV:               []Move{parseMove("e2e4"), parseMove("e7e5"), parseMove("g1f3")},
+		CentipawnEval:    -15,
+		HasCentipawnEval: true,
+		Depth:            12,
+		Other: []EPDOperation{
+			{"hmvc", []string{"3"}},
+			{"fmvn", []string{"9"}},
+			{"sv", []string{"Nc3", "two words"}},
+		},
+	}
+	want.Comments[0], want.Comments[7] = "a comment; with a semicolon", "x"
+	if !reflect.DeepEqual(e, want) {
+		t.Errorf("Wrong EPD:\n%+v\nexpected\n%+v", e, want)
+	}
+	if e.Board.Halfmoveclock != 3 || e.Board.Fullmoveno != 9 {
+		t.Error("Move counters not set from hmvc and fmvn:", e.Board.ToFen())
+	}
+
+	// A position without operations, and one with a missing final semicolon.
+	for _, s := range []string{"8/8/8/8/8/8/8/k1K5 w - -", "8/8/8/8/8/8/8/k1K5 w - - id \"bare\""} {
+		if _, err := ParseEPD(s); err != nil {
+			t.Error("Failed to parse", s, ":", err)
+		}
+	}
+}
+
+func TestParseEPDErrors(t *testing.T) {
+	cases := map[string]error{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - bm e5;":       ErrSANIllegal,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - pv e4 e4;":    ErrSANIllegal,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - ce high;":     ErrEPDOperand,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - acd 1 2;":     ErrEPDOperand,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - hmvc 300;":    ErrEPDOperand,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - id \"open;":   ErrEPDSyntax,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 1bm e4;":      ErrEPDSyntax,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - id \"a\"; ;":  ErrEPDSyntax,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - id \"side\";": ErrFenSideToMove,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w":                     ErrFenFieldCount,
+	}
+	for s, want := range cases {
+		if _, err := ParseEPD(s); !errors.Is(err, want) {
+			t.Errorf("Parsing %q: got error %v, expected %v", s, err, want)
+		}
+	}
+}
+
+func TestEPDString(t *testing.T) {
+	records := []string{
+		`2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - bm Qg6; id "WAC.001";`,
+		`rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - bm e4 d4; am f3; ce 20; acd 8; pv e4 e5 Nf3; id "start"; c0 "a; b"; sv "two words" Nc3;`,
+		`r3k2r/8/8/8/8/8/8/R3K2R w KQkq - bm O-O; pv O-O O-O-O;`,
+		`8/8/8/8/8/8/8/k1K5 w - -`,
+	}
+	for _, s := range records {
+		e, err := ParseEPD(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := e.String(); got != s {
+			t.Errorf("EPD round trip:\ngot      %v\nexpected %v", got, s)
+		}
+	}
+	// Coordinate moves are written in SAN.
+	e, _ := ParseEPD("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - bm g1f3;")
+	if got := e.String(); got != "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - bm Nf3;" {
+		t.Error("Wrong EPD:", got)
+	}
+}
+
+func TestEPDReader(t *testing.T) {
+	input := `2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - bm Qg6; id "WAC.001";
+
+1k1r4/pp1b1R2/3q2pp/4p3/2B5/4Q3/PPP2B2/2K5 b - - bm Qd6; id "bad";
+1k1r4/pp1b1R2/3q2pp/4p3/2B5/4Q3/PPP2B2/2K5 b - - bm Qd1+; id "BK.01";
+`
+	r := NewEPDReader(strings.NewReader(input))
+	var ids []string
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if !errors.Is(err, ErrSANIllegal) || !strings.HasPrefix(err.Error(), "line 3:") {
+				t.Error("Wrong error:", err)
+			}
+			continue
+		}
+		ids = append(ids, e.ID)
+	}
+	if strings.Join(ids, " ") != "WAC.001 BK.01" {
+		t.Error("Wrong records read:", ids)
+	}
+}
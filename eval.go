@@ -0,0 +1,328 @@
+package dragon
+
+import (
+	"math/bits"
+)
+
+// An Evaluator statically scores positions, in centipawns from the point of
+// view of the side to move: positive scores favour the player whose turn it is.
+// Evaluators are used at the leaves of a search, so they should be fast, and
+// they need not detect checkmate or stalemate.
+type Evaluator interface {
+	Evaluate(*Board) int
+}
+
+// The reference Evaluator. It considers material, piece placement, mobility,
+// pawn structure, king safety and the bishop pair, each with separate
+// middlegame and endgame weights that are blended according to the material
+// left on the board. The zero value is ready to use, and is safe for
+// concurrent use.
+type DefaultEvaluator struct{}
+
+// Game phase weights of each piece type. The middlegame phase is at its
+// maximum, totalPhase, with all minor and major pieces on the board.
+var phaseWeights = [7]int{0, 0, 1, 1, 2, 4, 0}
+
+const totalPhase = 24
+
+// Middlegame and endgame piece values, indexed by piece type.
+var (
+	mgPieceValues = [7]int{0, 100, 320, 330, 500, 900, 0}
+	egPieceValues = [7]int{0, 120, 300, 320, 520, 930, 0}
+)
+
+// Evaluation terms, as middlegame and endgame values.
+var (
+	mgMobility = [7]int{0, 0, 4, 5, 2, 1, 0} // per square attacked
+	egMobility = [7]int{0, 0, 4, 5, 4, 2, 0}
+	// Typical numbers of attacked squares; fewer is a penalty, more a bonus.
+	mobilityBase = [7]int{0, 0, 4, 6, 7, 13, 0}
+
+	mgDoubledPawn, egDoubledPawn   = -10, -20 // per extra pawn on a file
+	mgIsolatedPawn, egIsolatedPawn = -10, -15
+	// Passed pawn bonuses, by rank from the pawn's point of view.
+	mgPassedPawn = [8]int{0, 5, 10, 20, 35, 60, 100, 0}
+	egPassedPawn = [8]int{0, 10, 20, 40, 70, 120, 200, 0}
+
+	mgBishopPair, egBishopPair = 30, 50
+
+	pawnShield = 10 // middlegame bonus per pawn in front of the king
+	// Middlegame weights of pieces attacking the squares around the king.
+	kingAttackWeights = [7]int{0, 0, 2, 2, 3, 5, 0}
+	maxKingDanger     = 500
+)
+
+// Piece-square tables, indexed by piece type and then by square from White's
+// point of view. They're written here as seen from White's side of the board,
+// so the first row is the 8th rank; see pieceSquareIndex.
+var mgPieceSquare = [7][64]int{
+	Pawn: {
+		0, 0, 0, 0, 0, 0, 0, 0,
+		50, 50, 50, 50, 50, 50, 50, 50,
+		10, 10, 20, 30, 30, 20, 10, 10,
+		5, 5, 10, 25, 25, 10, 5, 5,
+		0, 0, 0, 20, 20, 0, 0, 0,
+		5, -5, -10, 0, 0, -10, -5, 5,
+		5, 10, 10, -20, -20, 10, 10, 5,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	},
+	Knight: knightSquares,
+	Bishop: bishopSquares,
+	Rook:   rookSquares,
+	Queen:  queenSquares,
+	King: {
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-20, -30, -30, -40, -40, -30, -30, -20,
+		-10, -20, -20, -20, -20, -20, -20, -10,
+		20, 20, 0, 0, 0, 0, 20, 20,
+		20, 30, 10, 0, 0, 10, 30, 20,
+	},
+}
+
+var egPieceSquare = [7][64]int{
+	Pawn: {
+		0, 0, 0, 0, 0, 0, 0, 0,
+		80, 80, 80, 80, 80, 80, 80, 80,
+		50, 50, 50, 50, 50, 50, 50, 50,
+		30, 30, 30, 30, 30, 30, 30, 30,
+		15, 15, 15, 15, 15, 15, 15, 15,
+		5, 5, 5, 5, 5, 5, 5, 5,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	},
+	Knight: knightSquares,
+	Bishop: bishopSquares,
+	Rook:   rookSquares,
+	Queen:  queenSquares,
+	King: {
+		-50, -40, -30, -20, -20, -30, -40, -50,
+		-30, -20, -10, 0, 0, -10, -20, -30,
+		-30, -10, 20, 30, 30, 20, -10, -30,
+		-30, -10, 30, 40, 40, 30, -10, -30,
+		-30, -10, 30, 40, 40, 30, -10, -30,
+		-30, -10, 20, 30, 30, 20, -10, -30,
+		-30, -30, 0, 0, 0, 0, -30, -30,
+		-50, -30, -30, -30, -30, -30, -30, -50,
+	},
+}
+
+var knightSquares = [64]int{
+	-50, -40, -30, -30, -30, -30, -40, -50,
+	-40, -20, 0, 0, 0, 0, -20, -40,
+	-30, 0, 10, 15, 15, 10, 0, -30,
+	-30, 5, 15, 20, 20, 15, 5, -30,
+	-30, 0, 15, 20, 20, 15, 0, -30,
+	-30, 5, 10, 15, 15, 10, 5, -30,
+	-40, -20, 0, 5, 5, 0, -20, -40,
+	-50, -40, -30, -30, -30, -30, -40, -50,
+}
+
+var bishopSquares = [64]int{
+	-20, -10, -10, -10, -10, -10, -10, -20,
+	-10, 0, 0, 0, 0, 0, 0, -10,
+	-10, 0, 5, 10, 10, 5, 0, -10,
+	-10, 5, 5, 10, 10, 5, 5, -10,
+	-10, 0, 10, 10, 10, 10, 0, -10,
+	-10, 10, 10, 10, 10, 10, 10, -10,
+	-10, 5, 0, 0, 0, 0, 5, -10,
+	-20, -10, -10, -10, -10, -10, -10, -20,
+}
+
+var rookSquares = [64]int{
+	0, 0, 0, 0, 0, 0, 0, 0,
+	5, 10, 10, 10, 10, 10, 10, 5,
+	-5, 0, 0, 0, 0, 0, 0, -5,
+	-5, 0, 0, 0, 0, 0, 0, -5,
+	-5, 0, 0, 0, 0, 0, 0, -5,
+	-5, 0, 0, 0, 0, 0, 0, -5,
+	-5, 0, 0, 0, 0, 0, 0, -5,
+	0, 0, 0, 5, 5, 0, 0, 0,
+}
+
+var queenSquares = [64]int{
+	-20, -10, -10, -5, -5, -10, -10, -20,
+	-10, 0, 0, 0, 0, 0, 0, -10,
+	-10, 0, 5, 5, 5, 5, 0, -10,
+	-5, 0, 5, 5, 5, 5, 0, -5,
+	0, 0, 5, 5, 5, 5, 0, -5,
+	-10, 5, 5, 5, 5, 5, 0, -10,
+	-10, 0, 5, 0, 0, 0, 0, -10,
+	-20, -10, -10, -5, -5, -10, -10, -20,
+}
+
+// Converts a square into an index into the piece-square tables.
+func pieceSquareIndex(sq uint8, white bool) uint8 {
+	if white {
+		return sq ^ 56 // the tables' first row is the 8th rank
+	}
+	return sq
+}
+
+// Squares in front of a pawn, on its own and adjacent files, which must be
+// free of enemy pawns for it to be passed. Indexed by [white][square].
+var passedPawnMasks [2][64]uint64
+
+// The files on either side of each file.
+var adjacentFiles [8]uint64
+
+func init() {
+	for f := 0; f < 8; f++ {
+		if f > 0 {
+			adjacentFiles[f] |= FileMasks[f-1]
+		}
+		if f < 7 {
+			adjacentFiles[f] |= FileMasks[f+1]
+		}
+	}
+	for sq := 0; sq < 64; sq++ {
+		files := FileMasks[sq%8] | adjacentFiles[sq%8]
+		for r := 0; r < 8; r++ {
+			if r > sq/8 {
+				passedPawnMasks[1][sq] |= files & RankMasks[r]
+			} else if r < sq/8 {
+				passedPawnMasks[0][sq] |= files & RankMasks[r]
+			}
+		}
+	}
+}
+
+func (DefaultEvaluator) Evaluate(b *Board) int {
+	var mg, eg, phase int
+	occupied := b.White.All | b.Black.All
+	whitePawnAttacks := pawnAttacks(b.White.Pawns, true)
+	blackPawnAttacks := pawnAttacks(b.Black.Pawns, false)
+	for _, side := range [2]struct {
+		ours, theirs           *Bitboards
+		white                  bool
+		sign                   int
+		enemyPawnAttacks       uint64
+		ourKing, theirKingZone uint64
+	}{
+		{&b.White, &b.Black, true, 1, blackPawnAttacks, b.White.Kings, kingZone(b.Black.Kings)},
+		{&b.Black, &b.White, false, -1, whitePawnAttacks, b.Black.Kings, kingZone(b.White.Kings)},
+	} {
+		var smg, seg, kingDanger int
+		// Material, piece placement and mobility.
+		for piece, bb := range [7]uint64{Pawn: side.ours.Pawns, Knight: side.ours.Knights,
+			Bishop: side.ours.Bishops, Rook: side.ours.Rooks, Queen: side.ours.Queens, King: side.ours.Kings} {
+			for ; bb != 0; bb &= bb - 1 {
+				sq := uint8(bits.TrailingZeros64(bb))
+				idx := pieceSquareIndex(sq, side.white)
+				smg += mgPieceValues[piece] + mgPieceSquare[piece][idx]
+				seg += egPieceValues[piece] + egPieceSquare[piece][idx]
+				phase += phaseWeights[piece]
+
+				var attacks uint64
+				switch piece {
+				case Knight:
+					attacks = knightMasks[sq]
+				case Bishop:
+					attacks = CalculateBishopMoveBitboard(sq, occupied)
+				case Rook:
+					attacks = CalculateRookMoveBitboard(sq, occupied)
+				case Queen:
+					attacks = CalculateBishopMoveBitboard(sq, occupied) | CalculateRookMoveBitboard(sq, occupied)
+				default:
+					continue
+				}
+				mobility := bits.OnesCount64(attacks&^side.ours.All&^side.enemyPawnAttacks) - mobilityBase[piece]
+				smg += mgMobility[piece] * mobility
+				seg += egMobility[piece] * mobility
+				kingDanger += kingAttackWeights[piece] * bits.OnesCount64(attacks&side.theirKingZone)
+			}
+		}
+
+		if bits.OnesCount64(side.ours.Bishops) >= 2 {
+			smg += mgBishopPair
+			seg += egBishopPair
+		}
+
+		// Pawn structure.
+		for f := 0; f < 8; f++ {
+			if n := bits.OnesCount64(side.ours.Pawns & FileMasks[f]); n > 0 {
+				smg += mgDoubledPawn * (n - 1)
+				seg += egDoubledPawn * (n - 1)
+				if side.ours.Pawns&adjacentFiles[f] == 0 {
+					smg += mgIsolatedPawn * n
+					seg += egIsolatedPawn * n
+				}
+			}
+		}
+		white := 0
+		if side.white {
+			white = 1
+		}
+		for bb := side.ours.Pawns; bb != 0; bb &= bb - 1 {
+			sq := bits.TrailingZeros64(bb)
+			if passedPawnMasks[white][sq]&side.theirs.Pawns == 0 {
+				rank := sq / 8
+				if !side.white {
+					rank = 7 - rank
+				}
+				smg += mgPassedPawn[rank]
+				seg += egPassedPawn[rank]
+			}
+		}
+
+		// King safety, which matters little once the queens are gone: a pawn
+		// shield, and the attackers on the squares around the enemy king.
+		if side.ourKing != 0 {
+			files := kingZone(side.ourKing) & RankMasks[bits.TrailingZeros64(side.ourKing)/8]
+			shield := files<<8 | files<<16
+			if !side.white {
+				shield = files>>8 | files>>16
+			}
+			smg += pawnShield * bits.OnesCount64(shield&side.ours.Pawns)
+		}
+		if side.ours.Queens != 0 {
+			smg += minInt(kingDanger*kingDanger/4, maxKingDanger)
+		}
+
+		mg += side.sign * smg
+		eg += side.sign * seg
+	}
+
+	// Taper between the middlegame and endgame scores.
+	if phase > totalPhase {
+		phase = totalPhase // early promotions
+	}
+	score := (mg*phase + eg*(totalPhase-phase)) / totalPhase
+	if !b.Wtomove {
+		return -score
+	}
+	return score
+}
+
+// The squares attacked by a set of pawns.
+func pawnAttacks(pawns uint64, white bool) uint64 {
+	if white {
+		return (pawns<<7)&^FileMasks[7] | (pawns<<9)&^FileMasks[0]
+	}
+	return (pawns>>9)&^FileMasks[7] | (pawns>>7)&^FileMasks[0]
+}
+
+// The king's square and those around it, or nothing if there is no king.
+func kingZone(king uint64) uint64 {
+	if king == 0 {
+		return 0
+	}
+	sq := bits.TrailingZeros64(king)
+	return king | kingMasks[sq]
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
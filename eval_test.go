@@ -0,0 +1,92 @@
+package dragon
+
+import (
+	"strings"
+	"testing"
+)
+
+// Mirrors a position vertically and swaps the colours, so that the evaluation
+// from the side to move's point of view should not change.
+func mirrorFen(fen string) string {
+	fields := strings.Fields(fen)
+	ranks := strings.Split(fields[0], "/")
+	for i, j := 0, len(ranks)-1; i < j; i, j = i+1, j-1 {
+		ranks[i], ranks[j] = ranks[j], ranks[i]
+	}
+	swapCase := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' {
+				return r - 'a' + 'A'
+			} else if r >= 'A' && r <= 'Z' {
+				return r - 'A' + 'a'
+			}
+			return r
+		}, s)
+	}
+	fields[0] = swapCase(strings.Join(ranks, "/"))
+	if fields[1] == "w" {
+		fields[1] = "b"
+	} else {
+		fields[1] = "w"
+	}
+	if fields[2] != "-" {
+		fields[2] = swapCase(fields[2])
+	}
+	if fields[3] != "-" {
+		fields[3] = fields[3][:1] + string('1'+'8'-fields[3][1])
+	}
+	return strings.Join(fields, " ")
+}
+
+func TestEvaluateSymmetry(t *testing.T) {
+	var e DefaultEvaluator
+	fens := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"rnbqkb1r/pp1p1ppp/2p5/4P3/2B5/8/PPP1NnPP/RNBQK2R w KQkq - 0 6",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10",
+		"8/8/8/8/8/2k5/8/K3q3 w - - 10 60",
+	}
+	for _, fen := range fens {
+		b := ParseFen(fen)
+		mirrored := ParseFen(mirrorFen(fen))
+		if got, want := e.Evaluate(&mirrored), e.Evaluate(&b); got != want {
+			t.Error("Asymmetric evaluation of", fen, "got", want, "and mirrored", got)
+		}
+	}
+	b := ParseFen(Startpos)
+	if score := e.Evaluate(&b); score != 0 {
+		t.Error("Expected a level start position, got", score)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	var e DefaultEvaluator
+	// Each pair of positions differs in one respect, and the first is better
+	// for the side to move.
+	pairs := [][2]string{
+		// material
+		{"4k3/8/8/8/8/8/8/3QK3 w - - 0 1", "4k3/8/8/8/8/8/8/3RK3 w - - 0 1"},
+		{"4k3/8/8/8/8/8/8/3RK3 b - - 0 1", "4k3/8/8/8/8/8/8/3QK3 b - - 0 1"},
+		// the bishop pair
+		{"4k3/pppppppp/8/8/8/8/PPPPPPPP/2B1KB2 w - - 0 1", "4k3/pppppppp/8/8/8/8/PPPPPPPP/2N1KB2 w - - 0 1"},
+		// passed pawns beat blocked ones, and further advanced passers are better
+		{"4k3/8/8/3P4/8/8/8/4K3 w - - 0 1", "4k3/2p5/8/3P4/8/8/8/4K3 w - - 0 1"},
+		{"4k3/8/3P4/8/8/8/8/4K3 w - - 0 1", "4k3/8/8/8/3P4/8/8/4K3 w - - 0 1"},
+		// doubled and isolated pawns
+		{"4k3/8/8/8/8/8/3PP3/4K3 w - - 0 1", "4k3/8/8/8/8/3P4/3P4/4K3 w - - 0 1"},
+		// mobility: a free bishop beats a buried one
+		{"4k3/8/8/8/8/8/P7/B3K3 w - - 0 1", "4k3/8/8/8/8/8/1P6/B3K3 w - - 0 1"},
+		// king safety: a sheltered king beats an exposed one
+		{"rnbq1rk1/ppp2ppp/8/8/8/8/PPP2PPP/RNBQ1RK1 b - - 0 1", "rnbq1rk1/ppp5/8/8/5ppp/8/PPP2PPP/RNBQ1RK1 b - - 0 1"},
+		// the king belongs in the centre in the endgame
+		{"8/8/8/4k3/8/8/8/K7 b - - 0 1", "k7/8/8/8/8/8/8/4K3 b - - 0 1"},
+	}
+	for _, pair := range pairs {
+		better, worse := ParseFen(pair[0]), ParseFen(pair[1])
+		if e.Evaluate(&better) <= e.Evaluate(&worse) {
+			t.Error("Expected", pair[0], "to be better than", pair[1], "got",
+				e.Evaluate(&better), "and", e.Evaluate(&worse))
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package dragon
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// ErrIllegalMove is returned by Game.Push for a move that isn't legal in the
+// current position.
+var ErrIllegalMove = errors.New("dragon: illegal move")
+
+// A game in progress: a Board, along with the moves and positions that led to
+// it, so that repetitions can be detected and the result adjudicated.
+type Game struct {
+	Board   Board
+	history []gameEntry
+}
+
+// A pushed move, and what is needed to take it back.
+type gameEntry struct {
+	move Move
+	undo Undo // holds the hash of the position before the move
+}
+
+// Starts a game from a position. Positions before it are unknown, so
+// repetitions are only counted from here.
+func NewGame(b Board) *Game {
+	return &Game{Board: b}
+}
+
+// Plays a legal move, or returns ErrIllegalMove and leaves the game unchanged.
+func (g *Game) Push(m Move) error {
+	if !g.Board.IsLegal(m) {
+		return ErrIllegalMove
+	}
+	g.history = append(g.history, gameEntry{move: m})
+	g.Board.MakeMove(m, &g.history[len(g.history)-1].undo)
+	return nil
+}
+
+// Takes back the last move, and returns it; false if no moves have been played.
+func (g *Game) Pop() (Move, bool) {
+	if len(g.history) == 0 {
+		return 0, false
+	}
+	last := g.history[len(g.history)-1]
+	g.history = g.history[:len(g.history)-1]
+	g.Board.UnmakeMove(last.move, &last.undo)
+	return last.move, true
+}
+
+// The moves played so far, oldest first.
+func (g *Game) Moves() []Move {
+	moves := make([]Move, len(g.history))
+	for i, e := range g.history {
+		moves[i] = e.move
+	}
+	return moves
+}
+
+// The hashes of the positions before each move played so far, oldest first.
+// Searchers can use them to score repetitions as draws.
+func (g *Game) Hashes() []uint64 {
+	hashes := make([]uint64, len(g.history))
+	for i, e := range g.history {
+		hashes[i] = e.undo.Hash
+	}
+	return hashes
+}
+
+// How many times the current position has occurred, counting itself. Only
+// positions since the last capture or pawn move can repeat it.
+func (g *Game) Repetitions() int {
+	count := 1
+	hash := g.Board.Hash()
+	n := len(g.history)
+	for i := n - 2; i >= 0 && i >= n-int(g.Board.Halfmoveclock); i -= 2 {
+		if g.history[i].undo.Hash == hash {
+			count++
+		}
+	}
+	return count
+}
+
+// Why a game ended, or Ongoing.
+type Termination uint8
+
+const (
+	Ongoing Termination = iota
+	Checkmate
+	Stalemate
+	InsufficientMaterial
+	FivefoldRepetition
+	SeventyFiveMoveRule
+	ThreefoldRepetition
+	FiftyMoveRule
+)
+
+func (t Termination) String() string {
+	switch t {
+	case Ongoing:
+		return "ongoing"
+	case Checkmate:
+		return "checkmate"
+	case Stalemate:
+		return "stalemate"
+	case InsufficientMaterial:
+		return "insufficient material"
+	case FivefoldRepetition:
+		return "fivefold repetition"
+	case SeventyFiveMoveRule:
+		return "seventy-five-move rule"
+	case ThreefoldRepetition:
+		return "threefold repetition"
+	case FiftyMoveRule:
+		return "fifty-move rule"
+	}
+	return "unknown"
+}
+
+// Whether the game ends only if a player claims it (as with threefold
+// repetition and the fifty-move rule), rather than immediately.
+func (t Termination) Claimable() bool {
+	return t == ThreefoldRepetition || t == FiftyMoveRule
+}
+
+// The outcome of a game, written as in PGN.
+type Result uint8
+
+const (
+	NoResult Result = iota // the game is ongoing
+	WhiteWins
+	BlackWins
+	Draw
+)
+
+func (r Result) String() string {
+	switch r {
+	case WhiteWins:
+		return "1-0"
+	case BlackWins:
+		return "0-1"
+	case Draw:
+		return "1/2-1/2"
+	}
+	return "*"
+}
+
+// The state of a game: whether, how and with what result it has ended.
+type Status struct {
+	Termination Termination
+	Result      Result
+}
+
+// Adjudicates the current position. Checkmate takes precedence over the other
+// rules, and the draws that end the game immediately (stalemate, insufficient
+// material, fivefold repetition and the seventy-five-move rule) over those
+// that must be claimed (threefold repetition and the fifty-move rule); see
+// Termination.Claimable.
+func (g *Game) Status() Status {
+	b := &g.Board
+	moves, inCheck := b.GenerateLegalMoves()
+	switch {
+	case len(moves) == 0 && inCheck:
+		if b.Wtomove {
+			return Status{Checkmate, BlackWins}
+		}
+		return Status{Checkmate, WhiteWins}
+	case len(moves) == 0:
+		return Status{Stalemate, Draw}
+	case b.InsufficientMaterial():
+		return Status{InsufficientMaterial, Draw}
+	}
+	reps := g.Repetitions()
+	switch {
+	case reps >= 5:
+		return Status{FivefoldRepetition, Draw}
+	case b.Halfmoveclock >= 150:
+		return Status{SeventyFiveMoveRule, Draw}
+	case reps >= 3:
+		return Status{ThreefoldRepetition, Draw}
+	case b.Halfmoveclock >= 100:
+		return Status{FiftyMoveRule, Draw}
+	}
+	return Status{Ongoing, NoResult}
+}
+
+// Whether neither side has the material to checkmate by any series of legal
+// moves: only kings, kings and one knight or bishop, or kings and any number
+// of bishops all on squares of one colour.
+func (b *Board) InsufficientMaterial() bool {
+	if b.White.Pawns|b.Black.Pawns|b.White.Rooks|b.Black.Rooks|b.White.Queens|b.Black.Queens != 0 {
+		return false
+	}
+	knights := b.White.Knights | b.Black.Knights
+	bishops := b.White.Bishops | b.Black.Bishops
+	if knights != 0 {
+		return bits.OnesCount64(knights|bishops) == 1
+	}
+	const lightSquares = 0x55AA55AA55AA55AA
+	return bishops&lightSquares == 0 || bishops&^lightSquares == 0
+}
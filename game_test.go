@@ -0,0 +1,144 @@
+package dragon
+
+import (
+	"errors"
+	"testing"
+)
+
+// Plays a sequence of moves from a position, failing on any illegal move.
+func playGame(t *testing.T, fen string, moves ...string) *Game {
+	g := NewGame(ParseFen(fen))
+	for _, m := range moves {
+		if err := g.Push(parseMove(m)); err != nil {
+			t.Fatal("Failed to push", m, "in", g.Board.ToFen(), ":", err)
+		}
+	}
+	return g
+}
+
+func TestGameStatus(t *testing.T) {
+	shuffle := []string{"g1f3", "g8f6", "f3g1", "f6g8"}
+	cases := []struct {
+		fen   string
+		moves []string
+		want  Status
+	}{
+		{Startpos, nil, Status{Ongoing, NoResult}},
+		{Startpos, []string{"f2f3", "e7e5", "g2g4", "d8h4"}, Status{Checkmate, BlackWins}},
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", []string{"a1a8"}, Status{Checkmate, WhiteWins}},
+		{"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", nil, Status{Stalemate, Draw}},
+		{"8/8/4k3/8/8/3K4/8/8 w - - 0 1", nil, Status{InsufficientMaterial, Draw}},
+		{"8/8/4k3/8/8/3K4/5N2/8 w - - 0 1", nil, Status{InsufficientMaterial, Draw}},
+		{"8/8/4kb2/8/8/3KB3/8/8 w - - 0 1", nil, Status{InsufficientMaterial, Draw}},
+		{"8/8/4kb2/8/8/3K1B2/8/8 w - - 0 1", nil, Status{Ongoing, NoResult}},
+		{"8/8/4k3/8/8/3K4/5NN1/8 w - - 0 1", nil, Status{Ongoing, NoResult}},
+		{Startpos, append(shuffle, shuffle[:3]...), Status{Ongoing, NoResult}},
+		{Startpos, append(shuffle, shuffle...), Status{ThreefoldRepetition, Draw}},
+		{Startpos, append(append(shuffle, shuffle...), append(shuffle, shuffle...)...), Status{FivefoldRepetition, Draw}},
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 99 80", nil, Status{Ongoing, NoResult}},
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 99 80", []string{"a1a2"}, Status{FiftyMoveRule, Draw}},
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 150 100", nil, Status{SeventyFiveMoveRule, Draw}},
+		// checkmate takes precedence over the move counter
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 149 100", []string{"a1a8"}, Status{Checkmate, WhiteWins}},
+	}
+	for _, c := range cases {
+		g := playGame(t, c.fen, c.moves...)
+		if got := g.Status(); got != c.want {
+			t.Errorf("Status of %v after %v: got %v (%v), expected %v (%v)",
+				c.fen, c.moves, got.Termination, got.Result, c.want.Termination, c.want.Result)
+		}
+	}
+}
+
+func TestGamePushPop(t *testing.T) {
+	g := playGame(t, Startpos, "e2e4", "e7e5", "g1f3")
+	if err := g.Push(parseMove("e1e2")); !errors.Is(err, ErrIllegalMove) {
+		t.Error("Expected an illegal move error, got", err)
+	}
+	if moves := g.Moves(); len(moves) != 3 || moves[2] != parseMove("g1f3") {
+		t.Error("Wrong move history:", moves)
+	}
+	start := ParseFen(Startpos)
+	if hashes := g.Hashes(); len(hashes) != 3 || hashes[0] != start.Hash() {
+		t.Error("Wrong hash history:", hashes)
+	}
+	for _, want := range []string{"g1f3", "e7e5", "e2e4"} {
+		if m, ok := g.Pop(); !ok || m != parseMove(want) {
+			t.Error("Expected to pop", want, "but got", &m)
+		}
+	}
+	if _, ok := g.Pop(); ok {
+		t.Error("Popped a move from an empty game")
+	}
+	if g.Board.ToFen() != Startpos || g.Board.Hash() != start.Hash() {
+		t.Error("Popping every move didn't restore the starting position:", g.Board.ToFen())
+	}
+}
+
+func TestGameRepetitions(t *testing.T) {
+	g := playGame(t, Startpos, "g1f3", "g8f6", "f3g1", "f6g8", "g1f3", "g8f6", "f3g1", "f6g8")
+	if n := g.Repetitions(); n != 3 {
+		t.Error("Expected 3 repetitions, got", n)
+	}
+	g.Pop()
+	if n := g.Repetitions(); n != 2 {
+		t.Error("Expected 2 repetitions after a pop, got", n)
+	}
+	// A pawn move makes earlier positions unreachable.
+	g = playGame(t, Startpos, "g1f3", "g8f6", "f3g1", "f6g8", "e2e4", "e7e5", "g1f3", "g8f6", "f3g1", "f6g8")
+	if n := g.Repetitions(); n != 2 {
+		t.Error("Expected 2 repetitions since the pawn moves, got", n)
+	}
+	if !ThreefoldRepetition.Claimable() || FivefoldRepetition.Claimable() || Checkmate.String() != "checkmate" ||
+		BlackWins.String() != "0-1" || NoResult.String() != "*" {
+		t.Error("Wrong Termination or Result descriptions")
+	}
+}
+
+func TestInsufficientMaterial(t *testing.T) {
+	positions := map[string]bool{
+		"8/8/4k3/8/8/3K4/8/8 w - - 0 1":        true,
+		"8/8/4k3/8/8/3K4/2B5/8 w - - 0 1":      true,
+		"8/8/4kn2/8/8/3K4/8/8 w - - 0 1":       true,
+		"8/8/4kn2/8/8/3K4/2B5/8 w - - 0 1":     false, // a helpmate is possible
+		"b7/1b6/4k3/8/8/3K4/8/7B w - - 0 1":    true,  // bishops all on light squares
+		"8/8/4k3/8/8/3K4/8/4p3 w - - 0 1":      false,
+		"8/8/4k3/8/8/3K4/8/R7 w - - 0 1":       false,
+		"8/8/4k3/8/8/3K4/4N3/4N3 w - - 0 1":    false,
+		"8/8/4kb2/8/8/3K4/8/7B w - - 0 1":      false,
+		"8/b7/4k3/8/8/3K4/8/B7 w - - 0 1":      true, // bishops all on dark squares
+		"8/8/4k3/8/8/3K4/8/1Q6 w - - 0 1":      false,
+		"8/8/4k3/8/8/3K4/8/1q6 w - - 0 1":      false,
+		"8/8/4k3/2r5/8/3K4/8/8 w - - 0 1":      false,
+		"8/8/4k3/8/8/3K4/8/2bB4 w - - 0 1":     false,
+		"8/8/4k3/8/8/3K4/8/2b1B3 w - - 0 1":    true,
+		"8/8/4k3/8/8/3K4/8/2b1B2n w - - 0 1":   false,
+		"8/8/4k3/8/8/3K4/8/7n w - - 0 1":       true,
+		"8/8/4k3/8/8/3K4/8/6nn w - - 0 1":      false,
+		"8/8/4k3/8/8/3K4/8/6BB w - - 0 1":      false,
+		"8/8/4k3/8/8/3K4/8/5B1B w - - 0 1":     true,
+		"8/8/4k3/8/8/3K4/8/5b1B w - - 0 1":     true,
+		"8/8/4k3/8/8/3K4/8/5bB1 w - - 0 1":     false,
+		"8/8/4k3/8/8/3K4/8/5Nb1 w - - 0 1":     false,
+		"8/8/4k3/8/8/3K4/P7/8 w - - 0 1":       false,
+		"K7/8/4k3/8/8/8/8/8 w - - 0 1":         true,
+		"K7/8/4k3/8/8/8/8/1n6 w - - 0 1":       true,
+		"K7/8/4k3/8/8/8/8/1N6 w - - 0 1":       true,
+		"K7/8/4k3/8/8/8/8/1B6 w - - 0 1":       true,
+		"K7/8/4k3/8/8/8/8/1b6 w - - 0 1":       true,
+		"K7/8/4k3/8/8/8/8/1bB5 w - - 0 1":      false,
+		"K7/8/4k3/8/8/8/8/1b1B4 w - - 0 1":     true,
+		"K7/8/4k3/8/8/8/8/1b1B1b2 w - - 0 1":   true,
+		"K7/8/4k3/8/8/8/8/1b1B1b1N w - - 0 1":  false,
+		"K7/8/4k3/8/8/8/8/1b1B1b1Q w - - 0 1":  false,
+		"K7/8/4k3/8/8/8/8/1b1B1b1R w - - 0 1":  false,
+		"K7/8/4k3/8/8/8/8/1b1B1b1P w - - 0 1":  false,
+		"K7/8/4k3/8/8/8/1p6/1b1B1b2 w - - 0 1": false,
+	}
+	for fen, want := range positions {
+		b := ParseFen(fen)
+		if got := b.InsufficientMaterial(); got != want {
+			t.Error("Wrong insufficient material verdict for", fen, ": got", got)
+		}
+	}
+}
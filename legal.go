@@ -0,0 +1,116 @@
+package dragon
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// Whether a move follows the rules of movement for the side to move, ignoring
+// whether it leaves the king in check: its piece is ours, it moves as that
+// piece can to a square not held by our own pieces, and pawns promote exactly
+// when they reach the last rank. Castling moves must be encoded as the move
+// generator encodes them, and are only pseudo-legal if they are legal. It
+// takes roughly constant time, so it suits moves from transposition tables,
+// opening books and other untrusted sources.
+func (b *Board) IsPseudoLegal(m Move) bool {
+	ours, opp := &(b.White), &(b.Black)
+	if !b.Wtomove {
+		ours, opp = &(b.Black), &(b.White)
+	}
+	from, to := m.From(), m.To()
+	fromBitboard, toBitboard := uint64(1)<<from, uint64(1)<<to
+	if m == 0 || ours.All&fromBitboard == 0 {
+		return false
+	}
+	piece := Piece(b.squares[from] & 7)
+	if piece == King {
+		if right, ok := b.castlingRight(m); ok {
+			castle, legal := b.legalCastlingMove(from, from&^7, right)
+			return legal && castle == m && b.Checkers() == 0
+		}
+	}
+	if ours.All&toBitboard != 0 {
+		return false
+	}
+	occupied := b.White.All | b.Black.All
+	lastRank := RankMasks[7]
+	if !b.Wtomove {
+		lastRank = RankMasks[0]
+	}
+	if piece != Pawn || toBitboard&lastRank == 0 {
+		if m.Promote() != Nothing {
+			return false
+		}
+	} else if m.Promote() < Knight || m.Promote() > Queen {
+		return false
+	}
+	switch piece {
+	case Pawn:
+		push, doublePush, startRank := int(from)+8, int(from)+16, RankMasks[1]
+		if !b.Wtomove {
+			push, doublePush, startRank = int(from)-8, int(from)-16, RankMasks[6]
+		}
+		switch {
+		case int(to) == push:
+			return occupied&toBitboard == 0
+		case int(to) == doublePush:
+			return fromBitboard&startRank != 0 && occupied&(toBitboard|uint64(1)<<push) == 0
+		}
+		if pawnAttacks(fromBitboard, b.Wtomove)&toBitboard == 0 {
+			return false
+		}
+		return opp.All&toBitboard != 0 || (b.enpassant != 0 && to == b.enpassant)
+	case Knight:
+		return knightMasks[from]&toBitboard != 0
+	case Bishop:
+		return CalculateBishopMoveBitboard(from, occupied)&toBitboard != 0
+	case Rook:
+		return CalculateRookMoveBitboard(from, occupied)&toBitboard != 0
+	case Queen:
+		return (CalculateBishopMoveBitboard(from, occupied)|CalculateRookMoveBitboard(from, occupied))&toBitboard != 0
+	case King:
+		return kingMasks[from]&toBitboard != 0
+	}
+	return false
+}
+
+// Whether a move is legal: whether it is in the moves that GenerateLegalMoves
+// generates. Like IsPseudoLegal, it takes roughly constant time.
+func (b *Board) IsLegal(m Move) bool {
+	if !b.IsPseudoLegal(m) {
+		return false
+	}
+	from, to := m.From(), m.To()
+	ourKings := b.White.Kings
+	if !b.Wtomove {
+		ourKings = b.Black.Kings
+	}
+	if ourKings&(uint64(1)<<from) != 0 {
+		if _, ok := b.castlingRight(m); ok {
+			return true // IsPseudoLegal checked everything
+		}
+		// Sliders see through the king's square once it has left.
+		occupied := (b.White.All | b.Black.All) &^ (uint64(1) << from)
+		return b.attackersTo(to, b.Wtomove, occupied) == 0
+	}
+	if ourKings == 0 {
+		return true
+	}
+	// Find attacks on the king after the move, with any captured piece gone.
+	captured := uint64(1) << to
+	if to == b.enpassant && b.enpassant != 0 && Piece(b.squares[from]&7) == Pawn {
+		captured = uint64(1) << (from&^7 | to&7)
+	}
+	occupied := (b.White.All|b.Black.All)&^(uint64(1)<<from)&^captured | uint64(1)<<to
+	king := uint8(bits.TrailingZeros64(ourKings))
+	return b.attackersTo(king, b.Wtomove, occupied)&^captured == 0
+}
+
+// Like Apply, but checks the move first. An illegal move returns an error
+// wrapping ErrIllegalMove, and leaves the board unchanged.
+func (b *Board) ApplySafe(m Move) (func(), error) {
+	if !b.IsLegal(m) {
+		return nil, fmt.Errorf("%w: %v in %v", ErrIllegalMove, &m, b.ToFen())
+	}
+	return b.Apply(m), nil
+}
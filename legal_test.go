@@ -0,0 +1,130 @@
+package dragon
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsPseudoLegal(t *testing.T) {
+	cases := []struct {
+		fen    string
+		move   string
+		pseudo bool // whether it's pseudo-legal
+		legal  bool
+	}{
+		{Startpos, "e2e4", true, true},
+		{Startpos, "e2e5", false, false},
+		{Startpos, "e7e5", false, false}, // not our piece
+		{Startpos, "e3e4", false, false}, // no piece
+		{Startpos, "g1e2", false, false}, // our own piece
+		{Startpos, "f1c4", false, false}, // blocked
+		{Startpos, "e2e4q", false, false},
+		{"3qk3/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7d8", false, false}, // a pawn reaching the last rank must promote
+		{"3qk3/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7d8n", true, true},
+		{"3qk3/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7e8q", false, false},
+		// A pinned knight, a king stepping into check, and a check to answer.
+		{"4k3/4r3/8/8/8/8/4N3/4K3 w - - 0 1", "e2c3", true, false},
+		{"4k3/4r3/8/8/8/8/8/3K4 w - - 0 1", "d1e1", true, false},
+		{"4k3/4r3/8/8/8/8/8/4K2R w K - 0 1", "h1h2", true, false},
+		{"4k3/4r3/8/8/8/8/8/4K2R w K - 0 1", "h1e1", false, false},
+		{"4k3/4r3/8/8/8/8/8/4K2R w K - 0 1", "h1h8", true, false},
+		// En passant: legal, with no e.p. square, and exposing the king.
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", true, true},
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - - 0 1", "e5d6", false, false},
+		{"8/8/8/K2pP2r/8/8/8/4k3 w - d6 0 1", "e5d6", true, false},
+		// Castling: legal, through check, out of check, and as a 960 king move.
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", true, true},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1h1", false, false},
+		{"r3k2r/8/8/8/8/8/5r2/R3K2R w KQkq - 0 1", "e1g1", false, false},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1c1", true, true},
+		{"r3k2r/8/8/8/8/8/4r3/R3K2R w KQkq - 0 1", "e1c1", false, false},
+		{"4k3/8/8/8/8/8/8/RR2K3 w B - 0 1", "e1b1", true, true},
+		{"4k3/8/8/8/8/8/8/5KR1 w K - 0 1", "f1g1", true, true},
+		{"4k3/8/8/8/8/8/8/5KR1 w - - 0 1", "f1g1", false, false},
+		{Startpos, "0000", false, false},
+	}
+	for _, c := range cases {
+		b := ParseFen(c.fen)
+		m := parseMove(c.move)
+		if got := b.IsPseudoLegal(m); got != c.pseudo {
+			t.Errorf("IsPseudoLegal(%s) in %s: got %v", c.move, c.fen, got)
+		}
+		if got := b.IsLegal(m); got != c.legal {
+			t.Errorf("IsLegal(%s) in %s: got %v", c.move, c.fen, got)
+		}
+	}
+}
+
+// IsLegal accepts exactly the generated moves, of every move from our pieces,
+// throughout perft trees.
+func TestIsLegal(t *testing.T) {
+	var walk func(b *Board, depth int)
+	walk = func(b *Board, depth int) {
+		var moves MoveList
+		b.GenerateLegalMovesInto(&moves)
+		legal := make(map[Move]bool, moves.Count)
+		for _, m := range moves.Slice() {
+			legal[m] = true
+		}
+		ours := b.White.All
+		if !b.Wtomove {
+			ours = b.Black.All
+		}
+		for from := Square(0); from < 64; from++ {
+			if ours&(uint64(1)<<from) == 0 {
+				continue
+			}
+			for to := Square(0); to < 64; to++ {
+				for promote := Piece(Nothing); promote <= Queen; promote++ {
+					if promote == Pawn {
+						continue
+					}
+					var m Move
+					m.Setfrom(from).Setto(to).Setpromote(promote)
+					if b.IsLegal(m) != legal[m] {
+						t.Fatalf("IsLegal(%v) is %v in %s", &m, !legal[m], b.ToFen())
+					}
+					if legal[m] && !b.IsPseudoLegal(m) {
+						t.Fatalf("Legal move %v isn't pseudo-legal in %s", &m, b.ToFen())
+					}
+				}
+			}
+		}
+		if depth > 1 {
+			for _, m := range moves.Slice() {
+				var undo Undo
+				b.MakeMove(m, &undo)
+				walk(b, depth-1)
+				b.UnmakeMove(m, &undo)
+			}
+		}
+	}
+	for _, fen := range []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"6k1/8/8/8/1Pp5/8/Q7/6K1 b - b3 0 1",
+		"1r2k3/8/8/8/8/8/8/RR2K3 w Bq - 0 1",
+	} {
+		b := ParseFen(fen)
+		walk(&b, 2)
+	}
+}
+
+func TestApplySafe(t *testing.T) {
+	b := ParseFen(Startpos)
+	if _, err := b.ApplySafe(parseMove("e2e5")); !errors.Is(err, ErrIllegalMove) {
+		t.Error("Expected ErrIllegalMove, got", err)
+	}
+	if b.ToFen() != Startpos {
+		t.Error("The board changed:", b.ToFen())
+	}
+	unapply, err := b.ApplySafe(parseMove("e2e4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unapply()
+	if b.ToFen() != Startpos {
+		t.Error("The board wasn't restored:", b.ToFen())
+	}
+}
@@ -12,61 +12,136 @@ import (
 )
 
 // The main API entrypoint. Generates all legal moves for a given board.
+// Move generation only reads the board, so goroutines may share one.
 func (b *Board) GenerateLegalMoves() ([]Move, bool) {
-	moves := make([]Move, 0, kDefaultMoveListLength)
+	var list MoveList
+	inCheck := b.GenerateLegalMovesInto(&list)
+	moves := append(make([]Move, 0, kDefaultMoveListLength), list.Slice()...)
+	return moves, inCheck
+}
+
+// Like GenerateLegalMoves, but describes each move, as Board.MoveInfo does.
+func (b *Board) GenerateLegalMoveInfos() ([]MoveInfo, bool) {
+	var list MoveList
+	inCheck := b.GenerateLegalMovesInto(&list)
+	infos := make([]MoveInfo, list.Count)
+	for i, m := range list.Slice() {
+		infos[i] = b.MoveInfo(m)
+	}
+	return infos, inCheck
+}
+
+// Like GenerateLegalMoves, but replaces the contents of a caller-owned list
+// rather than allocating one, and returns only whether we are in check.
+func (b *Board) GenerateLegalMovesInto(moves *MoveList) bool {
+	return b.generateMoves(moves, genAll)
+}
+
+// Generates the legal captures, en passant captures and promotions (including
+// quiet ones) into a caller-owned list, for quiescence search and staged move
+// ordering. Returns whether we are in check.
+func (b *Board) GenerateCaptures(moves *MoveList) bool {
+	return b.generateMoves(moves, genCaptures)
+}
+
+// Generates the legal moves that GenerateCaptures doesn't: non-capturing,
+// non-promoting moves, including castling. Returns whether we are in check.
+func (b *Board) GenerateQuiets(moves *MoveList) bool {
+	return b.generateMoves(moves, genQuiets)
+}
+
+// Generates the quiet moves (as in GenerateQuiets) that give check. Returns
+// whether we are in check.
+func (b *Board) GenerateQuietChecks(moves *MoveList) bool {
+	inCheck := b.generateMoves(moves, genQuiets)
+	quiets := moves.Count
+	moves.Count = 0
+	for _, move := range moves.Moves[:quiets] {
+		if b.GivesCheck(move) {
+			moves.push(move)
+		}
+	}
+	return inCheck
+}
+
+// Which legal moves generateMoves produces.
+type genKind uint8
+
+const (
+	genAll      genKind = iota
+	genCaptures         // captures, en passant and promotions
+	genQuiets           // everything else, including castling
+)
+
+// Generates the legal moves of a kind, replacing the contents of the list.
+func (b *Board) generateMoves(moves *MoveList, kind genKind) bool {
+	moves.Count = 0
 	// First, see if we are currently in check. If we are, invoke a special check-
 	// evasion move generator.
 	var kingLocation uint8
-	var ourPiecesPtr *Bitboards
+	var ourPiecesPtr, oppPiecesPtr *Bitboards
 	if b.Wtomove { // assumes only one king
 		kingLocation = uint8(bits.TrailingZeros64(b.White.Kings))
-		ourPiecesPtr = &(b.White)
+		ourPiecesPtr, oppPiecesPtr = &(b.White), &(b.Black)
 	} else {
 		kingLocation = uint8(bits.TrailingZeros64(b.Black.Kings))
-		ourPiecesPtr = &(b.Black)
+		ourPiecesPtr, oppPiecesPtr = &(b.Black), &(b.White)
+	}
+	// The squares that pieces may move to. Pawns are handled separately, since
+	// a promotion is never quiet and an en passant capture lands on an empty square.
+	targets, pushTargets := everything, everything
+	switch kind {
+	case genCaptures:
+		targets, pushTargets = oppPiecesPtr.All, RankMasks[0]|RankMasks[7]
+	case genQuiets:
+		targets, pushTargets = ^(ourPiecesPtr.All | oppPiecesPtr.All), ^(RankMasks[0] | RankMasks[7])
 	}
 	kingAttackers, blockerDestinations := b.countAttacks(b.Wtomove, kingLocation, 2)
 	if kingAttackers >= 2 { // Under multiple attack, we must move the king.
-		b.kingPushes(&moves, ourPiecesPtr)
-		return moves, true
+		b.kingPushes(moves, ourPiecesPtr, targets)
+		return true
 	}
 
 	// Several move types can work in single check, but we must block the check
 	if kingAttackers == 1 {
 		// calculate pinned pieces
-		pinnedPieces := b.generatePinnedMoves(&moves, blockerDestinations)
+		pinnedPieces := b.generatePinnedMoves(moves, blockerDestinations&targets, kind)
 		nonpinnedPieces := ^pinnedPieces
-		// TODO
-		b.pawnCaptures(&moves, nonpinnedPieces, blockerDestinations)
-		b.pawnPushes(&moves, nonpinnedPieces, blockerDestinations)
-		b.knightMoves(&moves, nonpinnedPieces, blockerDestinations)
-		b.rookMoves(&moves, nonpinnedPieces, blockerDestinations)
-		b.bishopMoves(&moves, nonpinnedPieces, blockerDestinations)
-		b.queenMoves(&moves, nonpinnedPieces, blockerDestinations)
-		b.kingPushes(&moves, ourPiecesPtr)
-		return moves, true
+		if kind != genQuiets {
+			b.pawnCaptures(moves, nonpinnedPieces, blockerDestinations)
+		}
+		b.pawnPushes(moves, nonpinnedPieces, blockerDestinations&pushTargets)
+		b.knightMoves(moves, nonpinnedPieces, blockerDestinations&targets)
+		b.rookMoves(moves, nonpinnedPieces, blockerDestinations&targets)
+		b.bishopMoves(moves, nonpinnedPieces, blockerDestinations&targets)
+		b.queenMoves(moves, nonpinnedPieces, blockerDestinations&targets)
+		b.kingPushes(moves, ourPiecesPtr, targets)
+		return true
 	}
 
 	// Then, calculate all the absolutely pinned pieces, and compute their moves.
 	// If we are in check, we can only move to squares that block the check.
-	pinnedPieces := b.generatePinnedMoves(&moves, everything)
+	pinnedPieces := b.generatePinnedMoves(moves, targets, kind)
 	nonpinnedPieces := ^pinnedPieces
 
 	// Finally, compute ordinary moves, ignoring absolutely pinned pieces on the board.
-	b.pawnPushes(&moves, nonpinnedPieces, everything)
-	b.pawnCaptures(&moves, nonpinnedPieces, everything)
-	b.knightMoves(&moves, nonpinnedPieces, everything)
-	b.rookMoves(&moves, nonpinnedPieces, everything)
-	b.bishopMoves(&moves, nonpinnedPieces, everything)
-	b.queenMoves(&moves, nonpinnedPieces, everything)
-	b.kingMoves(&moves)
-	return moves, false
+	b.pawnPushes(moves, nonpinnedPieces, pushTargets)
+	if kind != genQuiets {
+		b.pawnCaptures(moves, nonpinnedPieces, everything)
+	}
+	b.knightMoves(moves, nonpinnedPieces, targets)
+	b.rookMoves(moves, nonpinnedPieces, targets)
+	b.bishopMoves(moves, nonpinnedPieces, targets)
+	b.queenMoves(moves, nonpinnedPieces, targets)
+	b.kingMoves(moves, kind, targets)
+	return false
 }
 
 // Calculate the available moves for absolutely pinned pieces (pinned to the king).
 // We are only allowed to move to squares in allowDest, to block checks.
+// En passant captures are only generated for kinds that include captures.
 // Return a bitboard of all pieces that are pinned.
-func (b *Board) generatePinnedMoves(moveList *[]Move, allowDest uint64) uint64 {
+func (b *Board) generatePinnedMoves(moveList *MoveList, allowDest uint64, kind genKind) uint64 {
 	var ourKingIdx uint8
 	var ourPieces, oppPieces *Bitboards
 	var allPinnedPieces uint64 = 0
@@ -116,7 +191,8 @@ func (b *Board) generatePinnedMoves(moveList *[]Move, allowDest uint64) uint64 {
 				if pawnTargets != 0 { // single push worked; try double
 					pawnTargets |= (1 << uint8(int(pinnedPieceIdx)+16*pawnPushDirection)) & ^allPieces & doublePushRank
 				}
-				pawnTargets &= allowDest // TODO this might be a promotion. Is that possible?
+				// This is never a promotion: the pinning rook would block it.
+				pawnTargets &= allowDest
 				genMovesFromTargets(moveList, Square(pinnedPieceIdx), pawnTargets)
 			}
 			continue
@@ -164,15 +240,24 @@ func (b *Board) generatePinnedMoves(moveList *[]Move, allowDest uint64) uint64 {
 						for i := Piece(Knight); i <= Queen; i++ {
 							var move Move
 							move.Setfrom(Square(pinnedPieceIdx)).Setto(Square(currBishopIdx)).Setpromote(i)
-							*moveList = append(*moveList, move)
+							moveList.push(move)
 						}
 					} else { // no promotion
 						var move Move
 						move.Setfrom(Square(pinnedPieceIdx)).Setto(Square(currBishopIdx))
-						*moveList = append(*moveList, move)
+						moveList.push(move)
 					}
 				}
 			}
+			// An en passant capture may stay on the pin ray, eg: ...cxb3 by a
+			// pawn on c4, pinned to a king on g8 by a bishop on a2.
+			if kind != genQuiets && b.enpassant != 0 && pawnAttacks(pinnedPiece, b.Wtomove)&(uint64(1)<<b.enpassant) != 0 {
+				var move Move
+				move.Setfrom(Square(pinnedPieceIdx)).Setto(Square(b.enpassant))
+				if !b.enpassantLeavesCheck(move) {
+					moveList.push(move)
+				}
+			}
 			continue
 		}
 		// If it's not a bishop or queen, it can't move
@@ -191,7 +276,7 @@ func (b *Board) generatePinnedMoves(moveList *[]Move, allowDest uint64) uint64 {
 
 // Generate moves involving advancing pawns.
 // Only pieces marked nonpinned can be moved. Only squares in allowDest can be moved to.
-func (b *Board) pawnPushes(moveList *[]Move, nonpinned uint64, allowDest uint64) {
+func (b *Board) pawnPushes(moveList *MoveList, nonpinned uint64, allowDest uint64) {
 	targets, doubleTargets := b.pawnPushBitboards(nonpinned)
 	targets, doubleTargets = targets&allowDest, doubleTargets&allowDest
 	oneRankBack := 8
@@ -213,10 +298,10 @@ func (b *Board) pawnPushes(moveList *[]Move, nonpinned uint64, allowDest uint64)
 		if canPromote {
 			for i := Piece(Knight); i <= Queen; i++ {
 				move.Setpromote(i)
-				*moveList = append(*moveList, move)
+				moveList.push(move)
 			}
 		} else {
-			*moveList = append(*moveList, move)
+			moveList.push(move)
 		}
 	}
 	// push some pawns by two squares
@@ -225,7 +310,7 @@ func (b *Board) pawnPushes(moveList *[]Move, nonpinned uint64, allowDest uint64)
 		doubleTargets &= doubleTargets - 1 // unset the lowest active bit
 		var move Move
 		move.Setfrom(Square(doubleTarget + 2*oneRankBack)).Setto(Square(doubleTarget))
-		*moveList = append(*moveList, move)
+		moveList.push(move)
 	}
 }
 
@@ -246,7 +331,7 @@ func (b *Board) pawnPushBitboards(nonpinned uint64) (targets uint64, doubleTarge
 
 // A function that computes available pawn captures.
 // Only pieces marked nonpinned can be moved. Only squares in allowDest can be moved to.
-func (b *Board) pawnCaptures(moveList *[]Move, nonpinned uint64, allowDest uint64) {
+func (b *Board) pawnCaptures(moveList *MoveList, nonpinned uint64, allowDest uint64) {
 	east, west := b.pawnCaptureBitboards(nonpinned)
 	if b.enpassant > 0 { // always allow us to try en-passant captures
 		allowDest = allowDest | 1<<b.enpassant
@@ -270,49 +355,38 @@ func (b *Board) pawnCaptures(moveList *[]Move, nonpinned uint64, allowDest uint6
 				move.Setfrom(Square(target + (9 - (dir * 2))))
 				canPromote = target <= 7
 			}
-			if uint8(target) == b.enpassant && b.enpassant != 0 {
-				// Apply, check actual legality, then unapply
-				// Warning: not thread safe
-				var ourPieces, oppPieces *Bitboards
-				var enpassantEnemy uint8
-				if b.Wtomove {
-					enpassantEnemy = uint8(move.To()) - 8
-					ourPieces = &(b.White)
-					oppPieces = &(b.Black)
-				} else {
-					enpassantEnemy = uint8(move.To()) + 8
-					ourPieces = &(b.Black)
-					oppPieces = &(b.White)
-				}
-				ourPieces.Pawns &= ^(uint64(1) << move.From())
-				ourPieces.All &= ^(uint64(1) << move.From())
-				ourPieces.Pawns |= (uint64(1) << move.To())
-				ourPieces.All |= (uint64(1) << move.To())
-				oppPieces.Pawns &= ^(uint64(1) << enpassantEnemy)
-				oppPieces.All &= ^(uint64(1) << enpassantEnemy)
-				kingInCheck := b.OurKingInCheck()
-				ourPieces.Pawns |= (uint64(1) << move.From())
-				ourPieces.All |= (uint64(1) << move.From())
-				ourPieces.Pawns &= ^(uint64(1) << move.To())
-				ourPieces.All &= ^(uint64(1) << move.To())
-				oppPieces.Pawns |= (uint64(1) << enpassantEnemy)
-				oppPieces.All |= (uint64(1) << enpassantEnemy)
-				if kingInCheck {
-					continue
-				}
+			if uint8(target) == b.enpassant && b.enpassant != 0 && b.enpassantLeavesCheck(move) {
+				continue
 			}
 			if canPromote {
 				for i := Piece(Knight); i <= Queen; i++ {
 					move.Setpromote(i)
-					*moveList = append(*moveList, move)
+					moveList.push(move)
 				}
 				continue
 			}
-			*moveList = append(*moveList, move)
+			moveList.push(move)
 		}
 	}
 }
 
+// Whether an en passant capture would leave our king in check, as when the
+// capturing and captured pawns both leave a rank shared by our king and an
+// opponent rook.
+func (b *Board) enpassantLeavesCheck(move Move) bool {
+	var ourKing uint64
+	var enpassantEnemy uint8
+	if b.Wtomove {
+		enpassantEnemy = uint8(move.To()) - 8
+		ourKing = b.White.Kings
+	} else {
+		enpassantEnemy = uint8(move.To()) + 8
+		ourKing = b.Black.Kings
+	}
+	occupied := (b.White.All|b.Black.All)&^(uint64(1)<<move.From()|uint64(1)<<enpassantEnemy) | uint64(1)<<move.To()
+	return b.attackersTo(uint8(bits.TrailingZeros64(ourKing)), b.Wtomove, occupied) != 0
+}
+
 // A helper than generates bitboards for available pawn captures.
 func (b *Board) pawnCaptureBitboards(nonpinned uint64) (east uint64, west uint64) {
 	notHFile := uint64(0x7F7F7F7F7F7F7F7F)
@@ -339,7 +413,7 @@ func (b *Board) pawnCaptureBitboards(nonpinned uint64) (east uint64, west uint64
 
 // Generate all knight moves.
 // Only pieces marked nonpinned can be moved. Only squares in allowDest can be moved to.
-func (b *Board) knightMoves(moveList *[]Move, nonpinned uint64, allowDest uint64) {
+func (b *Board) knightMoves(moveList *MoveList, nonpinned uint64, allowDest uint64) {
 	var ourKnights, noFriendlyPieces uint64
 	if b.Wtomove {
 		ourKnights = b.White.Knights & nonpinned
@@ -357,83 +431,101 @@ func (b *Board) knightMoves(moveList *[]Move, nonpinned uint64, allowDest uint64
 }
 
 // Computes king moves without castling.
-func (b *Board) kingPushes(moveList *[]Move, ptrToOurBitboards *Bitboards) {
+// Only squares in allowDest can be moved to.
+func (b *Board) kingPushes(moveList *MoveList, ptrToOurBitboards *Bitboards, allowDest uint64) {
 	ourKingLocation := uint8(bits.TrailingZeros64(ptrToOurBitboards.Kings))
 	noFriendlyPieces := ^(ptrToOurBitboards.All)
 
-	// TODO(noahklein): Modifying the board is NOT thread-safe.
-	// We only do this to avoid the king danger problem, aka moving away from a
-	// checking slider.
-	oldKings := ptrToOurBitboards.Kings
-	ptrToOurBitboards.Kings = 0
-	ptrToOurBitboards.All &= ^(uint64(1) << ourKingLocation)
-	targets := kingMasks[ourKingLocation] & noFriendlyPieces
+	// Sliders see through our king, so that it can't move away from a checking
+	// slider along the line of the check (the king danger problem).
+	occupied := (b.White.All | b.Black.All) &^ (uint64(1) << ourKingLocation)
+	targets := kingMasks[ourKingLocation] & noFriendlyPieces & allowDest
 	for targets != 0 {
 		target := bits.TrailingZeros64(targets)
 		targets &= targets - 1
-		if b.UnderDirectAttack(b.Wtomove, uint8(target)) {
+		if b.attackersTo(uint8(target), b.Wtomove, occupied) != 0 {
 			continue
 		}
 		var move Move
 		move.Setfrom(Square(ourKingLocation)).Setto(Square(target))
-		*moveList = append(*moveList, move)
+		moveList.push(move)
 	}
-
-	ptrToOurBitboards.Kings = oldKings
-	ptrToOurBitboards.All |= (1 << ourKingLocation)
 }
 
 // Generate all available king moves.
 // First, if castling is possible, verifies the checking prohibitions on castling.
-// Then, outputs castling moves (if any), and king moves.
-// Not thread-safe, since the king is removed from the board to compute
-// king-danger squares.
-func (b *Board) kingMoves(moveList *[]Move) {
-	// castling
-	var ourKingLocation uint8
-	var canCastleQueenside, canCastleKingside bool
+// Then, outputs castling moves (if any, and if the kind includes quiet moves),
+// and king moves to squares in allowDest.
+func (b *Board) kingMoves(moveList *MoveList, kind genKind, allowDest uint64) {
 	var ptrToOurBitboards *Bitboards
-	allPieces := b.White.All | b.Black.All
+	var rank uint8
+	right := whiteKingside
 	if b.Wtomove {
-		ourKingLocation = uint8(bits.TrailingZeros64(b.White.Kings))
 		ptrToOurBitboards = &(b.White)
-		// To castle, we must have rights and a clear path
-		kingsideClear := allPieces&((1<<5)|(1<<6)) == 0
-		queensideClear := allPieces&((1<<3)|(1<<2)|(1<<1)) == 0
-		// skip the king square, since this won't be called while in check
-		canCastleQueenside = b.whiteCanCastleQueenside() &&
-			queensideClear && !b.anyUnderDirectAttack(true, 2, 3)
-		canCastleKingside = b.whiteCanCastleKingside() &&
-			kingsideClear && !b.anyUnderDirectAttack(true, 5, 6)
 	} else {
-		ourKingLocation = uint8(bits.TrailingZeros64(b.Black.Kings))
 		ptrToOurBitboards = &(b.Black)
-		kingsideClear := allPieces&((1<<61)|(1<<62)) == 0
-		queensideClear := allPieces&((1<<57)|(1<<58)|(1<<59)) == 0
-		// skip the king square, since this won't be called while in check
-		canCastleQueenside = b.blackCanCastleQueenside() &&
-			queensideClear && !b.anyUnderDirectAttack(false, 58, 59)
-		canCastleKingside = b.blackCanCastleKingside() &&
-			kingsideClear && !b.anyUnderDirectAttack(false, 61, 62)
-	}
-	if canCastleKingside {
-		var move Move
-		move.Setfrom(Square(ourKingLocation)).Setto(Square(ourKingLocation + 2))
-		*moveList = append(*moveList, move)
-	}
-	if canCastleQueenside {
-		var move Move
-		move.Setfrom(Square(ourKingLocation)).Setto(Square(ourKingLocation - 2))
-		*moveList = append(*moveList, move)
+		rank = 56
+		right = blackKingside
+	}
+	// castling, kingside first
+	if kind != genCaptures && b.castlerights&(3<<(right-1)) != 0 {
+		ourKingLocation := uint8(bits.TrailingZeros64(ptrToOurBitboards.Kings))
+		for _, r := range [2]int{right, right - 1} {
+			if b.castlerights&(1<<r) != 0 {
+				b.castlingMove(moveList, ourKingLocation, rank, r)
+			}
+		}
 	}
 
 	// non-castling
-	b.kingPushes(moveList, ptrToOurBitboards)
+	b.kingPushes(moveList, ptrToOurBitboards, allowDest)
+}
+
+// Adds the castling move for a right, if it is legal. The squares that the king
+// and rook pass over and land on must be empty, apart from the king and rook
+// themselves, and the squares the king passes over and lands on must not be
+// attacked; this won't be called while in check. The attacks are found with the
+// king and rook lifted, since in Chess960 the rook may shield its destination
+// square from a slider on the back rank.
+func (b *Board) castlingMove(moveList *MoveList, kingLocation, rank uint8, right int) {
+	if move, ok := b.legalCastlingMove(kingLocation, rank, right); ok {
+		moveList.push(move)
+	}
+}
+
+// The castling move for a right, as castlingMove generates it; false if the
+// right can't be used now.
+func (b *Board) legalCastlingMove(kingLocation, rank uint8, right int) (Move, bool) {
+	rookLocation := rank + b.rookFiles[right]
+	kingFile, rookFile := castlingTargets(right)
+	kingTarget, rookTarget := rank+kingFile, rank+rookFile
+	castlers := uint64(1)<<kingLocation | uint64(1)<<rookLocation
+	others := (b.White.All | b.Black.All) &^ castlers
+	if others&(rankSpan(kingLocation, kingTarget)|rankSpan(rookLocation, rookTarget)) != 0 {
+		return 0, false
+	}
+	kingPath := rankSpan(kingLocation, kingTarget)&^(uint64(1)<<kingLocation) | uint64(1)<<kingTarget
+	for kingPath != 0 {
+		sq := uint8(bits.TrailingZeros64(kingPath))
+		kingPath &= kingPath - 1
+		if b.attackersTo(sq, b.Wtomove, others) != 0 {
+			return 0, false
+		}
+	}
+	var move Move
+	move.Setfrom(Square(kingLocation))
+	// The two-square encoding is only unambiguous for a king on the e-file.
+	if b.Chess960 || kingLocation%8 != 4 || (rookLocation%8 != 0 && rookLocation%8 != 7) {
+		move.Setto(Square(rookLocation))
+	} else {
+		move.Setto(Square(kingTarget))
+	}
+	return move, true
 }
 
 // Generate all rook moves using magic bitboards.
 // Only pieces marked nonpinned can be moved. Only squares in allowDest can be moved to.
-func (b *Board) rookMoves(moveList *[]Move, nonpinned uint64, allowDest uint64) {
+func (b *Board) rookMoves(moveList *MoveList, nonpinned uint64, allowDest uint64) {
 	var ourRooks, friendlyPieces uint64
 	if b.Wtomove {
 		ourRooks = b.White.Rooks & nonpinned
@@ -453,7 +545,7 @@ func (b *Board) rookMoves(moveList *[]Move, nonpinned uint64, allowDest uint64)
 
 // Generate all bishop moves using magic bitboards.
 // Only pieces marked nonpinned can be moved. Only squares in allowDest can be moved to.
-func (b *Board) bishopMoves(moveList *[]Move, nonpinned uint64, allowDest uint64) {
+func (b *Board) bishopMoves(moveList *MoveList, nonpinned uint64, allowDest uint64) {
 	var ourBishops, friendlyPieces uint64
 	if b.Wtomove {
 		ourBishops = b.White.Bishops & nonpinned
@@ -473,7 +565,7 @@ func (b *Board) bishopMoves(moveList *[]Move, nonpinned uint64, allowDest uint64
 
 // Generate all queen moves using magic bitboards.
 // Only pieces marked nonpinned can be moved. Only squares in allowDest can be moved to.
-func (b *Board) queenMoves(moveList *[]Move, nonpinned uint64, allowDest uint64) {
+func (b *Board) queenMoves(moveList *MoveList, nonpinned uint64, allowDest uint64) {
 	var ourQueens, friendlyPieces uint64
 	if b.Wtomove {
 		ourQueens = b.White.Queens & nonpinned
@@ -496,13 +588,13 @@ func (b *Board) queenMoves(moveList *[]Move, nonpinned uint64, allowDest uint64)
 }
 
 // Helper: converts a targets bitboard into moves, and adds them to the moves list.
-func genMovesFromTargets(moveList *[]Move, origin Square, targets uint64) {
+func genMovesFromTargets(moveList *MoveList, origin Square, targets uint64) {
 	for targets != 0 {
 		target := bits.TrailingZeros64(targets)
 		targets &= targets - 1
 		var move Move
 		move.Setfrom(origin).Setto(Square(target))
-		*moveList = append(*moveList, move)
+		moveList.push(move)
 	}
 }
 
@@ -535,6 +627,24 @@ func (b *Board) UnderDirectAttack(byBlack bool, origin uint8) bool {
 	return count >= 1
 }
 
+// The opponent pieces attacking a square, as if only the occupied squares held
+// pieces. Pieces off the occupied squares don't attack, so this can answer what
+// is attacked after pieces move or are captured, without modifying the board.
+func (b *Board) attackersTo(origin uint8, byBlack bool, occupied uint64) uint64 {
+	var opponentPieces *Bitboards
+	if byBlack {
+		opponentPieces = &(b.Black)
+	} else {
+		opponentPieces = &(b.White)
+	}
+	attackers := knightMasks[origin]&opponentPieces.Knights |
+		kingMasks[origin]&opponentPieces.Kings |
+		pawnAttacks(uint64(1)<<origin, byBlack)&opponentPieces.Pawns |
+		CalculateBishopMoveBitboard(origin, occupied)&(opponentPieces.Bishops|opponentPieces.Queens) |
+		CalculateRookMoveBitboard(origin, occupied)&(opponentPieces.Rooks|opponentPieces.Queens)
+	return attackers & occupied
+}
+
 // Compute whether an individual square is under direct attack. Potentially expensive.
 // Can be asked to abort early, when a certain number of attacks are found.
 // The found number might exceed the abortion threshold, since attacks are grouped.
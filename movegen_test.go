@@ -3,6 +3,8 @@ package dragon
 import (
 	"fmt"
 	"math/bits"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -12,12 +14,12 @@ func TestPawnPushes(t *testing.T) {
 		"rnbqkbnr/ppp2pp1/3p4/4p3/3N1P2/P1n5/2PPP3/R1BQKBNR b KQkq - 0 0": 12,
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := ParseFen(k)
 		b.pawnPushes(&moves, everything, everything)
-		if len(moves) != v {
+		if moves.Count != v {
 			t.Error("Pawn pushes: wrong length. Expected", v, "but got",
-				len(moves), "for FEN", b.ToFen())
+				moves.Count, "for FEN", b.ToFen())
 		}
 	}
 }
@@ -29,12 +31,12 @@ func TestPawnCaptures(t *testing.T) {
 		"rnbqkbnr/ppp2pp1/3p4/4pP2/3N4/P1n5/2PPP3/R1BQKBNR w KQkq e6 0 0": 2,
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := ParseFen(k)
 		b.pawnCaptures(&moves, everything, everything)
-		if len(moves) != v {
+		if moves.Count != v {
 			t.Error("Pawn captures: wrong length. Expected", v, "but got",
-				len(moves), "for FEN", b.ToFen())
+				moves.Count, "for FEN", b.ToFen())
 		}
 	}
 }
@@ -62,18 +64,19 @@ func TestKnightPosition0(t *testing.T) {
 	whitepieces := Bitboards{Pawns: whitePawns, Knights: whiteKnights, All: whitePawns | whiteKnights}
 	blackpieces := Bitboards{Pawns: blackPawns, Knights: blackKnights, All: blackPawns | blackKnights}
 	testboard := Board{White: whitepieces, Black: blackpieces, Wtomove: true}
+	testboard.Sync()
 
-	moves := make([]Move, 0, 45)
+	var moves MoveList
 	testboard.knightMoves(&moves, everything, everything)
-	if len(moves) != 20 {
-		t.Error("Knight moves: wrong length. Expected 20, got", len(moves))
+	if moves.Count != 20 {
+		t.Error("Knight moves: wrong length. Expected 20, got", moves.Count)
 	}
 
 	testboard.Wtomove = false
-	moves2 := make([]Move, 0, 45)
+	var moves2 MoveList
 	testboard.knightMoves(&moves2, everything, everything)
-	if len(moves2) != 27 {
-		t.Error("Knight moves: wrong length. Expected 27, got", len(moves2))
+	if moves2.Count != 27 {
+		t.Error("Knight moves: wrong length. Expected 27, got", moves2.Count)
 	}
 }
 
@@ -89,12 +92,12 @@ func TestKingPositions(t *testing.T) {
 		"4k3/8/8/8/8/8/8/4K1NR w K - 0 0":                             5, // short castle blocked
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := ParseFen(k)
-		b.kingMoves(&moves)
-		if len(moves) != v {
+		b.kingMoves(&moves, genAll, everything)
+		if moves.Count != v {
 			t.Error("King moves: wrong length. Expected", v, "but got",
-				len(moves), "\nFor position:", k)
+				moves.Count, "\nFor position:", k)
 		}
 	}
 }
@@ -111,11 +114,11 @@ func TestRookPositions(t *testing.T) {
 		"8/8/8/3r4/8/8/8/8 b KQkq -":                            14,
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := ParseFen(k)
 		b.rookMoves(&moves, everything, everything)
-		if len(moves) != v {
-			t.Error("Rook moves: wrong length. Expected", v, "but got", len(moves))
+		if moves.Count != v {
+			t.Error("Rook moves: wrong length. Expected", v, "but got", moves.Count)
 		}
 	}
 }
@@ -128,11 +131,11 @@ func TestBishopPositions(t *testing.T) {
 		"rnbqkb1r/pp2pppp/8/4P3/5bN1/8/PPP2PPP/RNBQKBNR b KQkq -": 12,
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := ParseFen(k)
 		b.bishopMoves(&moves, everything, everything)
-		if len(moves) != v {
-			t.Error("Bishop moves: wrong length. Expected", v, "but got", len(moves))
+		if moves.Count != v {
+			t.Error("Bishop moves: wrong length. Expected", v, "but got", moves.Count)
 		}
 	}
 }
@@ -145,11 +148,11 @@ func TestQueenPositions(t *testing.T) {
 		"6nq/6p1/2B4n/1rB2r1R/5q2/2P5/1Q4n1/2B5 b - -":         21,
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := ParseFen(k)
 		b.queenMoves(&moves, everything, everything)
-		if len(moves) != v {
-			t.Error("Queen moves: wrong length. Expected", v, "but got", len(moves))
+		if moves.Count != v {
+			t.Error("Queen moves: wrong length. Expected", v, "but got", moves.Count)
 		}
 	}
 }
@@ -229,11 +232,11 @@ func TestPinnedBishop(t *testing.T) {
 		"4k3/3b1b2/2Q3Q1/8/8/8/8/4K3 b - - 0 0": 2, // two close pins
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := ParseFen(k)
-		b.generatePinnedMoves(&moves, everything)
-		if len(moves) != v {
-			t.Error("Legal moves for pinned bishops: wrong length. Expected", v, "but got", len(moves), "for position", b.ToFen())
+		b.generatePinnedMoves(&moves, everything, genAll)
+		if moves.Count != v {
+			t.Error("Legal moves for pinned bishops: wrong length. Expected", v, "but got", moves.Count, "for position", b.ToFen())
 		}
 	}
 }
@@ -244,11 +247,11 @@ func TestPinnedKnight(t *testing.T) {
 		"4k3/8/8/8/1q6/2N5/8/4K3 w - - 0 0":     0, // normal pin
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := ParseFen(k)
-		b.generatePinnedMoves(&moves, everything)
-		if len(moves) != v {
-			t.Error("Legal moves for pinned bishops: wrong length. Expected", v, "but got", len(moves), "for position", b.ToFen())
+		b.generatePinnedMoves(&moves, everything, genAll)
+		if moves.Count != v {
+			t.Error("Legal moves for pinned bishops: wrong length. Expected", v, "but got", moves.Count, "for position", b.ToFen())
 		}
 	}
 }
@@ -259,11 +262,11 @@ func TestPinnedQueen(t *testing.T) {
 		"4k3/8/4r3/4Q3/1q6/2Q5/8/4K3 w - - 0 0": 6,
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := ParseFen(k)
-		b.generatePinnedMoves(&moves, everything)
-		if len(moves) != v {
-			t.Error("Legal moves for pinned bishops: wrong length. Expected", v, "but got", len(moves), "for position", b.ToFen())
+		b.generatePinnedMoves(&moves, everything, genAll)
+		if moves.Count != v {
+			t.Error("Legal moves for pinned bishops: wrong length. Expected", v, "but got", moves.Count, "for position", b.ToFen())
 		}
 	}
 }
@@ -292,11 +295,11 @@ func TestDiagPins(t *testing.T) {
 		"4k3/8/8/b7/7q/6P1/8/4K3 w - - 0 0":         algebraicToIndexFatal("g3"),
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := ParseFen(k)
-		result := b.generatePinnedMoves(&moves, everything)
-		if len(moves) != v {
-			t.Error("Legal moves for diagonal pins: wrong length. Expected", v, "but got", len(moves), "for position", b.ToFen())
+		result := b.generatePinnedMoves(&moves, everything, genAll)
+		if moves.Count != v {
+			t.Error("Legal moves for diagonal pins: wrong length. Expected", v, "but got", moves.Count, "for position", b.ToFen())
 		}
 		if pinLocs[k] == 64 {
 			if result != 0 {
@@ -314,6 +317,7 @@ func TestTrickyCornerCases(t *testing.T) {
 	positions := map[string]int{
 		"8/8/8/8/k1Pp3Q/8/8/2K5 b - c3 0 0":  5, // e.p. capture into check
 		"8/8/8/8/1kPp4/8/8/2K1B3 b - c3 0 0": 6, // e.p. breaks check
+		"6k1/8/8/8/1Pp5/8/Q7/6K1 b - b3 0 0": 6, // e.p. along a pin
 	}
 	for k, v := range positions {
 		b := ParseFen(k)
@@ -355,12 +359,12 @@ func TestOrthoPins(t *testing.T) {
 		"rnbqkbnr/ppp1pppp/4Q3/8/4p3/8/PPPP1PPP/RNB1KBNR b KQkq - 0 3": algebraicToIndexFatal("e7"), // pawn is pinned with double pawn in file
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := ParseFen(k)
-		result := b.generatePinnedMoves(&moves, everything)
-		if len(moves) != v {
-			t.Error("Legal moves for orthogonal pins: wrong length. Expected", v, "but got", len(moves), "for position", b.ToFen())
-			printMoves(moves)
+		result := b.generatePinnedMoves(&moves, everything, genAll)
+		if moves.Count != v {
+			t.Error("Legal moves for orthogonal pins: wrong length. Expected", v, "but got", moves.Count, "for position", b.ToFen())
+			printMoves(moves.Slice())
 		}
 		if pinLocs[k] == 64 {
 			if result != 0 {
@@ -372,6 +376,54 @@ func TestOrthoPins(t *testing.T) {
 	}
 }
 
+func TestChess960Castling(t *testing.T) {
+	positions := map[string]string{ // castling moves, kingside first
+		"4k3/8/8/8/8/8/8/R3K2R w KQ - 0 0":                                  "e1g1 e1c1",
+		"4k3/8/8/8/8/8/8/R3K2R w HA - 0 0":                                  "e1h1 e1a1", // Shredder-FEN implies Chess960
+		"4k3/8/8/8/8/8/8/1R2K2R w KQ - 0 0":                                 "e1h1 e1b1",
+		"4k3/8/8/8/8/8/8/5KR1 w K - 0 0":                                    "f1g1", // king and rook swap
+		"4k3/8/8/8/8/8/8/6KR w K - 0 0":                                     "g1h1", // only the rook moves
+		"4k3/8/8/8/8/8/8/rR3K2 w Q - 0 0":                                   "",     // the rook shields the king's destination
+		"4k3/8/8/8/8/8/8/R4KRr w KQ - 0 0":                                  "f1a1", // the rook shields the king's destination
+		"4k3/8/8/8/8/8/8/qR4KR w KQ - 0 0":                                  "g1h1", // the other rook still shields the king
+		"4k3/8/8/8/8/8/8/1R3K1r w Q - 0 0":                                  "",     // in check
+		"4k3/8/8/8/8/8/8/RR2K3 w B - 0 0":                                   "e1b1", // the inner rook
+		"4k3/8/8/8/8/8/8/R1N1K3 w Q - 0 0":                                  "",
+		"2r1k3/8/8/8/8/8/8/R2K4 w Q - 0 0":                                  "", // the king's destination is attacked
+		"4k3/8/7b/8/8/8/8/1R4KR w KQ - 0 0":                                 "g1h1",
+		"4k3/8/8/8/8/5b2/8/1R4KR w KQ - 0 0":                                "g1h1", // the king would pass through check
+		"4k3/8/8/8/8/8/3r4/R4KR1 w KQ - 0 0":                                "f1g1",
+		"1r1bk3/8/8/8/8/8/8/1R2K3 b b - 0 0":                                "", // the rook's destination is occupied
+		"1r2k1r1/8/8/8/8/8/8/4K3 b kq - 0 0":                                "e8g8 e8b8",
+		"1rk5/8/8/8/8/8/8/4K3 b q - 0 0":                                    "c8b8",
+		"r1k4b/8/8/8/8/8/8/4K3 b q - 0 0":                                   "c8a8",
+		"4k3/8/8/8/8/8/8/R4K1R w KQ - 0 0":                                  "f1h1 f1a1",
+		"4k3/8/8/8/8/8/8/R4KR1 w KQ - 0 0":                                  "f1g1 f1a1",
+		"4k3/8/8/8/8/8/8/RK5R w KQ - 0 0":                                   "b1h1 b1a1",
+		"4k3/8/8/8/8/8/8/R5KR w KQ - 0 0":                                   "g1h1 g1a1",
+		"4k3/8/8/8/8/8/8/R1b3KR w KQ - 0 0":                                 "g1h1",
+		"4k3/8/8/8/8/8/8/1R1b2KR w KQ - 0 0":                                "g1h1",
+		"3k4/8/8/8/8/8/8/RKR5 w KQ - 0 0":                                   "b1c1", // the other rook is in the way
+		"3k4/8/8/8/8/8/8/1R4KR w B - 0 0":                                   "g1b1",
+		"3k4/8/8/8/8/8/8/1RK4R w KQ - 0 0":                                  "c1h1 c1b1",
+		"3k4/8/8/8/8/8/8/1RKB3R w HB - 0 0":                                 "",
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9": "",
+	}
+	for fen, want := range positions {
+		b := ParseFen(fen)
+		moves, _ := b.GenerateLegalMoves()
+		var castles []string
+		for _, m := range moves {
+			if _, ok := b.castlingRight(m); ok {
+				castles = append(castles, m.String())
+			}
+		}
+		if got := strings.Join(castles, " "); got != want {
+			t.Errorf("Castling moves for %v: got %q, expected %q", fen, got, want)
+		}
+	}
+}
+
 func TestCountAttacks(t *testing.T) {
 	b := ParseFen("3B4/8/1k4Rq/P1pP1P2/8/2p5/3K3r/1n2b3 w - c6 0 0")
 	b2 := ParseFen("3B4/8/1k4Rq/P1pP1P2/8/2p5/3K3r/1n2b3 b - - 0 0")
@@ -542,3 +594,115 @@ func TestLegalMoves(t *testing.T) {
 		}
 	}
 }
+
+func TestGenerateLegalMovesInto(t *testing.T) {
+	positions := map[string]int{
+		Startpos: 20,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0": 48,
+		"4k3/8/8/8/1b6/8/8/R3K2R w KQ - 0 0":                                   4,   // check
+		"4k3/8/8/8/1b6/8/4r3/R3K2R w KQ - 0 0":                                 3,   // double check
+		"R6R/3Q4/1Q4Q1/4Q3/2Q4Q/Q4Q2/pp1Q4/kBNN1KB1 w - - 0 1":                 218, // the most moves known
+	}
+	var list MoveList
+	list.Count = 7 // generation replaces stale contents
+	for fen, v := range positions {
+		b := ParseFen(fen)
+		moves, inCheck := b.GenerateLegalMoves()
+		if b.GenerateLegalMovesInto(&list) != inCheck || list.Count != v || len(moves) != v {
+			t.Error("Wrong moves for", fen, "expected", v, "but got", list.Count)
+			continue
+		}
+		for i, m := range list.Slice() {
+			if moves[i] != m {
+				t.Error("Moves differ from GenerateLegalMoves for", fen, "at", i)
+			}
+		}
+		if allocs := testing.AllocsPerRun(10, func() { b.GenerateLegalMovesInto(&list) }); allocs != 0 {
+			t.Error("Generating moves into a list allocated", allocs, "times for", fen)
+		}
+	}
+}
+
+func TestMoveInfo(t *testing.T) {
+	cases := []struct {
+		fen, move         string
+		piece, captured   Piece
+		castle, ep, push2 bool
+	}{
+		{Startpos, "g1f3", Knight, Nothing, false, false, false},
+		{Startpos, "e2e4", Pawn, Nothing, false, false, true},
+		{Startpos, "e2e3", Pawn, Nothing, false, false, false},
+		{"r3k3/1ppp1ppr/8/3Pp3/8/8/1PP1PPPP/R3K2R w - e6 3 0", "d5e6", Pawn, Pawn, false, true, false},
+		{"r3k3/1ppp1ppr/8/8/2Pp4/8/1P2PPPP/R3K2R b - c3 0 0", "d4c3", Pawn, Pawn, false, true, false},
+		{"r3k1Q1/1pp5/4N3/3br3/8/2p3n1/1p2PP2/R1B1K2n b - - 0 0", "b2c1b", Pawn, Bishop, false, false, false},
+		{"r3k1Q1/1pp2p2/4Nk2/3br3/8/2p3n1/4PP2/R1b1K2n b - - 0 0", "f6e6", King, Knight, false, false, false},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0", "e1c1", King, Nothing, true, false, false},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0", "e1d1", King, Nothing, false, false, false},
+		{"4k3/8/8/8/8/8/8/RR2K3 w B - 0 0", "e1b1", King, Nothing, true, false, false}, // Chess960
+	}
+	for _, c := range cases {
+		b := ParseFen(c.fen)
+		m := parseMove(c.move)
+		info := b.MoveInfo(m)
+		if info.Move() != m || info.Piece() != c.piece || info.Captured() != c.captured || info.IsCapture() != (c.captured != Nothing) ||
+			info.IsCastle() != c.castle || info.IsEnPassant() != c.ep || info.IsDoublePush() != c.push2 ||
+			info.IsPromotion() != (m.Promote() != Nothing) {
+			t.Errorf("Wrong info for %s in %s: piece %v, captured %v, castle %v, e.p. %v, double push %v",
+				c.move, c.fen, info.Piece(), info.Captured(), info.IsCastle(), info.IsEnPassant(), info.IsDoublePush())
+		}
+		if parsed, err := ParseMove(info.String()); err != nil || parsed != m {
+			t.Error("MoveInfo didn't round trip:", info.String())
+		}
+	}
+
+	// The generator's infos agree with its moves and with IsCapture.
+	b := ParseFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0")
+	moves, _ := b.GenerateLegalMoves()
+	infos, _ := b.GenerateLegalMoveInfos()
+	if len(infos) != len(moves) {
+		t.Fatal("Wrong number of move infos:", len(infos))
+	}
+	for i, info := range infos {
+		if info.Move() != moves[i] || info.IsCapture() != IsCapture(moves[i], &b) {
+			t.Error("Wrong info for", &moves[i])
+		}
+	}
+}
+
+// Move generation only reads the board, so goroutines can share one. Run with
+// -race to check.
+func TestConcurrentMoveGeneration(t *testing.T) {
+	fens := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0", // castling
+		"8/8/8/K2pP2r/8/8/8/7k w - d6 0 0",                                     // en passant exposing the king
+		"6k1/8/8/8/1Pp5/8/Q7/6K1 b - b3 0 0",                                   // en passant along a pin
+		"4k3/8/8/8/8/8/4r3/R3K2R w KQ - 0 0",                                   // king danger behind the king
+		"1r2k1r1/8/8/8/8/8/8/RK4R1 w GAg - 0 1",                                // Chess960 castling
+	}
+	for _, fen := range fens {
+		b := ParseFen(fen)
+		want, wantCheck := b.GenerateLegalMoves()
+		var wg sync.WaitGroup
+		for g := 0; g < 16; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var list MoveList
+				for i := 0; i < 200; i++ {
+					inCheck := b.GenerateLegalMovesInto(&list)
+					if inCheck != wantCheck || b.OurKingInCheck() != wantCheck || list.Count != len(want) {
+						t.Error("Concurrent move generation differs for", fen)
+						return
+					}
+					b.GenerateCaptures(&list)
+					b.GenerateQuiets(&list)
+					b.UnderDirectAttack(!b.Wtomove, 27)
+				}
+			}()
+		}
+		wg.Wait()
+		if before := ParseFen(fen); b.ToFen() != before.ToFen() {
+			t.Error("Move generation modified the board:", b.ToFen())
+		}
+	}
+}
@@ -1,33 +1,263 @@
 package dragon
 
-import "fmt"
+import (
+	"context"
+	"math/bits"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
 
 // Run perft to count the number of moves.
 // Useful for testing and benchmarking.
 func Perft(b *Board, n int) int64 {
+	return perft(b, n, nil, nil)
+}
+
+// Like Perft, but splits the root moves between a number of goroutines, each
+// with its own copy of the board. If workers is zero or less, there is one
+// per CPU.
+func PerftParallel(b *Board, n int, workers int) int64 {
+	count, _ := perftParallel(context.Background(), b, n, workers, nil)
+	return count
+}
+
+// Like PerftParallel, but gives up with the context's error if it is cancelled
+// or times out before the count is finished.
+func PerftParallelContext(ctx context.Context, b *Board, n int, workers int) (int64, error) {
+	return perftParallel(ctx, b, n, workers, nil)
+}
+
+// Counts the leaves of a perft tree, using and filling the table if it isn't
+// nil. Once stop is set, the count is abandoned: it returns early, and
+// incomplete counts are not stored.
+func perft(b *Board, n int, t *PerftTable, stop *uint32) int64 {
 	if n <= 0 {
 		return 1
 	}
-	moves, _ := b.GenerateLegalMoves()
+	if count, ok := t.probe(b.Hash(), n); ok {
+		return count
+	}
+	var moves MoveList
+	b.GenerateLegalMovesInto(&moves)
 	if n == 1 {
-		return int64(len(moves))
+		return int64(moves.Count)
+	}
+	if stop != nil && atomic.LoadUint32(stop) != 0 {
+		return 0
 	}
 	var count int64 = 0
-	for _, move := range moves {
-		unapply := b.Apply(move)
-		count += Perft(b, n-1)
-		unapply()
+	for _, move := range moves.Slice() {
+		var undo Undo
+		b.MakeMove(move, &undo)
+		count += perft(b, n-1, t, stop)
+		b.UnmakeMove(move, &undo)
+	}
+	if stop == nil || atomic.LoadUint32(stop) == 0 {
+		t.store(b.Hash(), n, count)
 	}
 	return int64(count)
 }
 
-// Performs the Perft move count division operation. Useful for debugging.
-func Divide(b *Board, n int) {
+func perftParallel(ctx context.Context, b *Board, n int, workers int, t *PerftTable) (int64, error) {
+	if n <= 1 {
+		return perft(b, n, t, nil), nil
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	moves, _ := b.GenerateLegalMoves()
+	next := make(chan Move, len(moves))
+	for _, move := range moves {
+		next <- move
+	}
+	close(next)
+	var count int64
+	var stop uint32
+	var wg sync.WaitGroup
+	for i := 0; i < workers && i < len(moves); i++ {
+		wg.Add(1)
+		go func(local Board) {
+			defer wg.Done()
+			for move := range next {
+				var undo Undo
+				local.MakeMove(move, &undo)
+				atomic.AddInt64(&count, perft(&local, n-1, t, &stop))
+				local.UnmakeMove(move, &undo)
+			}
+		}(*b)
+	}
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		atomic.StoreUint32(&stop, 1)
+		<-finished
+	}
+	if atomic.LoadUint32(&stop) != 0 {
+		return 0, ctx.Err()
+	}
+	return count, nil
+}
+
+// A perft hash table caches the node counts of subtrees by Board.Hash and
+// depth, so that transpositions are only counted once. It has a fixed size,
+// and is safe for concurrent use without locking: as in the search package's
+// transposition table, each slot stores its key XORed with its data, so a slot
+// torn by concurrent writes is treated as a miss.
+type PerftTable struct {
+	slots []perftSlot
+	mask  uint64
+}
+
+type perftSlot struct {
+	key  uint64 // hash ^ data
+	data uint64 // the node count, then 8 bits of depth; zero if empty
+}
+
+// Creates a perft hash table of at most the given size in megabytes, and at
+// least one slot.
+func NewPerftTable(megabytes int) *PerftTable {
+	n := uint64(1)
+	for (n*2)*16 <= uint64(megabytes)<<20 {
+		n *= 2
+	}
+	return &PerftTable{slots: make([]perftSlot, n), mask: n - 1}
+}
+
+// Counts the leaves of a perft tree, as Perft does, using the table.
+func (t *PerftTable) Perft(b *Board, n int) int64 {
+	return perft(b, n, t, nil)
+}
+
+// Counts the leaves of a perft tree, as PerftParallel does, using the table.
+// The goroutines share the table.
+func (t *PerftTable) PerftParallel(b *Board, n int, workers int) int64 {
+	count, _ := perftParallel(context.Background(), b, n, workers, t)
+	return count
+}
+
+// Counts the leaves of a perft tree, as PerftParallelContext does, using the
+// table. An abandoned count leaves only complete subtree counts in the table.
+func (t *PerftTable) PerftParallelContext(ctx context.Context, b *Board, n int, workers int) (int64, error) {
+	return perftParallel(ctx, b, n, workers, t)
+}
+
+// The same position at different depths uses different slots.
+func (t *PerftTable) slot(hash uint64, n int) *perftSlot {
+	return &t.slots[(hash+uint64(n))&t.mask]
+}
+
+func (t *PerftTable) probe(hash uint64, n int) (int64, bool) {
+	if t == nil || n < 2 {
+		return 0, false
+	}
+	s := t.slot(hash, n)
+	key, data := atomic.LoadUint64(&s.key), atomic.LoadUint64(&s.data)
+	if data != 0 && key^data == hash && int(uint8(data)) == n {
+		return int64(data >> 8), true
+	}
+	return 0, false
+}
+
+func (t *PerftTable) store(hash uint64, n int, count int64) {
+	if t == nil || n < 2 || n > 255 {
+		return
+	}
+	s := t.slot(hash, n)
+	data := uint64(count)<<8 | uint64(n)
+	atomic.StoreUint64(&s.data, data)
+	atomic.StoreUint64(&s.key, hash^data)
+}
+
+// Perft statistics for the moves at one depth, as tabulated on the Chess
+// Programming Wiki. Captures include en passant captures; checks include
+// discovered and double checks, but as in the wiki, double checks aren't also
+// counted as discovered checks.
+type PerftCounts struct {
+	Nodes            int64
+	Captures         int64
+	EnPassant        int64
+	Castles          int64
+	Promotions       int64
+	Checks           int64
+	DiscoveredChecks int64 // single checks by a piece other than the one that moved
+	DoubleChecks     int64
+	Checkmates       int64
+}
+
+// Runs perft, classifying the moves made at each depth. The counts for depth
+// d are at index d-1.
+func PerftStats(b *Board, n int) []PerftCounts {
+	if n <= 0 {
+		return nil
+	}
+	stats := make([]PerftCounts, n)
+	perftStats(b, stats)
+	return stats
+}
+
+func perftStats(b *Board, stats []PerftCounts) {
+	var moves MoveList
+	b.GenerateLegalMovesInto(&moves)
+	counts := &stats[0]
+	for _, move := range moves.Slice() {
+		counts.Nodes++
+		// The squares of the pieces that moved, to tell discovered checks.
+		moved := uint64(1) << move.To()
+		info := b.MoveInfo(move)
+		if info.IsCastle() {
+			counts.Castles++
+			right, _ := b.castlingRight(move)
+			rank := move.From() &^ 7
+			kingFile, rookFile := castlingTargets(right)
+			moved = uint64(1)<<(rank+kingFile) | uint64(1)<<(rank+rookFile)
+		} else if info.IsCapture() {
+			counts.Captures++
+			if info.IsEnPassant() {
+				counts.EnPassant++
+			}
+		}
+		if info.IsPromotion() {
+			counts.Promotions++
+		}
+		var undo Undo
+		b.MakeMove(move, &undo)
+		checkers := b.Checkers()
+		if checkers != 0 {
+			counts.Checks++
+			if bits.OnesCount64(checkers) > 1 {
+				counts.DoubleChecks++
+			} else if checkers&^moved != 0 {
+				counts.DiscoveredChecks++
+			}
+			var replies MoveList
+			if b.GenerateLegalMovesInto(&replies); replies.Count == 0 {
+				counts.Checkmates++
+			}
+		}
+		if len(stats) > 1 {
+			perftStats(b, stats[1:])
+		}
+		b.UnmakeMove(move, &undo)
+	}
+}
+
+// Performs the Perft move count division operation: counts the leaves of the
+// perft tree under each legal move. Useful for debugging, by comparing the
+// counts with those of another move generator.
+func Divide(b *Board, n int) map[Move]int64 {
 	moves, _ := b.GenerateLegalMoves()
+	counts := make(map[Move]int64, len(moves))
 	for _, move := range moves {
-		unapply := b.Apply(move)
-		result := Perft(b, n-1)
-		unapply()
-		fmt.Printf( /*"Move   #%3d:   "*/ "%-6s =%9d\n" /*i+1, */, &move, result)
+		var undo Undo
+		b.MakeMove(move, &undo)
+		counts[move] = Perft(b, n-1)
+		b.UnmakeMove(move, &undo)
 	}
+	return counts
 }
@@ -1,7 +1,10 @@
 package dragon
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 )
 
 // -----
@@ -9,8 +12,26 @@ import (
 // -----
 
 func TestDivide(t *testing.T) {
-	b := ParseFen("nqn5/P1Pk4/8/8/8/6K1/7p/5N2 w - - 0 1")
-	Divide(&b, 1)
+	b := ParseFen(Startpos)
+	counts := Divide(&b, 3)
+	var total int64
+	for _, count := range counts {
+		total += count
+	}
+	if len(counts) != 20 || total != 8902 {
+		t.Error("Divide found", len(counts), "moves and", total, "nodes, expected 20 and 8902")
+	}
+	for move, want := range map[string]int64{"e2e4": 600, "a2a3": 380, "g1f3": 440, "b1c3": 440} {
+		if got := counts[parseMove(move)]; got != want {
+			t.Error("Divide of", move, "is", got, "expected", want)
+		}
+	}
+	b = ParseFen("nqn5/P1Pk4/8/8/8/6K1/7p/5N2 w - - 0 1")
+	for move, count := range Divide(&b, 1) {
+		if count != 1 {
+			t.Error("Divide to depth 1 of", &move, "is", count)
+		}
+	}
 }
 
 // Uncomment lines in the solution maps for more thorough testing, although this takes longer
@@ -118,6 +139,46 @@ func TestPromotions(t *testing.T) {
 	checkPerftResults(pos, perftSolutions, t)
 }
 
+// Positions from the published Chess960 perft suite. Deeper results are given
+// in comments, as they take longer.
+func TestChess960Positions(t *testing.T) {
+	suite := map[string]map[int]int64{
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9": {
+			1: 21, 2: 528, 3: 12189, 4: 326672, // 5: 8146062,
+		},
+		"2nnrbkr/p1qppppp/8/1ppb4/6PP/3PP3/PPP2P2/BQNNRBKR w HEhe - 1 9": {
+			1: 21, 2: 807, 3: 18002, 4: 667366, // 5: 16253601,
+		},
+		"b1q1rrkb/pppppppp/3nn3/8/P7/1PPP4/4PPPP/BQNNRKRB w GE - 1 9": {
+			1: 20, 2: 479, 3: 10471, 4: 273318, // 5: 6417013,
+		},
+		"qbbnnrkr/2pp2pp/p7/1p2pp2/8/P3PP2/1PPP1KPP/QBBNNR1R w hf - 0 9": {
+			1: 22, 2: 593, 3: 13440, 4: 382958, // 5: 9183776,
+		},
+		"1nbbnrkr/p1p1ppp1/3p4/1p3P1p/3Pq2P/8/PPP1P1P1/QNBBNRKR w HFhf - 0 9": {
+			1: 28, 2: 1120, 3: 31058, 4: 1171749, // 5: 34030312,
+		},
+		"qnbnr1kr/ppp1b1pp/4p3/3p1p2/8/2NPP3/PPP1BPPP/QNB1R1KR w HEhe - 1 9": {
+			1: 29, 2: 899, 3: 26578, 4: 824055, // 5: 24851983,
+		},
+		"q1bnrkr1/ppppp2p/2n2p2/4b1p1/2NP4/8/PPP1PPPP/QNB1RRKB w ge - 1 9": {
+			1: 30, 2: 860, 3: 24566, 4: 732757, // 5: 21093346,
+		},
+		"qbn1brkr/ppp1p1p1/2n4p/3p1p2/P7/6PP/QPPPPP2/1BNNBRKR w HFhf - 0 9": {
+			1: 25, 2: 635, 3: 17054, 4: 465806, // 5: 13203304,
+		},
+		"qnnbbrkr/1p2ppp1/2pp3p/p7/1P5P/2NP4/P1P1PPP1/Q1NBBRKR w HFhf - 0 9": {
+			1: 24, 2: 572, 3: 15243, 4: 384260, // 5: 11110203,
+		},
+		"qn1rbbkr/ppp2p1p/1n1pp1p1/8/3P4/P6P/1PP1PPPK/QNNRBB1R w hd - 2 9": {
+			1: 28, 2: 811, 3: 23175, 4: 679699, // 5: 19836606,
+		},
+	}
+	for fen, perftSolutions := range suite {
+		checkPerftResults(fen, perftSolutions, t)
+	}
+}
+
 func checkPerftResults(fen string, perftSolutions map[int]int64, t *testing.T) {
 	b := ParseFen(fen)
 	for i := 1; i <= len(perftSolutions); i++ {
@@ -133,3 +194,171 @@ func checkPerftResults(fen string, perftSolutions map[int]int64, t *testing.T) {
 		}
 	}
 }
+
+// Checks at every node of a perft tree that GenerateCaptures and GenerateQuiets
+// partition the legal moves exactly, and that GenerateQuietChecks finds exactly
+// the quiet moves that give check. Returns the number of leaves, counted from
+// the captures and quiets.
+func perftPartition(b *Board, n int, t *testing.T) int64 {
+	if n <= 0 {
+		return 1
+	}
+	var all, captures, quiets, checks MoveList
+	inCheck := b.GenerateLegalMovesInto(&all)
+	if b.GenerateCaptures(&captures) != inCheck || b.GenerateQuiets(&quiets) != inCheck ||
+		b.GenerateQuietChecks(&checks) != inCheck {
+		t.Fatal("Staged generators disagree on check in", b.ToFen())
+	}
+	seen := make(map[Move]int)
+	for _, m := range all.Slice() {
+		seen[m]++
+	}
+	for _, m := range captures.Slice() {
+		enpassant := m.To() == b.enpassant && b.enpassant != 0 && (uint64(1)<<m.From())&(b.White.Pawns|b.Black.Pawns) != 0
+		if !IsCapture(m, b) && !enpassant && m.Promote() == Nothing {
+			t.Fatal("Quiet move", &m, "generated as a capture in", b.ToFen())
+		}
+		seen[m]--
+	}
+	givesCheck := make(map[Move]bool)
+	for _, m := range quiets.Slice() {
+		if IsCapture(m, b) || m.Promote() != Nothing {
+			t.Fatal("Capture", &m, "generated as a quiet move in", b.ToFen())
+		}
+		seen[m]--
+		unapply := b.Apply(m)
+		givesCheck[m] = b.OurKingInCheck()
+		unapply()
+	}
+	for m, count := range seen {
+		if count != 0 {
+			t.Fatal("Captures and quiets don't partition the legal moves at", &m, "in", b.ToFen())
+		}
+	}
+	for _, m := range checks.Slice() {
+		if !givesCheck[m] {
+			t.Fatal("Quiet check", &m, "doesn't give check in", b.ToFen())
+		}
+		delete(givesCheck, m)
+	}
+	for m, check := range givesCheck {
+		if check {
+			t.Fatal("Missing quiet check", &m, "in", b.ToFen())
+		}
+	}
+	if n == 1 {
+		return int64(captures.Count + quiets.Count)
+	}
+	var count int64 = 0
+	for _, list := range []*MoveList{&captures, &quiets} {
+		for _, move := range list.Slice() {
+			unapply := b.Apply(move)
+			count += perftPartition(b, n-1, t)
+			unapply()
+		}
+	}
+	return count
+}
+
+func TestStagedGenerationPartition(t *testing.T) {
+	positions := map[string]int64{ // perft to depth 3
+		Startpos: 8902,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0": 97862,
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 0":                            2812,
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1":     9467,
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8":            62379,
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1":                              9483,
+		"6k1/8/8/8/1Pp5/8/Q7/6K1 b - b3 0 0":                                   772,
+	}
+	for fen, want := range positions {
+		b := ParseFen(fen)
+		if got := perftPartition(&b, 3, t); got != want {
+			t.Error("Perft from captures and quiets of", fen, "is", got, "expected", want)
+		}
+	}
+}
+
+func TestPerftParallel(t *testing.T) {
+	positions := map[string]int64{ // perft to depth 4
+		Startpos: 197281,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0": 4085603,
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 0":                            43238,
+	}
+	table := NewPerftTable(1)
+	for fen, want := range positions {
+		b := ParseFen(fen)
+		for _, workers := range []int{1, 3, 0} {
+			if got := PerftParallel(&b, 4, workers); got != want {
+				t.Error("Parallel perft of", fen, "with", workers, "workers is", got, "expected", want)
+			}
+		}
+		for i := 0; i < 2; i++ { // the second time, from the table
+			if got := table.PerftParallel(&b, 4, 4); got != want {
+				t.Error("Cached parallel perft of", fen, "is", got, "expected", want)
+			}
+		}
+		if got := table.Perft(&b, 4); got != want {
+			t.Error("Cached perft of", fen, "is", got, "expected", want)
+		}
+		if before := ParseFen(fen); b.ToFen() != before.ToFen() {
+			t.Error("Parallel perft modified the board:", b.ToFen())
+		}
+	}
+}
+
+func TestPerftStats(t *testing.T) {
+	// From the Chess Programming Wiki's perft results.
+	positions := map[string][]PerftCounts{
+		Startpos: {
+			{Nodes: 20},
+			{Nodes: 400},
+			{Nodes: 8902, Captures: 34, Checks: 12},
+			{Nodes: 197281, Captures: 1576, Checks: 469, Checkmates: 8},
+		},
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0": {
+			{Nodes: 48, Captures: 8, Castles: 2},
+			{Nodes: 2039, Captures: 351, EnPassant: 1, Castles: 91, Checks: 3},
+			{Nodes: 97862, Captures: 17102, EnPassant: 45, Castles: 3162, Checks: 993, Checkmates: 1},
+			{Nodes: 4085603, Captures: 757163, EnPassant: 1929, Castles: 128013, Promotions: 15172,
+				Checks: 25523, DiscoveredChecks: 42, DoubleChecks: 6, Checkmates: 43},
+		},
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 0": {
+			{Nodes: 14, Captures: 1, Checks: 2},
+			{Nodes: 191, Captures: 14, Checks: 10},
+			{Nodes: 2812, Captures: 209, EnPassant: 2, Checks: 267, DiscoveredChecks: 3},
+			{Nodes: 43238, Captures: 3348, EnPassant: 123, Checks: 1680, DiscoveredChecks: 106, Checkmates: 17},
+			{Nodes: 674624, Captures: 52051, EnPassant: 1165, Checks: 52950, DiscoveredChecks: 1292, DoubleChecks: 3},
+		},
+	}
+	for fen, want := range positions {
+		b := ParseFen(fen)
+		got := PerftStats(&b, len(want))
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("Perft statistics of %v at depth %v: got %+v, expected %+v", fen, i+1, got[i], want[i])
+			}
+		}
+	}
+}
+
+func TestPerftParallelContext(t *testing.T) {
+	b := ParseFen(Startpos)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := PerftParallelContext(ctx, &b, 5, 2); !errors.Is(err, context.Canceled) {
+		t.Error("Expected a cancelled perft, got", err)
+	}
+	// A count abandoned partway leaves only complete counts in the table.
+	table := NewPerftTable(1)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := table.PerftParallelContext(ctx, &b, 6, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Expected perft to time out, got", err)
+	}
+	if got, err := table.PerftParallelContext(context.Background(), &b, 4, 2); err != nil || got != 197281 {
+		t.Error("Perft after a timeout is", got, err, "expected 197281")
+	}
+	if b.ToFen() != Startpos {
+		t.Error("Abandoned perft modified the board:", b.ToFen())
+	}
+}
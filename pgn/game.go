@@ -0,0 +1,75 @@
+// Package pgn reads and writes chess games in Portable Game Notation.
+// Games are streamed one at a time, so arbitrarily large databases can be
+// processed without loading them into memory. Movetext is replayed through
+// dragon.Board, so every move read is guaranteed legal.
+package pgn
+
+import (
+	"github.com/noahklein/dragon"
+)
+
+// A single tag pair, eg: [Event "Casual game"].
+type Tag struct {
+	Name  string
+	Value string
+}
+
+// A move in the movetext, with its annotations.
+type Node struct {
+	Move       dragon.Move
+	SAN        string      // the SAN as it appeared in the input; ignored by the Writer
+	NAGs       []int       // numeric annotation glyphs; "!" and "?" suffixes are stored as $1-$6
+	Comment    string      // comment(s) following the move
+	Variations []Variation // alternatives to this move, from the position before it
+}
+
+// A sequence of moves, used for recursive annotation variations.
+type Variation struct {
+	Comment string // comment preceding the first move
+	Moves   []Node
+}
+
+// A game: tag pairs, a main line with annotations, and a result.
+type Game struct {
+	Tags    []Tag
+	Comment string // comment preceding the first move
+	Moves   []Node // the main line
+	Result  string // one of "1-0", "0-1", "1/2-1/2" or "*"
+
+	// Positions along the main line, starting with the initial position, so
+	// Positions[i] is the board before Moves[i] is played. Filled in by the Reader.
+	Positions []dragon.Board
+}
+
+// The Seven Tag Roster, which must appear first and in this order.
+var sevenTagRoster = [7]string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}
+
+// Returns the value of the named tag, or "" if it is absent.
+func (g *Game) Tag(name string) string {
+	for _, t := range g.Tags {
+		if t.Name == name {
+			return t.Value
+		}
+	}
+	return ""
+}
+
+// Sets the value of the named tag, replacing it if it is already present.
+func (g *Game) SetTag(name, value string) {
+	for i := range g.Tags {
+		if g.Tags[i].Name == name {
+			g.Tags[i].Value = value
+			return
+		}
+	}
+	g.Tags = append(g.Tags, Tag{name, value})
+}
+
+// Returns the position the game starts from: the FEN tag if present, or the
+// standard starting position.
+func (g *Game) StartingPosition() (dragon.Board, error) {
+	if fen := g.Tag("FEN"); fen != "" {
+		return dragon.ParseFenStrict(fen)
+	}
+	return dragon.ParseFen(dragon.Startpos), nil
+}
@@ -0,0 +1,391 @@
+package pgn
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/noahklein/dragon"
+)
+
+// Reads games one at a time from a PGN stream.
+type Reader struct {
+	r           *bufio.Reader
+	line        int
+	atLineStart bool
+	unread      *token // one token of lookahead
+}
+
+// Creates a Reader that streams games from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, 64*1024), line: 1, atLineStart: true}
+}
+
+type tokenKind uint8
+
+const (
+	tokEOF tokenKind = iota
+	tokTagOpen
+	tokTagClose
+	tokVariationOpen
+	tokVariationClose
+	tokPeriod
+	tokString
+	tokSymbol
+	tokComment
+	tokNAG
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+// Suffix annotations and their equivalent NAGs.
+var suffixNAGs = map[string]int{"!": 1, "?": 2, "!!": 3, "??": 4, "!?": 5, "?!": 6}
+
+// Reads the next game from the stream. Returns io.EOF when no games remain.
+// If the movetext contains an illegal or unreadable move, the rest of that game
+// is skipped, and the partial game is returned along with the error; the Reader
+// remains usable, so callers may skip the bad game and continue.
+func (r *Reader) Next() (*Game, error) {
+	g := &Game{}
+	empty := true
+
+	// Tag pair section
+	for {
+		tok, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		if tok.kind != tokTagOpen {
+			r.unread = &tok
+			break
+		}
+		name, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		value, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		closing, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		if name.kind != tokSymbol || value.kind != tokString || closing.kind != tokTagClose {
+			return nil, fmt.Errorf("pgn: line %d: malformed tag pair", tok.line)
+		}
+		g.Tags = append(g.Tags, Tag{name.text, value.text})
+		empty = false
+	}
+
+	// Movetext section
+	var gameErr error
+	fail := func(line int, err error) {
+		if gameErr == nil {
+			gameErr = fmt.Errorf("pgn: line %d: %w", line, err)
+		}
+	}
+	start, err := g.StartingPosition()
+	if err != nil {
+		fail(r.line, err)
+	}
+	g.Positions = append(g.Positions, start)
+	stack := []frame{{comment: &g.Comment, moves: &g.Moves, board: start}}
+
+	for {
+		tok, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		top := &stack[len(stack)-1]
+		switch tok.kind {
+		case tokEOF:
+			if empty {
+				return nil, io.EOF
+			}
+			if len(stack) > 1 {
+				fail(tok.line, errors.New("unterminated variation"))
+			}
+			return r.finish(g, gameErr)
+		case tokTagOpen:
+			// A new game began without a result for this one.
+			r.unread = &tok
+			if len(stack) > 1 {
+				fail(tok.line, errors.New("unterminated variation"))
+			}
+			return r.finish(g, gameErr)
+		case tokSymbol:
+			empty = false
+			if isResult(tok.text) {
+				if len(stack) == 1 {
+					g.Result = tok.text
+					return r.finish(g, gameErr)
+				}
+				continue // results inside variations are meaningless
+			}
+			if isMoveNumber(tok.text) {
+				continue
+			}
+			san, nag := splitSuffix(tok.text)
+			if san == "" { // a free-standing "!" or "?"
+				top.addNAG(nag)
+				continue
+			}
+			if gameErr != nil || top.moves == nil {
+				continue
+			}
+			m, err := top.board.ParseSAN(san)
+			if err != nil {
+				fail(tok.line, err)
+				continue
+			}
+			top.before = top.board
+			if m == 0 {
+				top.board.NullMove()
+			} else {
+				top.board.Apply(m)
+			}
+			*top.moves = append(*top.moves, Node{Move: m, SAN: san})
+			top.addNAG(nag)
+			if len(stack) == 1 {
+				g.Positions = append(g.Positions, top.board)
+			}
+		case tokNAG:
+			n, err := strconv.Atoi(tok.text)
+			if err != nil {
+				fail(tok.line, fmt.Errorf("bad NAG $%s", tok.text))
+				continue
+			}
+			top.addNAG(n)
+		case tokComment:
+			empty = false
+			if top.moves == nil {
+				continue
+			}
+			if len(*top.moves) == 0 {
+				*top.comment = joinComments(*top.comment, tok.text)
+			} else {
+				last := &(*top.moves)[len(*top.moves)-1]
+				last.Comment = joinComments(last.Comment, tok.text)
+			}
+		case tokVariationOpen:
+			if gameErr != nil || top.moves == nil || len(*top.moves) == 0 {
+				if gameErr == nil {
+					fail(tok.line, errors.New("variation before any move"))
+				}
+				stack = append(stack, frame{}) // keep nesting balanced while skipping
+				continue
+			}
+			last := &(*top.moves)[len(*top.moves)-1]
+			last.Variations = append(last.Variations, Variation{})
+			v := &last.Variations[len(last.Variations)-1]
+			stack = append(stack, frame{comment: &v.Comment, moves: &v.Moves, board: top.before})
+		case tokVariationClose:
+			if len(stack) == 1 {
+				fail(tok.line, errors.New("unbalanced ')'"))
+				continue
+			}
+			stack = stack[:len(stack)-1]
+		case tokPeriod, tokString, tokTagClose:
+			// Move number indications, and stray tokens, carry no information.
+		}
+	}
+}
+
+// A movetext list being appended to while reading.
+type frame struct {
+	comment *string // receives comments before the first move
+	moves   *[]Node // nil while skipping a malformed variation
+	board   dragon.Board
+	before  dragon.Board // the position before the last move in moves
+}
+
+func (f *frame) addNAG(nag int) {
+	if nag == 0 || f.moves == nil || len(*f.moves) == 0 {
+		return
+	}
+	last := &(*f.moves)[len(*f.moves)-1]
+	last.NAGs = append(last.NAGs, nag)
+}
+
+// Fills in the result from the tags if the movetext had none.
+func (r *Reader) finish(g *Game, err error) (*Game, error) {
+	if g.Result == "" {
+		g.Result = g.Tag("Result")
+	}
+	if !isResult(g.Result) {
+		g.Result = "*"
+	}
+	return g, err
+}
+
+func isResult(s string) bool {
+	return s == "1-0" || s == "0-1" || s == "1/2-1/2" || s == "*"
+}
+
+func isMoveNumber(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Splits a "!?"-style suffix annotation from a move, returning its NAG (or 0).
+func splitSuffix(s string) (string, int) {
+	san := strings.TrimRight(s, "!?")
+	return san, suffixNAGs[s[len(san):]]
+}
+
+func joinComments(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + " " + b
+}
+
+// Tokenizer
+
+func (r *Reader) readByte() (byte, error) {
+	c, err := r.r.ReadByte()
+	if err == nil && c == '\n' {
+		r.line++
+	}
+	return c, err
+}
+
+func (r *Reader) unreadByte(c byte) {
+	r.r.UnreadByte()
+	if c == '\n' {
+		r.line--
+	}
+}
+
+func isSymbolChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+		strings.IndexByte("_+#=:-/!?", c) >= 0
+}
+
+// Reads the next token. I/O errors other than io.EOF are returned as errors;
+// the end of the stream is returned as a tokEOF token.
+func (r *Reader) next() (token, error) {
+	if r.unread != nil {
+		tok := *r.unread
+		r.unread = nil
+		return tok, nil
+	}
+	for {
+		c, err := r.readByte()
+		if err == io.EOF {
+			return token{kind: tokEOF, line: r.line}, nil
+		} else if err != nil {
+			return token{}, err
+		}
+		lineStart := r.atLineStart
+		r.atLineStart = c == '\n'
+		line := r.line
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			continue
+		case c == '%' && lineStart: // escape mechanism: ignore the rest of the line
+			if err := r.skipPast('\n'); err != nil {
+				return token{}, err
+			}
+			r.atLineStart = true
+		case c == '[':
+			return token{tokTagOpen, "[", line}, nil
+		case c == ']':
+			return token{tokTagClose, "]", line}, nil
+		case c == '(':
+			return token{tokVariationOpen, "(", line}, nil
+		case c == ')':
+			return token{tokVariationClose, ")", line}, nil
+		case c == '.':
+			return token{tokPeriod, ".", line}, nil
+		case c == '*':
+			return token{tokSymbol, "*", line}, nil
+		case c == '"':
+			s, err := r.readString()
+			return token{tokString, s, line}, err
+		case c == '{':
+			s, err := r.readUntil('}')
+			return token{tokComment, strings.Join(strings.Fields(s), " "), line}, err
+		case c == ';':
+			s, err := r.readUntil('\n')
+			r.atLineStart = true
+			return token{tokComment, strings.TrimSpace(s), line}, err
+		case c == '<': // reserved for future expansion
+			if err := r.skipPast('>'); err != nil {
+				return token{}, err
+			}
+		case c == '$':
+			s, err := r.readSymbol(nil)
+			return token{tokNAG, s, line}, err
+		case isSymbolChar(c):
+			s, err := r.readSymbol([]byte{c})
+			return token{tokSymbol, s, line}, err
+		}
+		// Anything else is not valid PGN, and is silently skipped.
+	}
+}
+
+func (r *Reader) readSymbol(buf []byte) (string, error) {
+	for {
+		c, err := r.readByte()
+		if err == io.EOF {
+			return string(buf), nil
+		} else if err != nil {
+			return "", err
+		}
+		if !isSymbolChar(c) {
+			r.unreadByte(c)
+			return string(buf), nil
+		}
+		buf = append(buf, c)
+	}
+}
+
+// Reads a quoted string, whose opening quote has been consumed.
+func (r *Reader) readString() (string, error) {
+	var buf []byte
+	for {
+		c, err := r.readByte()
+		if err == io.EOF {
+			return string(buf), fmt.Errorf("pgn: line %d: unterminated string", r.line)
+		} else if err != nil {
+			return "", err
+		}
+		switch c {
+		case '"':
+			return string(buf), nil
+		case '\\':
+			if c, err = r.readByte(); err != nil {
+				return string(buf), fmt.Errorf("pgn: line %d: unterminated string", r.line)
+			}
+		}
+		buf = append(buf, c)
+	}
+}
+
+// Reads up to, and consumes, the delimiter; the end of the stream also terminates.
+func (r *Reader) readUntil(delim byte) (string, error) {
+	s, err := r.r.ReadString(delim)
+	r.line += strings.Count(s, "\n")
+	if err == io.EOF {
+		return s, nil
+	}
+	return strings.TrimSuffix(s, string(delim)), err
+}
+
+func (r *Reader) skipPast(delim byte) error {
+	_, err := r.readUntil(delim)
+	return err
+}
@@ -0,0 +1,130 @@
+package pgn
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/noahklein/dragon"
+)
+
+const samplePGN = `[Event "F/S Return Match"]
+[Site "Belgrade, Serbia JUG"]
+[Date "1992.11.04"]
+[Round "29"]
+[White "Fischer, Robert J."]
+[Black "Spassky, Boris V."]
+[Result "1/2-1/2"]
+[Annotator "Someone \"quoted\""]
+
+{Opening comment} 1. e4 e5 2. Nf3 Nc6 3. Bb5 {This opening is called the Ruy Lopez.}
+3... a6 $1 (3... Nf6 4. O-O (4. d3 d6) Nxe4) 4. Ba4 Nf6 5. O-O!? Be7 6. Re1 b5
+; rest of line comment
+7. Bb3 d6 8. c3 O-O 9. h3 Nb8 10. d4 Nbd7 1/2-1/2
+
+% an escaped line, ignored
+[Event "Second"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1"]
+
+1.e4 Kd7 2.e5 *
+
+[Event "Broken"]
+
+1. e4 e5 2. Qxf7 Nc6 3. (3. d4) Nf3 0-1
+
+[Event "After broken"]
+
+1. d4 d5 1-0
+`
+
+func TestReader(t *testing.T) {
+	r := NewReader(strings.NewReader(samplePGN))
+
+	g, err := r.Next()
+	if err != nil {
+		t.Fatal("Failed to read first game:", err)
+	}
+	if g.Tag("White") != "Fischer, Robert J." || g.Tag("Annotator") != `Someone "quoted"` {
+		t.Error("Tags read incorrectly:", g.Tags)
+	}
+	if g.Result != "1/2-1/2" || len(g.Moves) != 20 || len(g.Positions) != 21 {
+		t.Error("Wrong result or move count:", g.Result, len(g.Moves), len(g.Positions))
+	}
+	if g.Comment != "Opening comment" {
+		t.Error("Wrong game comment:", g.Comment)
+	}
+	if g.Moves[4].Comment != "This opening is called the Ruy Lopez." {
+		t.Error("Wrong move comment:", g.Moves[4].Comment)
+	}
+	if len(g.Moves[5].NAGs) != 1 || g.Moves[5].NAGs[0] != 1 {
+		t.Error("Wrong NAGs:", g.Moves[5].NAGs)
+	}
+	if len(g.Moves[8].NAGs) != 1 || g.Moves[8].NAGs[0] != 5 || g.Moves[8].SAN != "O-O" {
+		t.Error("Suffix annotation not converted to NAG:", g.Moves[8].NAGs)
+	}
+	if g.Moves[11].Comment != "rest of line comment" {
+		t.Error("Wrong rest-of-line comment:", g.Moves[11].Comment)
+	}
+	vars := g.Moves[5].Variations
+	if len(vars) != 1 || len(vars[0].Moves) != 3 || vars[0].Moves[0].SAN != "Nf6" {
+		t.Fatal("Variation read incorrectly:", vars)
+	}
+	nested := vars[0].Moves[1].Variations
+	if len(nested) != 1 || len(nested[0].Moves) != 2 || nested[0].Moves[1].SAN != "d6" {
+		t.Error("Nested variation read incorrectly:", nested)
+	}
+	if fen := g.Positions[20].ToFen(); fen != "r1bq1rk1/2pnbppp/p2p1n2/1p2p3/3PP3/1BP2N1P/PP3PP1/RNBQR1K1 w - - 1 11" {
+		t.Error("Wrong final position:", fen)
+	}
+
+	g, err = r.Next()
+	if err != nil {
+		t.Fatal("Failed to read second game:", err)
+	}
+	if g.Result != "*" || len(g.Moves) != 3 || g.Positions[3].ToFen() != "8/3k4/8/4P3/8/8/8/4K3 b - - 0 2" {
+		t.Error("Game from FEN read incorrectly:", g.Result, len(g.Moves))
+	}
+
+	g, err = r.Next()
+	if err == nil || !errors.Is(err, dragon.ErrSANIllegal) {
+		t.Error("Expected an illegal move error, got", err)
+	}
+	if g == nil || g.Tag("Event") != "Broken" || len(g.Moves) != 2 {
+		t.Error("Partial game not returned")
+	}
+
+	g, err = r.Next()
+	if err != nil || g.Tag("Event") != "After broken" || g.Result != "1-0" || len(g.Moves) != 2 {
+		t.Error("Failed to recover after a broken game:", err)
+	}
+
+	if _, err = r.Next(); err != io.EOF {
+		t.Error("Expected io.EOF, got", err)
+	}
+}
+
+func TestReaderMalformed(t *testing.T) {
+	inputs := []string{
+		`[Event "x"] 1. e4 ( e5`,
+		`1. e4 e5 ) 2. Nf3`,
+		`( 1. e4 ) 1. d4`,
+		`[Event "x"] [FEN "not a fen"] 1. e4`,
+		`[Event "x"] 1. e4 $x`,
+	}
+	for _, in := range inputs {
+		r := NewReader(strings.NewReader(in))
+		if _, err := r.Next(); err == nil {
+			t.Error("Expected an error reading", in)
+		}
+	}
+	r := NewReader(strings.NewReader(`[Event "x`))
+	if _, err := r.Next(); err == nil || err == io.EOF {
+		t.Error("Expected an error for an unterminated tag")
+	}
+	r = NewReader(strings.NewReader("   \n\n"))
+	if _, err := r.Next(); err != io.EOF {
+		t.Error("Expected io.EOF for empty input, got", err)
+	}
+}
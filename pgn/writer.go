@@ -0,0 +1,193 @@
+package pgn
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/noahklein/dragon"
+)
+
+// Export format lines may not exceed this many characters.
+const maxLineLength = 79
+
+// Writes games in PGN export format.
+type Writer struct {
+	w *bufio.Writer
+}
+
+// Creates a Writer that emits games to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Writes a game in export format: the Seven Tag Roster followed by any other
+// tags, a blank line, and the movetext wrapped to fit in 80 columns, followed by
+// a blank line. SAN is regenerated from each Node's Move, so the moves must be
+// legal from the game's starting position; if they aren't, an error is
+// returned and nothing is written.
+func (w *Writer) WriteGame(g *Game) error {
+	start, err := g.StartingPosition()
+	if err != nil {
+		return err
+	}
+	result := g.Result
+	if !isResult(result) {
+		result = "*"
+	}
+
+	// The game is built up here, so that nothing is written if a move is illegal.
+	var out bytes.Buffer
+
+	// Tag pairs
+	for _, name := range sevenTagRoster {
+		value := g.Tag(name)
+		switch {
+		case name == "Result":
+			value = result
+		case value == "" && name == "Date":
+			value = "????.??.??"
+		case value == "":
+			value = "?"
+		}
+		writeTag(&out, name, value)
+	}
+	for _, t := range g.Tags {
+		if !isRosterTag(t.Name) {
+			writeTag(&out, t.Name, t.Value)
+		}
+	}
+	out.WriteByte('\n')
+
+	// Movetext
+	lw := lineWrapper{w: &out}
+	lw.comment(g.Comment)
+	if err := lw.moves(start, g.Moves); err != nil {
+		return err
+	}
+	lw.word(result)
+	lw.flush()
+	out.WriteString("\n\n")
+	w.w.Write(out.Bytes())
+	return w.w.Flush()
+}
+
+func isRosterTag(name string) bool {
+	for _, r := range sevenTagRoster {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+func writeTag(w *bytes.Buffer, name, value string) {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	fmt.Fprintf(w, "[%s \"%s\"]\n", name, value)
+}
+
+// Emits space-separated movetext tokens, wrapping lines as needed.
+// The last word is held back, so that closing parentheses can be glued to it
+// before deciding where it fits.
+type lineWrapper struct {
+	w       *bytes.Buffer
+	lineLen int
+	prefix  string // glued to the front of the next word, eg: "("
+	pending string
+}
+
+func (lw *lineWrapper) word(s string) {
+	lw.flush()
+	lw.pending = lw.prefix + s
+	lw.prefix = ""
+}
+
+// Appends text to the last word written, eg: ")".
+func (lw *lineWrapper) suffix(s string) {
+	lw.pending += s
+}
+
+func (lw *lineWrapper) flush() {
+	if lw.pending == "" {
+		return
+	}
+	if lw.lineLen > 0 && lw.lineLen+1+len(lw.pending) > maxLineLength {
+		lw.w.WriteByte('\n')
+		lw.lineLen = 0
+	} else if lw.lineLen > 0 {
+		lw.w.WriteByte(' ')
+		lw.lineLen++
+	}
+	lw.w.WriteString(lw.pending)
+	lw.lineLen += len(lw.pending)
+	lw.pending = ""
+}
+
+// Writes a brace comment, breaking it between words where necessary.
+func (lw *lineWrapper) comment(c string) {
+	words := strings.Fields(strings.ReplaceAll(c, "}", ""))
+	if len(words) == 0 {
+		return
+	}
+	words[0] = "{" + words[0]
+	words[len(words)-1] += "}"
+	for _, word := range words {
+		lw.word(word)
+	}
+}
+
+// Writes a sequence of moves starting from the given position, recursing into variations.
+func (lw *lineWrapper) moves(b dragon.Board, nodes []Node) error {
+	needNumber := true // black's moves need a number after an interruption
+	for _, n := range nodes {
+		moveNo := strconv.Itoa(int(b.Fullmoveno))
+		if b.Fullmoveno == 0 {
+			moveNo = "1"
+		}
+		if b.Wtomove {
+			lw.word(moveNo + ".")
+		} else if needNumber {
+			lw.word(moveNo + "...")
+		}
+		needNumber = false
+
+		if n.Move != 0 && !b.IsLegal(n.Move) { // 0 is a null move
+			return fmt.Errorf("%w: %v in %s", errIllegalMove, &n.Move, b.ToFen())
+		}
+		lw.word(b.MoveToSAN(n.Move))
+		for _, nag := range n.NAGs {
+			lw.word("$" + strconv.Itoa(nag))
+		}
+		if n.Comment != "" {
+			lw.comment(n.Comment)
+			needNumber = true
+		}
+
+		before := b
+		if n.Move == 0 {
+			b.NullMove()
+		} else {
+			b.Apply(n.Move)
+		}
+		for _, v := range n.Variations {
+			if len(v.Moves) == 0 && v.Comment == "" {
+				continue
+			}
+			lw.prefix = "("
+			lw.comment(v.Comment)
+			if err := lw.moves(before, v.Moves); err != nil {
+				return err
+			}
+			lw.suffix(")")
+			needNumber = true
+		}
+	}
+	return nil
+}
+
+var errIllegalMove = errors.New("pgn: illegal move in game")
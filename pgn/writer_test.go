@@ -0,0 +1,104 @@
+package pgn
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/noahklein/dragon"
+)
+
+func TestWriterRoundTrip(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out)
+	r := NewReader(strings.NewReader(samplePGN))
+	var games []*Game
+	for i := 0; i < 2; i++ {
+		g, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		games = append(games, g)
+		if err := w.WriteGame(g); err != nil {
+			t.Fatal("Failed to write game:", err)
+		}
+	}
+
+	for _, line := range strings.Split(out.String(), "\n") {
+		if len(line) > maxLineLength {
+			t.Error("Line too long:", line)
+		}
+	}
+	if !strings.HasPrefix(out.String(), `[Event "F/S Return Match"]`) ||
+		!strings.Contains(out.String(), `[Annotator "Someone \"quoted\""]`) {
+		t.Error("Tags written incorrectly:\n", out.String())
+	}
+	if !strings.Contains(out.String(), "3... a6 $1 (3... Nf6 4. O-O (4. d3 d6) 4... Nxe4) 4. Ba4") {
+		t.Error("Variations written incorrectly:\n", out.String())
+	}
+	if !strings.Contains(out.String(), "[Date \"????.??.??\"]\n[Round \"?\"]") {
+		t.Error("Missing Seven Tag Roster defaults:\n", out.String())
+	}
+
+	// Reading the output back must give the same games.
+	r = NewReader(&out)
+	for _, want := range games {
+		got, err := r.Next()
+		if err != nil {
+			t.Fatal("Failed to re-read written game:", err)
+		}
+		if got.Result != want.Result || got.Comment != want.Comment || len(got.Moves) != len(want.Moves) {
+			t.Fatal("Round trip changed the game")
+		}
+		for i := range want.Moves {
+			if got.Moves[i].Move != want.Moves[i].Move || got.Moves[i].Comment != want.Moves[i].Comment ||
+				len(got.Moves[i].Variations) != len(want.Moves[i].Variations) {
+				t.Error("Round trip changed move", i)
+			}
+		}
+	}
+}
+
+func TestWriterLongComment(t *testing.T) {
+	var out bytes.Buffer
+	g := &Game{Result: "1-0", Comment: strings.Repeat("word ", 40)}
+	b := dragon.ParseFen(dragon.Startpos)
+	for _, san := range []string{"e4", "e5", "Qh5", "Nc6", "Bc4", "Nf6", "Qxf7#"} {
+		m, err := b.ParseSAN(san)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.Moves = append(g.Moves, Node{Move: m, Comment: strings.Repeat("long ", 20)})
+		b.Apply(m)
+	}
+	if err := NewWriter(&out).WriteGame(g); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if len(line) > maxLineLength {
+			t.Error("Line too long:", line)
+		}
+	}
+	if !strings.Contains(out.String(), "4. Qxf7#") || !strings.HasSuffix(out.String(), "1-0\n\n") {
+		t.Error("Movetext written incorrectly:\n", out.String())
+	}
+
+	// Nothing of a game with an illegal move is written, even by later games.
+	legal := *g
+	legal.Moves = g.Moves[:1]
+	g.Moves[1].Move = g.Moves[0].Move // not legal for black
+	out.Reset()
+	w := NewWriter(&out)
+	if err := w.WriteGame(g); err == nil {
+		t.Error("Expected an error writing an illegal move")
+	}
+	if out.Len() != 0 {
+		t.Error("Part of a game with an illegal move was written:\n", out.String())
+	}
+	if err := w.WriteGame(&legal); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "[Event ") || strings.Count(out.String(), "[Event ") != 1 {
+		t.Error("Wrong game written after an illegal one:\n", out.String())
+	}
+}
@@ -0,0 +1,215 @@
+package dragon
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors reported by ParseSAN, wrapped together with the offending string.
+var (
+	ErrSANSyntax    = errors.New("malformed SAN move")
+	ErrSANIllegal   = errors.New("no legal move matches SAN")
+	ErrSANAmbiguous = errors.New("ambiguous SAN move")
+)
+
+var sanPieceLetters = [7]string{"", "", "N", "B", "R", "Q", "K"}
+
+// Converts a move to Standard Algebraic Notation (eg: e4, Nbd7, exd6, O-O-O, e8=Q, Qh4#).
+// The move must be legal in the current position (i.e., be in the set of moves
+// found by GenerateLegalMoves()). En passant captures are written without an
+// "e.p." suffix, as PGN requires.
+// The board is temporarily modified to find check and mate, so this is not thread-safe.
+func (b *Board) MoveToSAN(m Move) string {
+	if m == 0 {
+		return "--"
+	}
+	var san strings.Builder
+	piece, _ := GetPieceType(m.From(), b)
+	right, castling := b.castlingRight(m)
+	if piece == King && castling {
+		if right == whiteKingside || right == blackKingside {
+			san.WriteString("O-O")
+		} else {
+			san.WriteString("O-O-O")
+		}
+	} else {
+		capture := IsCapture(m, b)
+		if piece == Pawn {
+			if capture {
+				san.WriteByte('a' + File(m.From()))
+			}
+		} else {
+			san.WriteString(sanPieceLetters[piece])
+			san.WriteString(b.sanDisambiguation(m, Piece(piece)))
+		}
+		if capture {
+			san.WriteByte('x')
+		}
+		san.WriteString(IndexToAlgebraic(Square(m.To())))
+		if m.Promote() != Nothing {
+			san.WriteByte('=')
+			san.WriteString(sanPieceLetters[m.Promote()])
+		}
+	}
+
+	if b.GivesCheck(m) {
+		var undo Undo
+		b.MakeMove(m, &undo)
+		replies, _ := b.GenerateLegalMoves()
+		b.UnmakeMove(m, &undo)
+		if len(replies) == 0 {
+			san.WriteByte('#')
+		} else {
+			san.WriteByte('+')
+		}
+	}
+	return san.String()
+}
+
+// Computes the minimal origin file and/or rank needed to tell a piece move apart
+// from other legal moves of the same piece type to the same square.
+func (b *Board) sanDisambiguation(m Move, piece Piece) string {
+	moves, _ := b.GenerateLegalMoves()
+	ambiguous, sameFile, sameRank := false, false, false
+	for _, other := range moves {
+		if other.To() != m.To() || other.From() == m.From() || other.Promote() != m.Promote() {
+			continue
+		}
+		if otherPiece, _ := GetPieceType(other.From(), b); Piece(otherPiece) != piece {
+			continue
+		}
+		ambiguous = true
+		if File(other.From()) == File(m.From()) {
+			sameFile = true
+		}
+		if other.From()/8 == m.From()/8 {
+			sameRank = true
+		}
+	}
+	from := IndexToAlgebraic(Square(m.From()))
+	switch {
+	case !ambiguous:
+		return ""
+	case !sameFile:
+		return from[:1]
+	case !sameRank:
+		return from[1:]
+	default:
+		return from
+	}
+}
+
+// Parses a move in Standard Algebraic Notation, resolving it against the legal
+// moves in the current position.
+// Common variants are tolerated: a missing or extra "x", "0-0" for "O-O",
+// promotions with or without "=", fully specified origins such as "Ng1f3",
+// and trailing check, mate, "e.p." and "!?" annotations.
+func (b *Board) ParseSAN(san string) (Move, error) {
+	s := strings.TrimSpace(san)
+	s = strings.TrimSuffix(s, "e.p.")
+	s = strings.TrimRight(s, "+#!? ")
+	if s == "" {
+		return 0, fmt.Errorf("%w: %q", ErrSANSyntax, san)
+	}
+	if s == "--" || s == "0000" {
+		return 0, nil
+	}
+	moves, _ := b.GenerateLegalMoves()
+
+	// Castling
+	switch strings.ReplaceAll(s, "0", "O") {
+	case "O-O", "O-O-O":
+		long := len(s) == 5
+		for _, mv := range moves {
+			if piece, _ := GetPieceType(mv.From(), b); piece != King {
+				continue
+			}
+			right, castling := b.castlingRight(mv)
+			kingside := right == whiteKingside || right == blackKingside
+			if castling && kingside != long {
+				return mv, nil
+			}
+		}
+		return 0, fmt.Errorf("%w: %q", ErrSANIllegal, san)
+	}
+
+	// Promotion suffix, eg: e8=Q, e8Q, e8q
+	var promote Piece = Nothing
+	// A square always ends in a digit, so a trailing letter must be a promotion.
+	if p := sanPromotionPiece(s[len(s)-1]); p != Nothing && len(s) >= 3 {
+		promote = p
+		s = strings.TrimSuffix(s[:len(s)-1], "=")
+	}
+
+	// Moving piece; pawns have no letter.
+	var piece Piece = Pawn
+	if idx := strings.IndexByte("NBRQK", s[0]); idx >= 0 {
+		piece = Piece(Knight + idx)
+		s = s[1:]
+	}
+
+	// Destination square is always the last two characters.
+	if len(s) < 2 {
+		return 0, fmt.Errorf("%w: %q", ErrSANSyntax, san)
+	}
+	to, err := AlgebraicToIndex(s[len(s)-2:])
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrSANSyntax, san)
+	}
+
+	// Whatever remains (minus capture markers) disambiguates the origin.
+	fromFile, fromRank := -1, -1
+	for _, c := range s[:len(s)-2] {
+		switch {
+		case c == 'x' || c == 'X' || c == ':' || c == '-':
+		case c >= 'a' && c <= 'h':
+			fromFile = int(c - 'a')
+		case c >= '1' && c <= '8':
+			fromRank = int(c - '1')
+		default:
+			return 0, fmt.Errorf("%w: %q", ErrSANSyntax, san)
+		}
+	}
+
+	var found Move
+	matches := 0
+	for _, mv := range moves {
+		if mv.To() != to || mv.Promote() != promote {
+			continue
+		}
+		if fromFile >= 0 && int(File(mv.From())) != fromFile {
+			continue
+		}
+		if fromRank >= 0 && int(mv.From()/8) != fromRank {
+			continue
+		}
+		if p, _ := GetPieceType(mv.From(), b); Piece(p) != piece {
+			continue
+		}
+		found = mv
+		matches++
+	}
+	switch {
+	case matches == 0:
+		return 0, fmt.Errorf("%w: %q", ErrSANIllegal, san)
+	case matches > 1:
+		return 0, fmt.Errorf("%w: %q", ErrSANAmbiguous, san)
+	}
+	return found, nil
+}
+
+// Maps a SAN promotion letter (either case) to a piece type, or Nothing.
+func sanPromotionPiece(c byte) Piece {
+	switch c {
+	case 'N', 'n':
+		return Knight
+	case 'B', 'b':
+		return Bishop
+	case 'R', 'r':
+		return Rook
+	case 'Q', 'q':
+		return Queen
+	}
+	return Nothing
+}
@@ -0,0 +1,118 @@
+package dragon
+
+import (
+	"errors"
+	"testing"
+)
+
+type sanCase struct {
+	fen  string
+	move string // long algebraic
+}
+
+func TestMoveToSAN(t *testing.T) {
+	cases := map[sanCase]string{
+		{Startpos, "e2e4"}: "e4",
+		{Startpos, "g1f3"}: "Nf3",
+		// disambiguation by file, by rank, and by both
+		{"r3k2r/pppq1ppp/2np1n2/4p3/4P3/2NP1N2/PPPQ1PPP/R3K2R b KQkq - 0 1", "d7e7"}: "Qe7",
+		{"4k3/8/8/8/8/8/1N3N2/4K3 w - - 0 1", "b2d3"}:                                "Nbd3",
+		{"4k3/8/8/8/1N6/8/1N6/4K3 w - - 0 1", "b2d3"}:                                "N2d3",
+		{"4k3/8/8/8/1Q1Q4/8/1Q6/4K3 w - - 0 1", "b4c3"}:                              "Qb4c3",
+		{"1r5r/4k3/8/8/8/8/8/4K3 b - - 0 1", "b8d8"}:                                 "Rbd8",
+		// pinned pieces don't need disambiguating
+		{"4r2k/8/8/8/N7/8/4N3/4K3 w - - 0 1", "a4c3"}: "Nc3",
+		// pawn captures, en passant and promotions
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2", "e4d5"}: "exd5",
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6"}:                             "exd6",
+		{"1r2k3/P7/8/8/8/8/8/4K3 w - - 0 1", "a7b8n"}:                             "axb8=N",
+		{"4k3/P7/8/8/8/8/8/4K3 w - - 0 1", "a7a8q"}:                               "a8=Q+",
+		// castling, check and mate
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1"}:                                "O-O",
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8c8"}:                                "O-O-O",
+		{"5k2/8/8/8/8/8/8/4K2R w K - 0 1", "e1g1"}:                                      "O-O+",
+		{"4k3/8/8/8/8/8/8/5KR1 w K - 0 1", "f1g1"}:                                      "O-O", // Chess960
+		{"1r2k3/8/8/8/8/8/8/4K3 b q - 0 1", "e8b8"}:                                     "O-O-O",
+		{"rnbqkbnr/pppp1ppp/8/4p3/6P1/5P2/PPPPP2P/RNBQKBNR b KQkq - 0 2", "d8h4"}:       "Qh4#",
+		{"r1bqkb1r/pppp1ppp/2n2n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 4 4", "h5f7"}: "Qxf7#",
+	}
+	for c, want := range cases {
+		b := ParseFen(c.fen)
+		fenBefore := b.ToFen()
+		m := parseMove(c.move)
+		if got := b.MoveToSAN(m); got != want {
+			t.Error("Wrong SAN for", c.move, "in", c.fen, "\nExpected:", want, "\nGot:     ", got)
+		}
+		if b.ToFen() != fenBefore {
+			t.Error("MoveToSAN corrupted board state for", c.fen)
+		}
+	}
+}
+
+func TestParseSAN(t *testing.T) {
+	cases := map[sanCase]string{
+		{Startpos, "e2e4"}: "e4",
+		{Startpos, "g1f3"}: "Nf3!?",
+		{Startpos, "b1c3"}: "Nb1c3",
+		{"4k3/8/8/8/8/8/1N3N2/4K3 w - - 0 1", "b2d3"}:                             "Nbd3",
+		{"4k3/8/8/8/1N6/8/1N6/4K3 w - - 0 1", "b4d3"}:                             "N4-d3",
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2", "e4d5"}: "ed5",
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6"}:                             "exd6 e.p.",
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5e6"}:                             "e6",
+		{"1r2k3/P7/8/8/8/8/8/4K3 w - - 0 1", "a7b8n"}:                             "axb8=N",
+		{"1r2k3/P7/8/8/8/8/8/4K3 w - - 0 1", "a7b8b"}:                             "axb8b",
+		{"4k3/P7/8/8/8/8/8/4K3 w - - 0 1", "a7a8q"}:                               "a8Q+",
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1"}:                          "0-0",
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8c8"}:                          "O-O-O",
+		{"rnbqkbnr/pppp1ppp/8/4p3/6P1/5P2/PPPPP2P/RNBQKBNR b KQkq - 0 2", "d8h4"}: "Qh4#",
+		{"rnbqkbnr/pppp1ppp/8/4p3/6P1/5P2/PPPPP2P/RNBQKBNR b KQkq - 0 2", "f8b4"}: "Bb4",
+		{"1r2k3/8/8/8/8/8/8/4K3 b q - 0 1", "e8b8"}:                               "O-O-O",
+	}
+	for c, san := range cases {
+		b := ParseFen(c.fen)
+		m, err := b.ParseSAN(san)
+		if err != nil || m != parseMove(c.move) {
+			t.Error("Failed to parse SAN", san, "in", c.fen, "\nExpected:", c.move, "\nGot:     ", &m, err)
+		}
+	}
+
+	sanErrors := map[sanCase]error{
+		{Startpos, "e5"}:   ErrSANIllegal,
+		{Startpos, "Ke2"}:  ErrSANIllegal,
+		{Startpos, "O-O"}:  ErrSANIllegal,
+		{Startpos, "Zf3"}:  ErrSANSyntax,
+		{Startpos, "Nf9"}:  ErrSANSyntax,
+		{Startpos, ""}:     ErrSANSyntax,
+		{Startpos, "N?f3"}: ErrSANSyntax,
+		{"4k3/8/8/8/8/8/1N3N2/4K3 w - - 0 1", "Nd3"}: ErrSANAmbiguous,
+	}
+	for c, want := range sanErrors {
+		b := ParseFen(c.fen)
+		if _, err := b.ParseSAN(c.move); !errors.Is(err, want) {
+			t.Error("Wrong error parsing SAN", c.move, "in", c.fen, "\nExpected:", want, "\nGot:     ", err)
+		}
+	}
+}
+
+// Every legal move must survive a round trip through SAN.
+func TestSANRoundTrip(t *testing.T) {
+	positions := []string{
+		Startpos,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+	}
+	for _, fen := range positions {
+		b := ParseFen(fen)
+		moves, _ := b.GenerateLegalMoves()
+		for _, m := range moves {
+			san := b.MoveToSAN(m)
+			parsed, err := b.ParseSAN(san)
+			if err != nil || parsed != m {
+				t.Error("SAN round trip failed for", &m, "via", san, "in", fen, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package search
+
+import (
+	"github.com/noahklein/dragon"
+)
+
+// Move ordering priorities. Higher scores are searched first.
+const (
+	orderPV      = 1 << 30
+	orderTT      = 1 << 29
+	orderCapture = 1 << 28 // plus MVV-LVA
+	orderKiller  = 1 << 27
+	historyMax   = 1 << 26 // history scores stay below the killers
+)
+
+// Sorts moves so that the likeliest cutoffs come first: the previous
+// iteration's PV move, the transposition table move, captures by most valuable
+// victim and least valuable attacker, promotions, killer moves, then quiet moves
+// by history score.
+func (s *Searcher) orderMoves(b *dragon.Board, moves []dragon.Move, ply int, ttMove dragon.Move) {
+	var pvMove dragon.Move
+	if ply < len(s.prevPV) {
+		pvMove = s.prevPV[ply]
+	}
+	side := 0
+	if !b.Wtomove {
+		side = 1
+	}
+	var scores [256]int32
+	for i, m := range moves {
+		var score int32
+		switch {
+		case m == pvMove:
+			score = orderPV
+		case m == ttMove:
+			score = orderTT
+		case dragon.IsCapture(m, b) || m.Promote() != dragon.Nothing:
+			victim, _ := dragon.GetPieceType(m.To(), b)
+			if victim == dragon.Nothing {
+				victim = dragon.Pawn // en passant, or a quiet promotion
+			}
+			attacker, _ := dragon.GetPieceType(m.From(), b)
+			score = orderCapture + int32(pieceValues[victim])*8 - int32(attacker) + int32(pieceValues[m.Promote()])
+		case m == s.killers[ply][0]:
+			score = orderKiller + 1
+		case m == s.killers[ply][1]:
+			score = orderKiller
+		default:
+			score = s.history[side][m.From()][m.To()]
+		}
+		scores[i] = score
+	}
+	// Insertion sort: move lists are short, and mostly need few swaps.
+	for i := 1; i < len(moves); i++ {
+		m, score := moves[i], scores[i]
+		j := i
+		for ; j > 0 && scores[j-1] < score; j-- {
+			moves[j], scores[j] = moves[j-1], scores[j-1]
+		}
+		moves[j], scores[j] = m, score
+	}
+}
+
+func (s *Searcher) isKiller(m dragon.Move, ply int) bool {
+	return m == s.killers[ply][0] || m == s.killers[ply][1]
+}
+
+// Remembers a quiet move that caused a beta cutoff.
+func (s *Searcher) recordCutoff(b *dragon.Board, m dragon.Move, depth, ply int) {
+	if s.killers[ply][0] != m {
+		s.killers[ply][1] = s.killers[ply][0]
+		s.killers[ply][0] = m
+	}
+	side := 0
+	if !b.Wtomove {
+		side = 1
+	}
+	h := &s.history[side][m.From()][m.To()]
+	*h += int32(depth * depth)
+	if *h >= historyMax {
+		for i := range s.history[side] {
+			for j := range s.history[side][i] {
+				s.history[side][i][j] /= 2
+			}
+		}
+	}
+}
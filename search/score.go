@@ -0,0 +1,47 @@
+package search
+
+import "strconv"
+
+// A search score in centipawns, from the point of view of the side to move.
+// Scores within MaxPly of ±MateScore encode forced mates.
+type Score int32
+
+const (
+	MaxPly = 128 // the deepest ply the search will reach
+
+	Infinity  Score = 32000
+	MateScore Score = 31000 // the score for delivering mate at the root
+	DrawScore Score = 0
+
+	mateBound = MateScore - MaxPly // scores beyond this are mates
+)
+
+// Whether the score is a forced mate, for either side.
+func (s Score) IsMate() bool {
+	return s >= mateBound || s <= -mateBound
+}
+
+// The number of moves until mate: positive if the side to move mates,
+// negative if it is mated, and zero if the score is not a mate.
+func (s Score) MateIn() int {
+	switch {
+	case s >= mateBound:
+		return int(MateScore-s+1) / 2
+	case s <= -mateBound:
+		return -int(MateScore+s) / 2
+	}
+	return 0
+}
+
+// Formats the score as in UCI "info" output, eg: "cp 35" or "mate -2".
+func (s Score) String() string {
+	if s.IsMate() {
+		return "mate " + strconv.Itoa(s.MateIn())
+	}
+	return "cp " + strconv.Itoa(int(s))
+}
+
+// The score for being mated at the given ply.
+func matedIn(ply int) Score {
+	return -MateScore + Score(ply)
+}
@@ -0,0 +1,393 @@
+// Package search implements an alpha-beta game tree search on top of the
+// dragon move generator: iterative deepening principal variation search with
+// quiescence, check extensions, null-move pruning, late-move reductions, and
+// killer and history move ordering.
+package search
+
+import (
+	"context"
+
+	"github.com/noahklein/dragon"
+)
+
+// Limits on a search. The zero value searches until the context is cancelled.
+type Limits struct {
+	Depth int   // maximum iterative deepening depth, in plies; 0 for no limit
+	Nodes int64 // maximum number of nodes to visit; 0 for no limit
+}
+
+// The outcome of a search iteration.
+type Result struct {
+	Move  dragon.Move   // the best move, or 0 if there are no legal moves
+	Score Score         // the score of Move, from the side to move's point of view
+	PV    []dragon.Move // the principal variation, starting with Move
+	Depth int           // the depth of the last completed iteration
+	Nodes int64         // nodes visited so far, including quiescence nodes
+}
+
+// A Searcher holds the state of a search, and the move-ordering heuristics
+// learnt along the way. A Searcher must not be used from multiple goroutines
+// at once, but it may be reused for successive searches.
+type Searcher struct {
+	// Called after each completed iteration, if not nil.
+	Info func(Result)
+	// Hashes of the positions preceding the root, oldest first, so that
+	// repetitions of earlier positions in the game are scored as draws.
+	History []uint64
+	// Scores the leaves of the search; dragon.DefaultEvaluator if nil.
+	Evaluator dragon.Evaluator
+	// Caches results between iterations, searches, and the goroutines sharing
+	// it. If nil, no table is used.
+	TT *TranspositionTable
+
+	ctx     context.Context
+	limits  Limits
+	nodes   int64
+	stopped bool
+
+	stack   []uint64 // hashes from the start of History to the current node
+	pv      [MaxPly + 1][MaxPly + 1]dragon.Move
+	pvLen   [MaxPly + 1]int
+	prevPV  []dragon.Move // the previous iteration's PV, tried first
+	killers [MaxPly + 1][2]dragon.Move
+	history [2][64][64]int32 // [side][from][to] bonus for quiet cutoffs
+}
+
+// Creates a Searcher with empty move-ordering tables, and a transposition
+// table of DefaultHashMB.
+func New() *Searcher {
+	return &Searcher{TT: NewTranspositionTable(DefaultHashMB)}
+}
+
+// Clears the move-ordering heuristics and the transposition table, eg: between
+// games.
+func (s *Searcher) Reset() {
+	s.killers = [MaxPly + 1][2]dragon.Move{}
+	s.history = [2][64][64]int32{}
+	if s.TT != nil {
+		s.TT.Clear()
+	}
+}
+
+// Searches the position with iterative deepening until the limits are reached
+// or the context is cancelled, and returns the result of the deepest completed
+// iteration. If no iteration completes, the first legal move is returned.
+func (s *Searcher) Search(ctx context.Context, b dragon.Board, limits Limits) Result {
+	s.ctx, s.limits, s.nodes, s.stopped = ctx, limits, 0, false
+	if s.Evaluator == nil {
+		s.Evaluator = dragon.DefaultEvaluator{}
+	}
+	if s.TT != nil {
+		s.TT.NewSearch()
+	}
+	s.prevPV = nil
+	s.stack = append(s.stack[:0], s.History...)
+	s.stack = append(s.stack, b.Hash())
+	for i := range s.history { // age the history scores
+		for j := range s.history[i] {
+			for k := range s.history[i][j] {
+				s.history[i][j][k] /= 8
+			}
+		}
+	}
+
+	moves, inCheck := b.GenerateLegalMoves()
+	result := Result{}
+	if len(moves) == 0 {
+		result.Score = DrawScore
+		if inCheck {
+			result.Score = matedIn(0)
+		}
+		return result
+	}
+	result.Move, result.PV = moves[0], []dragon.Move{moves[0]}
+
+	maxDepth := limits.Depth
+	if maxDepth <= 0 || maxDepth > MaxPly {
+		maxDepth = MaxPly
+	}
+	for depth := 1; depth <= maxDepth; depth++ {
+		score := s.negamax(&b, depth, 0, -Infinity, Infinity, false)
+		if s.stopped {
+			break
+		}
+		s.prevPV = append(s.prevPV[:0], s.pv[0][:s.pvLen[0]]...)
+		result = Result{
+			Move:  s.prevPV[0],
+			Score: score,
+			PV:    append([]dragon.Move(nil), s.prevPV...),
+			Depth: depth,
+			Nodes: s.nodes,
+		}
+		if s.Info != nil {
+			s.Info(result)
+		}
+		if score.IsMate() && depth >= 2*abs(score.MateIn()) {
+			break // the shortest mate has been found
+		}
+	}
+	result.Nodes = s.nodes
+	return result
+}
+
+// Periodically checks whether the search must stop.
+func (s *Searcher) checkStop() {
+	if s.limits.Nodes > 0 && s.nodes >= s.limits.Nodes {
+		s.stopped = true
+	} else if s.nodes&2047 == 0 && s.ctx.Err() != nil {
+		s.stopped = true
+	}
+}
+
+// Whether the current position (the top of the stack) repeats an earlier one.
+// Only positions since the last irreversible move can repeat.
+func (s *Searcher) isRepetition(b *dragon.Board) bool {
+	n := len(s.stack) - 1
+	for i := n - 2; i >= 0 && i >= n-int(b.Halfmoveclock); i -= 2 {
+		if s.stack[i] == s.stack[n] {
+			return true
+		}
+	}
+	return false
+}
+
+// Principal variation search. Returns a fail-soft score for the side to move.
+func (s *Searcher) negamax(b *dragon.Board, depth, ply int, alpha, beta Score, afterNull bool) Score {
+	s.pvLen[ply] = ply
+	pvNode := beta-alpha > 1
+	if ply > 0 {
+		if b.Halfmoveclock >= 100 || s.isRepetition(b) {
+			return DrawScore
+		}
+		// Mate distance pruning: no score here can beat a mate found closer to the root.
+		alpha = maxScore(alpha, matedIn(ply))
+		beta = minScore(beta, -matedIn(ply+1))
+		if alpha >= beta {
+			return alpha
+		}
+	}
+	if s.stopped {
+		return 0
+	}
+	s.nodes++
+	s.checkStop()
+	if s.stopped {
+		return 0
+	}
+
+	var ttMove dragon.Move
+	if s.TT != nil {
+		if e, ok := s.TT.Probe(b.Hash()); ok {
+			ttMove = e.Move
+			score := scoreFromTT(e.Score, ply)
+			if !pvNode && e.Depth >= depth && (e.Bound == BoundExact ||
+				e.Bound == BoundLower && score >= beta || e.Bound == BoundUpper && score <= alpha) {
+				return score
+			}
+		}
+	}
+
+	var list dragon.MoveList
+	inCheck := b.GenerateLegalMovesInto(&list)
+	moves := list.Slice()
+	if len(moves) == 0 {
+		if inCheck {
+			return matedIn(ply)
+		}
+		return DrawScore
+	}
+	if ply >= MaxPly {
+		return s.evaluate(b)
+	}
+	if inCheck {
+		depth++ // check extension
+	}
+	if depth <= 0 {
+		return s.quiesce(b, ply, alpha, beta)
+	}
+
+	// Null-move pruning: if passing still fails high, a real move would too.
+	// Not done in zugzwang-prone positions without pieces, nor twice in a row.
+	if !pvNode && !inCheck && !afterNull && depth >= 3 && hasPieces(b) && s.evaluate(b) >= beta {
+		r := 2 + depth/6
+		unmove := b.NullMove()
+		s.stack = append(s.stack, b.Hash())
+		score := -s.negamax(b, depth-1-r, ply+1, -beta, -beta+1, true)
+		s.stack = s.stack[:len(s.stack)-1]
+		unmove()
+		if s.stopped {
+			return 0
+		}
+		if score >= beta {
+			if score >= mateBound { // don't trust mates found after passing
+				score = beta
+			}
+			return score
+		}
+	}
+
+	s.orderMoves(b, moves, ply, ttMove)
+	best, bestMove, origAlpha := -Infinity, dragon.Move(0), alpha
+	for i, m := range moves {
+		quiet := !dragon.IsCapture(m, b) && m.Promote() == dragon.Nothing
+		givesCheck := b.GivesCheck(m)
+		var undo dragon.Undo
+		b.MakeMove(m, &undo)
+		s.stack = append(s.stack, b.Hash())
+
+		var score Score
+		if i == 0 {
+			score = -s.negamax(b, depth-1, ply+1, -beta, -alpha, false)
+		} else {
+			// Late-move reductions for quiet moves that ordering ranked poorly.
+			reduction := 0
+			if depth >= 3 && i >= 3 && quiet && !inCheck && !givesCheck && !s.isKiller(m, ply) {
+				reduction = 1
+				if i >= 6 && depth >= 6 {
+					reduction = 2
+				}
+			}
+			score = -s.negamax(b, depth-1-reduction, ply+1, -alpha-1, -alpha, false)
+			if score > alpha && reduction > 0 {
+				score = -s.negamax(b, depth-1, ply+1, -alpha-1, -alpha, false)
+			}
+			if score > alpha && score < beta {
+				score = -s.negamax(b, depth-1, ply+1, -beta, -alpha, false)
+			}
+		}
+		s.stack = s.stack[:len(s.stack)-1]
+		b.UnmakeMove(m, &undo)
+		if s.stopped {
+			return 0
+		}
+
+		if score > best {
+			best, bestMove = score, m
+		}
+		if score > alpha {
+			alpha = score
+			s.updatePV(ply, m)
+		}
+		if score >= beta {
+			if quiet {
+				s.recordCutoff(b, m, depth, ply)
+			}
+			break
+		}
+	}
+
+	if s.TT != nil {
+		bound := BoundExact
+		if best >= beta {
+			bound = BoundLower
+		} else if best <= origAlpha {
+			bound, bestMove = BoundUpper, 0 // every move failed low; none is known best
+		}
+		s.TT.Store(b.Hash(), Entry{Move: bestMove, Score: scoreToTT(best, ply), Depth: depth, Bound: bound})
+	}
+	return best
+}
+
+// Searches captures and promotions until the position is quiet, so that the
+// static evaluation is not taken in the middle of an exchange. When in check,
+// all evasions are searched. Stalemates are only found by the main search,
+// since finding them here would mean generating every quiet move.
+func (s *Searcher) quiesce(b *dragon.Board, ply int, alpha, beta Score) Score {
+	s.pvLen[ply] = ply
+	if s.stopped {
+		return 0
+	}
+	s.nodes++
+	s.checkStop()
+	if s.stopped {
+		return 0
+	}
+
+	var list dragon.MoveList
+	inCheck := b.GenerateCaptures(&list)
+	if inCheck {
+		b.GenerateLegalMovesInto(&list)
+		if list.Count == 0 {
+			return matedIn(ply)
+		}
+	}
+	if ply >= MaxPly {
+		return s.evaluate(b)
+	}
+	best := -Infinity
+	if !inCheck {
+		best = s.evaluate(b) // "stand pat": we need not capture anything
+		if best >= beta {
+			return best
+		}
+		alpha = maxScore(alpha, best)
+	}
+	moves := list.Slice()
+
+	s.orderMoves(b, moves, ply, 0)
+	for _, m := range moves {
+		var undo dragon.Undo
+		b.MakeMove(m, &undo)
+		score := -s.quiesce(b, ply+1, -beta, -alpha)
+		b.UnmakeMove(m, &undo)
+		if s.stopped {
+			return 0
+		}
+		if score > best {
+			best = score
+		}
+		if score > alpha {
+			alpha = score
+			s.updatePV(ply, m)
+		}
+		if score >= beta {
+			break
+		}
+	}
+	return best
+}
+
+func (s *Searcher) updatePV(ply int, m dragon.Move) {
+	s.pv[ply][ply] = m
+	copy(s.pv[ply][ply+1:], s.pv[ply+1][ply+1:s.pvLen[ply+1]])
+	s.pvLen[ply] = s.pvLen[ply+1]
+}
+
+// Whether the side to move has anything besides pawns and a king.
+func hasPieces(b *dragon.Board) bool {
+	ours := &b.White
+	if !b.Wtomove {
+		ours = &b.Black
+	}
+	return ours.All&^(ours.Pawns|ours.Kings) != 0
+}
+
+// Material values, indexed by piece type, for move ordering.
+var pieceValues = [7]Score{0, 100, 320, 330, 500, 900, 0}
+
+// The static evaluation, kept clear of the mate scores.
+func (s *Searcher) evaluate(b *dragon.Board) Score {
+	score := Score(s.Evaluator.Evaluate(b))
+	return maxScore(minScore(score, mateBound-1), -mateBound+1)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func minScore(a, b Score) Score {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxScore(a, b Score) Score {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,125 @@
+package search
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/noahklein/dragon"
+)
+
+func TestMates(t *testing.T) {
+	// FEN -> mating move and moves to mate
+	positions := map[string]struct {
+		move   string
+		mateIn int
+	}{
+		"6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1":                                {"a1a8", 1},
+		"r1bqkb1r/pppp1ppp/2n2n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 4 4": {"h5f7", 1},
+		"r5k1/5ppp/8/8/8/8/1R3PPP/1R4K1 w - - 0 1":                            {"b2b8", 2},
+		"7k/1p6/6K1/8/8/8/8/R7 b - - 0 1":                                     {"", -1},
+	}
+	for fen, want := range positions {
+		b := dragon.ParseFen(fen)
+		res := New().Search(context.Background(), b, Limits{Depth: 6})
+		if want.move != "" && res.Move.String() != want.move {
+			t.Error("Wrong move for", fen, "expected", want.move, "got", &res.Move)
+		}
+		if res.Score.MateIn() != want.mateIn {
+			t.Error("Wrong mate distance for", fen, "expected", want.mateIn, "got", res.Score)
+		}
+		if len(res.PV) == 0 || res.PV[0] != res.Move {
+			t.Error("PV does not start with the best move for", fen)
+		}
+	}
+}
+
+func TestTactics(t *testing.T) {
+	positions := map[string]string{
+		"4k3/8/8/3q4/8/8/8/3RK3 w - - 0 1":  "d1d5", // free queen
+		"4k3/8/8/3q4/4P3/8/8/4K3 w - - 0 1": "e4d5", // pawn takes queen
+		"q3k3/8/8/1N6/8/8/8/4K3 w - - 0 1":  "b5c7", // royal fork
+		"1k6/8/8/8/3K3R/8/8/r7 b - - 0 1":   "a1a4", // skewer
+	}
+	for fen, want := range positions {
+		b := dragon.ParseFen(fen)
+		res := New().Search(context.Background(), b, Limits{Depth: 5})
+		if res.Move.String() != want {
+			t.Error("Wrong move for", fen, "expected", want, "got", &res.Move, res.Score)
+		}
+	}
+}
+
+func TestDraws(t *testing.T) {
+	// stalemate
+	b := dragon.ParseFen("7k/5Q2/6K1/8/8/8/8/8 b - - 0 1")
+	res := New().Search(context.Background(), b, Limits{Depth: 3})
+	if res.Move != 0 || res.Score != DrawScore {
+		t.Error("Expected no move and a draw in stalemate, got", &res.Move, res.Score)
+	}
+	// checkmated
+	b = dragon.ParseFen("R5k1/5ppp/8/8/8/8/5PPP/6K1 b - - 0 1")
+	res = New().Search(context.Background(), b, Limits{Depth: 3})
+	if res.Move != 0 || res.Score != matedIn(0) || res.Score.MateIn() != 0 || !res.Score.IsMate() {
+		t.Error("Expected no move and a mate score when mated, got", &res.Move, res.Score)
+	}
+	// a lone king can't lose; repetition of the game history is a draw
+	b = dragon.ParseFen("8/8/8/8/8/2k5/8/K3q3 w - - 10 60")
+	s := New()
+	s.History = []uint64{b.Hash(), 0}
+	res = s.Search(context.Background(), b, Limits{Depth: 4})
+	if res.Move.String() != "a1a2" && res.Move.String() != "a1b2" && res.Move.String() != "a1b1" {
+		t.Error("Unexpected move", &res.Move)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	b := dragon.ParseFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+
+	res := New().Search(context.Background(), b, Limits{Nodes: 5000})
+	if res.Nodes > 5000 || res.Move == 0 {
+		t.Error("Node limit not respected:", res.Nodes, &res.Move)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	iterations := 0
+	s := New()
+	s.Info = func(r Result) {
+		iterations++
+		if r.Depth != iterations || len(r.PV) == 0 {
+			t.Error("Bad iteration report:", r.Depth, r.PV)
+		}
+	}
+	res = s.Search(ctx, b, Limits{})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("Search ignored cancellation, took", elapsed)
+	}
+	if res.Move == 0 || iterations == 0 || res.Depth != iterations {
+		t.Error("Expected a move after a timed search:", &res.Move, iterations)
+	}
+
+	// an already-cancelled search still returns a legal move
+	cancel()
+	res = New().Search(ctx, b, Limits{})
+	if res.Move == 0 {
+		t.Error("Cancelled search returned no move")
+	}
+}
+
+func TestScore(t *testing.T) {
+	scores := map[Score]string{
+		35:             "cp 35",
+		-120:           "cp -120",
+		MateScore - 1:  "mate 1",
+		MateScore - 3:  "mate 2",
+		-MateScore + 2: "mate -1",
+		-MateScore + 4: "mate -2",
+	}
+	for score, want := range scores {
+		if score.String() != want {
+			t.Error("Score", int(score), "formatted as", score.String(), "instead of", want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package search
+
+import (
+	"sync/atomic"
+
+	"github.com/noahklein/dragon"
+)
+
+// The default size of a Searcher's transposition table, in megabytes.
+const DefaultHashMB = 16
+
+// The kind of bound a stored score places on the true score of a position.
+type Bound uint8
+
+const (
+	BoundNone  Bound = iota
+	BoundUpper       // the search failed low: the true score is at most Score
+	BoundLower       // the search failed high: the true score is at least Score
+	BoundExact
+)
+
+// A transposition table entry.
+type Entry struct {
+	Move  dragon.Move // the best move found, or 0
+	Score Score
+	Depth int // the remaining search depth, in plies, from 0 to 255
+	Bound Bound
+	Age   uint8 // the search generation that stored the entry
+}
+
+// A transposition table caches search results by Board.Hash.
+// It has a fixed size, and is safe for concurrent use by multiple searches
+// without locking: each slot stores its key XORed with its data, so a slot
+// torn by concurrent writes fails verification on the next probe and is
+// treated as a miss.
+//
+// Each bucket has two slots: one preferring deeper (and newer) searches, and
+// one that is always replaced. Buckets are 32 bytes, so two share a cache line.
+type TranspositionTable struct {
+	buckets []bucket
+	mask    uint64
+	age     uint32 // updated atomically
+}
+
+type bucket [2]slot // depth-preferred, then always-replace
+
+type slot struct {
+	key  uint64 // hash ^ data
+	data uint64 // a packed Entry; zero if empty
+}
+
+// Creates a transposition table of at most the given size in megabytes, and
+// at least one bucket. The number of buckets is a power of two.
+func NewTranspositionTable(megabytes int) *TranspositionTable {
+	n := uint64(1)
+	for (n*2)*32 <= uint64(megabytes)<<20 {
+		n *= 2
+	}
+	return &TranspositionTable{buckets: make([]bucket, n), mask: n - 1}
+}
+
+// The size of the table, in bytes.
+func (t *TranspositionTable) Size() int {
+	return len(t.buckets) * 32
+}
+
+// Empties the table. Must not be called during a search.
+func (t *TranspositionTable) Clear() {
+	for i := range t.buckets {
+		t.buckets[i] = bucket{}
+	}
+	atomic.StoreUint32(&t.age, 0)
+}
+
+// Starts a new search generation. Entries from earlier generations are
+// replaced in preference to current ones.
+func (t *TranspositionTable) NewSearch() {
+	atomic.AddUint32(&t.age, 1)
+}
+
+// Looks up the entry stored for a position, if any.
+func (t *TranspositionTable) Probe(hash uint64) (Entry, bool) {
+	b := &t.buckets[hash&t.mask]
+	for i := range b {
+		key, data := atomic.LoadUint64(&b[i].key), atomic.LoadUint64(&b[i].data)
+		if data != 0 && key^data == hash {
+			return unpackEntry(data), true
+		}
+	}
+	return Entry{}, false
+}
+
+// Stores a search result for a position. The entry's age is set to the
+// current generation. A stored entry without a move keeps the move of an
+// existing entry for the same position.
+func (t *TranspositionTable) Store(hash uint64, e Entry) {
+	e.Age = uint8(atomic.LoadUint32(&t.age))
+	b := &t.buckets[hash&t.mask]
+	deepData := atomic.LoadUint64(&b[0].data)
+	deepKey, deep := atomic.LoadUint64(&b[0].key)^deepData, unpackEntry(deepData)
+	target := &b[1]
+	if deepKey == hash || deep.Bound == BoundNone || deep.Age != e.Age || e.Depth >= deep.Depth {
+		target = &b[0]
+	}
+	if e.Move == 0 {
+		if old, ok := t.Probe(hash); ok {
+			e.Move = old.Move
+		}
+	}
+	data := packEntry(e)
+	atomic.StoreUint64(&target.data, data)
+	atomic.StoreUint64(&target.key, hash^data)
+}
+
+// The permille of the table holding entries from the current search, estimated
+// from a sample of its first thousand slots, as for the UCI "hashfull" field.
+func (t *TranspositionTable) Hashfull() int {
+	age := uint8(atomic.LoadUint32(&t.age))
+	sampled, used := 0, 0
+	for i := 0; i < len(t.buckets) && sampled < 1000; i++ {
+		for j := range t.buckets[i] {
+			data := atomic.LoadUint64(&t.buckets[i][j].data)
+			if e := unpackEntry(data); data != 0 && e.Age == age {
+				used++
+			}
+			sampled++
+		}
+	}
+	return used * 1000 / sampled
+}
+
+// Entry layout, from the LSB:
+// 16 bits: move
+// 16 bits: score
+// 8 bits: depth
+// 8 bits: bound
+// 8 bits: age
+func packEntry(e Entry) uint64 {
+	depth := e.Depth
+	if depth < 0 {
+		depth = 0
+	} else if depth > 255 {
+		depth = 255
+	}
+	return uint64(e.Move) | uint64(uint16(e.Score))<<16 | uint64(depth)<<32 |
+		uint64(e.Bound)<<40 | uint64(e.Age)<<48
+}
+
+func unpackEntry(data uint64) Entry {
+	return Entry{
+		Move:  dragon.Move(data),
+		Score: Score(int16(data >> 16)),
+		Depth: int(uint8(data >> 32)),
+		Bound: Bound(uint8(data >> 40)),
+		Age:   uint8(data >> 48),
+	}
+}
+
+// Converts a score relative to the root into one relative to the node at ply,
+// for storing: mates are stored as a distance from the stored position.
+func scoreToTT(s Score, ply int) Score {
+	if s >= mateBound {
+		return s + Score(ply)
+	} else if s <= -mateBound {
+		return s - Score(ply)
+	}
+	return s
+}
+
+// The inverse of scoreToTT.
+func scoreFromTT(s Score, ply int) Score {
+	if s >= mateBound {
+		return s - Score(ply)
+	} else if s <= -mateBound {
+		return s + Score(ply)
+	}
+	return s
+}
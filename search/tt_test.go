@@ -0,0 +1,136 @@
+package search
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/noahklein/dragon"
+)
+
+func TestTranspositionTable(t *testing.T) {
+	tt := NewTranspositionTable(1)
+	if tt.Size() != 1<<20 || len(tt.buckets)&(len(tt.buckets)-1) != 0 {
+		t.Error("Bad table size:", tt.Size())
+	}
+	if tiny := NewTranspositionTable(0); tiny.Size() != 32 {
+		t.Error("Expected a single bucket, got", tiny.Size(), "bytes")
+	}
+
+	m, _ := dragon.ParseMove("e7e8q")
+	want := Entry{Move: m, Score: -1234, Depth: 7, Bound: BoundLower}
+	hash := uint64(0xdeadbeef12345678)
+	if _, ok := tt.Probe(hash); ok {
+		t.Error("Probe of an empty table hit")
+	}
+	tt.Store(hash, want)
+	if got, ok := tt.Probe(hash); !ok || got != want {
+		t.Error("Stored", want, "but probed", got, ok)
+	}
+	if _, ok := tt.Probe(hash ^ 1<<62); ok {
+		t.Error("Probe hit for a different position in the same bucket")
+	}
+
+	// A shallower result for another position goes in the always-replace slot,
+	// and doesn't evict the deeper one.
+	other := hash ^ 1<<63
+	tt.Store(other, Entry{Score: 5, Depth: 2, Bound: BoundExact})
+	if got, ok := tt.Probe(hash); !ok || got != want {
+		t.Error("Deep entry was evicted:", got, ok)
+	}
+	if got, ok := tt.Probe(other); !ok || got.Depth != 2 {
+		t.Error("Shallow entry was not stored:", got, ok)
+	}
+	// Storing a position again without a move keeps the old move.
+	tt.Store(hash, Entry{Score: 10, Depth: 8, Bound: BoundUpper})
+	if got, _ := tt.Probe(hash); got.Move != m || got.Depth != 8 {
+		t.Error("Expected the old move to be kept:", got)
+	}
+	// Entries from an old search are replaced by any depth.
+	tt.NewSearch()
+	tt.Store(hash^1<<61, Entry{Score: 1, Depth: 0, Bound: BoundExact})
+	if _, ok := tt.Probe(hash); ok {
+		t.Error("Old entry was not replaced")
+	}
+
+	tt.Clear()
+	if _, ok := tt.Probe(other); ok {
+		t.Error("Probe hit after Clear")
+	}
+}
+
+func TestHashfull(t *testing.T) {
+	tt := NewTranspositionTable(1)
+	if tt.Hashfull() != 0 {
+		t.Error("Empty table has hashfull", tt.Hashfull())
+	}
+	for i := uint64(0); i < 250; i++ {
+		tt.Store(i, Entry{Depth: 1, Bound: BoundExact})
+	}
+	if tt.Hashfull() != 250 {
+		t.Error("Expected hashfull 250, got", tt.Hashfull())
+	}
+	tt.NewSearch()
+	if tt.Hashfull() != 0 {
+		t.Error("Entries from an old search counted in hashfull:", tt.Hashfull())
+	}
+}
+
+func TestMateScoreAdjustment(t *testing.T) {
+	for _, s := range []Score{MateScore - 3, -MateScore + 6, 250, -17} {
+		for ply := 0; ply < 10; ply++ {
+			if got := scoreFromTT(scoreToTT(s, ply), ply); got != s {
+				t.Error("Score", s, "at ply", ply, "came back as", got)
+			}
+		}
+	}
+	// Mate in 1 from a node at ply 4 is mate in 1 wherever the node is found.
+	if got := scoreFromTT(scoreToTT(MateScore-5, 4), 2); got != MateScore-3 {
+		t.Error("Mate distance not relative to the node:", got)
+	}
+}
+
+// Hammers the table from many goroutines; run with -race. Every probe must
+// return an entry that was stored for the probed hash.
+func TestTranspositionTableConcurrent(t *testing.T) {
+	tt := NewTranspositionTable(0) // one bucket, so that every store collides
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(g)))
+			for i := 0; i < 10000; i++ {
+				hash := uint64(r.Intn(16))
+				if r.Intn(2) == 0 {
+					tt.Store(hash, Entry{Score: Score(hash), Depth: int(hash), Bound: BoundExact})
+				} else if e, ok := tt.Probe(hash); ok && (e.Score != Score(hash) || e.Depth != int(hash)) {
+					t.Error("Torn entry for", hash, e)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestSearchWithTT(t *testing.T) {
+	b := dragon.ParseFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	without := New()
+	without.TT = nil
+	want := without.Search(context.Background(), b, Limits{Depth: 5})
+	with := New()
+	got := with.Search(context.Background(), b, Limits{Depth: 5})
+	if got.Nodes >= want.Nodes {
+		t.Error("The transposition table didn't save any nodes:", got.Nodes, "vs", want.Nodes)
+	}
+	if with.TT.Hashfull() == 0 {
+		t.Error("Nothing stored in the transposition table")
+	}
+	// A second search of the same position is quicker still.
+	again := with.Search(context.Background(), b, Limits{Depth: 5})
+	if again.Nodes >= got.Nodes {
+		t.Error("The second search wasn't quicker:", again.Nodes, "vs", got.Nodes)
+	}
+}
@@ -0,0 +1,158 @@
+package dragon
+
+import (
+	"math/bits"
+)
+
+// Piece values for static exchange evaluation, indexed by piece type. The
+// king's value should be large, so that no exchange gives it up. SEEValues are
+// only read, so one set may be shared by concurrent searchers.
+type SEEValues [7]int
+
+// The values used by Board.SEE and Board.SEEGreaterOrEqual.
+var defaultSEEValues = SEEValues{0, 100, 300, 300, 500, 900, 10000}
+
+// Returns the values used by Board.SEE, as a starting point for others.
+func DefaultSEEValues() SEEValues {
+	return defaultSEEValues
+}
+
+// Static exchange evaluation: the material that a move wins or loses, in
+// DefaultSEEValues, if both sides then capture on its destination square with
+// their least valuable piece, as long as it suits them. Pieces behind others
+// that have captured join in, and captures onto the last rank promote to
+// queens. Pins, and checks elsewhere on the board, are not considered.
+// Castling moves evaluate to zero.
+func (b *Board) SEE(m Move) int {
+	return defaultSEEValues.SEE(b, m)
+}
+
+// Whether SEE(m) >= threshold, found without evaluating every capture.
+func (b *Board) SEEGreaterOrEqual(m Move, threshold int) bool {
+	return defaultSEEValues.SEEGreaterOrEqual(b, m, threshold)
+}
+
+// Like Board.SEE, but in these values.
+func (v *SEEValues) SEE(b *Board, m Move) int {
+	x, ok := b.newExchange(m, v)
+	if !ok {
+		return 0
+	}
+	var gain [32]int
+	gain[0] = x.balance
+	depth := 0
+	for ; depth < len(gain)-1; depth++ {
+		bonus, ok := x.recapture()
+		if !ok {
+			break
+		}
+		gain[depth+1] = x.taken + bonus - gain[depth]
+	}
+	// Each side may stop capturing whenever carrying on would lose material.
+	for ; depth > 0; depth-- {
+		gain[depth-1] = -maxInt(-gain[depth-1], gain[depth])
+	}
+	return gain[0]
+}
+
+// Like Board.SEEGreaterOrEqual, but in these values.
+func (v *SEEValues) SEEGreaterOrEqual(b *Board, m Move, threshold int) bool {
+	x, ok := b.newExchange(m, v)
+	if !ok {
+		return 0 >= threshold
+	}
+	// The balance above the threshold, for the side that made the move. Each
+	// side captures only if it turns the result in its favour: otherwise it is
+	// better to stop.
+	balance := x.balance - threshold
+	if balance < 0 {
+		return false
+	}
+	// So while the balance is in the mover's favour, it's the opponent's turn.
+	for {
+		if balance >= 0 {
+			bonus, ok := x.recapture()
+			if !ok || balance-x.taken-bonus >= 0 {
+				return true
+			}
+			balance -= x.taken + bonus
+		} else {
+			bonus, ok := x.recapture()
+			if !ok || balance+x.taken+bonus < 0 {
+				return false
+			}
+			balance += x.taken + bonus
+		}
+	}
+}
+
+// A sequence of captures on one square.
+type exchange struct {
+	b        *Board
+	values   *SEEValues
+	to       uint8
+	occupied uint64 // the pieces yet to capture, and those not involved
+	black    bool   // the side to capture next
+	onSquare Piece  // the piece on the square, for the next capture to take
+	balance  int    // what the first move wins
+	taken    int    // the value of the piece taken by the last recapture
+}
+
+// Starts an exchange with a move; false for castling, which captures nothing.
+func (b *Board) newExchange(m Move, values *SEEValues) (exchange, bool) {
+	info := b.MoveInfo(m)
+	if info.IsCastle() {
+		return exchange{}, false
+	}
+	x := exchange{
+		b:        b,
+		values:   values,
+		to:       m.To(),
+		occupied: (b.White.All | b.Black.All) &^ (uint64(1) << m.From()),
+		black:    b.Wtomove,
+		onSquare: info.Piece(),
+		balance:  values[info.Captured()],
+	}
+	if info.IsEnPassant() {
+		x.occupied &^= uint64(1) << (m.From()&^7 | m.To()&7)
+	}
+	if m.Promote() != Nothing {
+		x.onSquare = m.Promote()
+		x.balance += values[m.Promote()] - values[Pawn]
+	}
+	return x, true
+}
+
+// Makes the next capture, with the least valuable piece of the side to
+// capture, and returns the material it gains by promoting; false if the side
+// can't capture. A king can't capture a defended piece.
+func (x *exchange) recapture() (int, bool) {
+	attackers := x.b.attackersTo(x.to, x.black, x.occupied)
+	if attackers == 0 {
+		return 0, false
+	}
+	ours := &(x.b.White)
+	if x.black {
+		ours = &(x.b.Black)
+	}
+	for piece := Piece(Pawn); piece <= King; piece++ {
+		candidates := attackers & *pieceBitboard(ours, piece)
+		if candidates == 0 {
+			continue
+		}
+		from := uint64(1) << bits.TrailingZeros64(candidates)
+		if piece == King && x.b.attackersTo(x.to, !x.black, x.occupied&^from) != 0 {
+			return 0, false
+		}
+		x.occupied &^= from
+		x.taken = x.values[x.onSquare]
+		x.black = !x.black
+		x.onSquare = piece
+		if piece == Pawn && (x.to < 8 || x.to >= 56) {
+			x.onSquare = Queen
+			return x.values[Queen] - x.values[Pawn], true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,107 @@
+package dragon
+
+import (
+	"testing"
+)
+
+// Values are in DefaultSEEValues: pawn 100, knight and bishop 300, rook
+// 500 and queen 900.
+var seeCases = []struct {
+	fen  string
+	move string
+	want int
+}{
+	// An undefended pawn, and a defended one.
+	{"4k3/8/8/3p4/4P3/8/8/4K3 w - - 0 1", "e4d5", 100},
+	{"4k3/8/4p3/3p4/4P3/8/8/4K3 w - - 0 1", "e4d5", 0},
+	{"4k3/8/4p3/3p4/8/4N3/8/4K3 w - - 0 1", "e3d5", -200},
+	{"1k1r4/1pp4p/p7/4p3/8/P5P1/1PP4P/2K1R3 w - - 0 1", "e1e5", 100},
+	// A long exchange, with the queens lined up behind other pieces.
+	{"1k1r3q/1ppn3p/p4b2/4p3/8/P2N2P1/1PP1R1BP/2K1Q3 w - - 0 1", "d3e5", -200},
+	// X-rays: a rook behind a rook, and a bishop behind the moving queen.
+	{"3r2k1/8/8/3p4/8/8/3R4/3R2K1 w - - 0 1", "d2d5", 100},
+	{"4k3/8/2b5/8/4p3/8/6Q1/7B w - - 0 1", "g2e4", -500},
+	// En passant, defended, and opening the file for a rook behind.
+	{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", 100},
+	{"4k3/2p5/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", 0},
+	{"3rk3/8/8/3pP3/8/8/8/3RK3 w - d6 0 1", "e5d6", 100},
+	// Promotions, with captures, recaptures and underpromotion.
+	{"3r2k1/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7d8q", 1300},
+	{"2kr4/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7d8q", 400},
+	{"3k4/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7e8q", -100},
+	{"3k4/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7e8n", -100},
+	{"4k3/8/8/8/8/4N3/2p5/3r2K1 w - - 0 1", "e3d1", -600},
+	// Kings recapture, unless the piece is still defended.
+	{"3qk3/8/8/8/8/8/8/3RK3 b - - 0 1", "d8d1", -400},
+	{"3qk3/8/8/8/8/1b6/8/3RK3 b - - 0 1", "d8d1", 500},
+	// Quiet moves, hanging a queen and not.
+	{"4k3/8/8/3p4/8/8/8/2Q1K3 w - - 0 1", "c1c4", -900},
+	{Startpos, "g1f3", 0},
+	// Castling.
+	{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", 0},
+}
+
+func TestSEE(t *testing.T) {
+	for _, c := range seeCases {
+		b := ParseFen(c.fen)
+		m := parseMove(c.move)
+		if got := b.SEE(m); got != c.want {
+			t.Errorf("SEE of %s in %s: got %d, expected %d", c.move, c.fen, got, c.want)
+		}
+		for _, threshold := range []int{c.want - 1, c.want, c.want + 1} {
+			if got := b.SEEGreaterOrEqual(m, threshold); got != (c.want >= threshold) {
+				t.Errorf("SEEGreaterOrEqual of %s in %s with threshold %d: got %v", c.move, c.fen, threshold, got)
+			}
+		}
+	}
+}
+
+// SEEGreaterOrEqual agrees with SEE for every move in a perft tree, at a range
+// of thresholds.
+func TestSEEGreaterOrEqual(t *testing.T) {
+	positions := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+	}
+	var walk func(b *Board, depth int)
+	walk = func(b *Board, depth int) {
+		var moves MoveList
+		b.GenerateLegalMovesInto(&moves)
+		for _, m := range moves.Slice() {
+			see := b.SEE(m)
+			for threshold := -1500; threshold <= 1500; threshold += 100 {
+				for _, th := range []int{threshold, see} {
+					if b.SEEGreaterOrEqual(m, th) != (see >= th) {
+						t.Fatalf("SEEGreaterOrEqual of %v with threshold %d disagrees with SEE %d in %s", &m, th, see, b.ToFen())
+					}
+				}
+			}
+			if depth > 1 {
+				var undo Undo
+				b.MakeMove(m, &undo)
+				walk(b, depth-1)
+				b.UnmakeMove(m, &undo)
+			}
+		}
+	}
+	for _, fen := range positions {
+		b := ParseFen(fen)
+		walk(&b, 2)
+	}
+}
+
+func TestSEEValues(t *testing.T) {
+	values := SEEValues{0, 100, 325, 325, 500, 1000, 10000}
+	b := ParseFen("4k3/8/4p3/3p4/8/4N3/8/4K3 w - - 0 1")
+	m := parseMove("e3d5")
+	if got := values.SEE(&b, m); got != -225 {
+		t.Error("SEE with custom values: got", got, "expected -225")
+	}
+	if values.SEEGreaterOrEqual(&b, m, -200) || !values.SEEGreaterOrEqual(&b, m, -225) {
+		t.Error("SEEGreaterOrEqual with custom values disagrees with SEE")
+	}
+	if got := b.SEE(m); got != -200 || DefaultSEEValues()[Knight] != 300 {
+		t.Error("Custom values changed the defaults: got", got)
+	}
+}
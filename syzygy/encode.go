@@ -0,0 +1,318 @@
+package syzygy
+
+import (
+	"math/bits"
+	"sort"
+
+	"github.com/noahklein/dragon"
+)
+
+// Syzygy tables index positions by a perfect encoding of the piece placements,
+// after using the board's symmetries to put the leading piece (or pawn) in a
+// canonical region. These tables implement that encoding.
+var (
+	// Binomial coefficients: binomial[k][n] is the number of ways to choose k
+	// of n squares.
+	binomial [7][64]uint64
+	// Encodes a square below the a1-h8 diagonal as 0..27.
+	mapB1H1H7 [64]int
+	// Encodes a square in the a1-d1-d4 triangle as 0..9, diagonal squares last.
+	mapA1D1D4 [64]int
+	// Encodes the 462 placements of two kings, the first in the a1-d1-d4
+	// triangle, and the second not above the diagonal if the first is on it.
+	mapKK [10][64]int
+	// Encodes pawn squares a2-h7 as 0..47, so that the leading pawn, nearest
+	// the a-file and then lowest, has the highest value.
+	mapPawns [64]int
+	// The index of each leading pawn square, by number of leading pawns, and
+	// the number of indices for each file.
+	leadPawnIdx   [6][64]uint64
+	leadPawnsSize [6][4]uint64
+)
+
+func rankOf(sq int) int { return sq >> 3 }
+func fileOf(sq int) int { return sq & 7 }
+
+// Positive above the a1-h8 diagonal, negative below it, zero on it.
+func offA1H8(sq int) int { return rankOf(sq) - fileOf(sq) }
+
+func init() {
+	code := 0
+	for sq := 0; sq < 64; sq++ {
+		if offA1H8(sq) < 0 {
+			mapB1H1H7[sq] = code
+			code++
+		}
+	}
+
+	code = 0
+	var diagonal []int
+	for sq := 0; sq <= 27; sq++ { // a1 to d4
+		if offA1H8(sq) < 0 && fileOf(sq) <= 3 {
+			mapA1D1D4[sq] = code
+			code++
+		} else if offA1H8(sq) == 0 && fileOf(sq) <= 3 {
+			diagonal = append(diagonal, sq)
+		}
+	}
+	for _, sq := range diagonal {
+		mapA1D1D4[sq] = code
+		code++
+	}
+
+	type kk struct{ idx, sq int }
+	var bothOnDiagonal []kk
+	code = 0
+	for idx := 0; idx < 10; idx++ {
+		for s1 := 0; s1 <= 27; s1++ {
+			if mapA1D1D4[s1] != idx || (idx == 0 && s1 != 1) { // b1 is mapped to 0
+				continue
+			}
+			for s2 := 0; s2 < 64; s2++ {
+				if kingReach(s1)&(uint64(1)<<s2) != 0 {
+					continue // illegal position
+				} else if offA1H8(s1) == 0 && offA1H8(s2) > 0 {
+					continue // first on the diagonal, second above
+				} else if offA1H8(s1) == 0 && offA1H8(s2) == 0 {
+					bothOnDiagonal = append(bothOnDiagonal, kk{idx, s2})
+				} else {
+					mapKK[idx][s2] = code
+					code++
+				}
+			}
+		}
+	}
+	for _, p := range bothOnDiagonal {
+		mapKK[p.idx][p.sq] = code
+		code++
+	}
+
+	binomial[0][0] = 1
+	for n := 1; n < 64; n++ {
+		for k := 0; k < 7 && k <= n; k++ {
+			if k > 0 {
+				binomial[k][n] += binomial[k-1][n-1]
+			}
+			if k < n {
+				binomial[k][n] += binomial[k][n-1]
+			}
+		}
+	}
+
+	available := 47
+	for leadPawns := 1; leadPawns <= 5; leadPawns++ {
+		for f := 0; f < 4; f++ {
+			var idx uint64
+			for r := 1; r <= 6; r++ {
+				sq := 8*r + f
+				if leadPawns == 1 {
+					mapPawns[sq] = available
+					available--
+					mapPawns[sq^7] = available
+					available--
+				}
+				leadPawnIdx[leadPawns][sq] = idx
+				idx += binomial[leadPawns-1][mapPawns[sq]]
+			}
+			leadPawnsSize[leadPawns][f] = idx
+		}
+	}
+}
+
+// The square a king stands on, and those it attacks.
+func kingReach(sq int) uint64 {
+	var reach uint64
+	for dr := -1; dr <= 1; dr++ {
+		for df := -1; df <= 1; df++ {
+			r, f := rankOf(sq)+dr, fileOf(sq)+df
+			if r >= 0 && r < 8 && f >= 0 && f < 8 {
+				reach |= uint64(1) << (8*r + f)
+			}
+		}
+	}
+	return reach
+}
+
+// Piece codes, as stored in table files: white pieces are dragon's piece
+// types, and black pieces have the 8 bit set.
+const blackBit = 8
+
+// The pieces of a position, as codes and squares.
+func piecesOf(b *dragon.Board) (pcs []uint8, sqs []int) {
+	for color, bb := range [2]*dragon.Bitboards{&b.White, &b.Black} {
+		for piece, pieces := range [6]uint64{bb.Pawns, bb.Knights, bb.Bishops, bb.Rooks, bb.Queens, bb.Kings} {
+			for ; pieces != 0; pieces &= pieces - 1 {
+				pcs = append(pcs, uint8(piece+1+color*blackBit))
+				sqs = append(sqs, bits.TrailingZeros64(pieces))
+			}
+		}
+	}
+	return pcs, sqs
+}
+
+// Computes which of a table's subtables holds a position, and the position's
+// index in it. The position must have the table's material, for either
+// colour. Returns ok == false for a DTZ table that only stores the other side
+// to move.
+func (t *table) encode(b *dragon.Board) (d *pairsData, file int, idx uint64, ok bool) {
+	pcs, sqs := piecesOf(b)
+	// Tables only store the stronger side as White, and symmetric tables only
+	// store White to move; flip the board if needed.
+	symmetricBlackToMove := t.key == t.key2 && !b.Wtomove
+	blackStronger := materialKeyOf(b) != t.key
+	flip := symmetricBlackToMove || blackStronger
+	stm := 0
+	if flip == b.Wtomove {
+		stm = 1
+	}
+	var flipColor uint8
+	flipSquares := 0
+	if flip {
+		flipColor, flipSquares = blackBit, 56
+	}
+
+	squares := make([]int, 0, len(pcs))
+	pieces := make([]uint8, 0, len(pcs))
+	leadPawnsCnt := 0
+	if t.hasPawns {
+		// Pawns come first in the piece sequence of every subtable, and their
+		// colour leads.
+		lead := t.items[0][0].pieces[0] ^ flipColor
+		for i, pc := range pcs {
+			if pc == lead {
+				squares = append(squares, sqs[i]^flipSquares)
+				pieces = append(pieces, pc^flipColor)
+			}
+		}
+		leadPawnsCnt = len(squares)
+		best := 0
+		for i := 1; i < leadPawnsCnt; i++ {
+			if mapPawns[squares[i]] > mapPawns[squares[best]] {
+				best = i
+			}
+		}
+		squares[0], squares[best] = squares[best], squares[0]
+		file = fileOf(squares[0])
+		if file > 3 {
+			file = 7 - file
+		}
+	}
+
+	if t.kind == dtz && !t.dtzStoresSide(stm, file) {
+		return nil, 0, 0, false
+	}
+
+	for i, pc := range pcs {
+		if !t.hasPawns || pc != t.items[0][0].pieces[0]^flipColor {
+			squares = append(squares, sqs[i]^flipSquares)
+			pieces = append(pieces, pc^flipColor)
+		}
+	}
+	d = t.get(stm, file)
+	size := len(squares)
+
+	// Order the pieces as in the table's piece sequence.
+	for i := leadPawnsCnt; i < size-1; i++ {
+		for j := i + 1; j < size; j++ {
+			if d.pieces[i] == pieces[j] {
+				pieces[i], pieces[j] = pieces[j], pieces[i]
+				squares[i], squares[j] = squares[j], squares[i]
+				break
+			}
+		}
+	}
+
+	// Mirror so that the leading piece is on files a-d.
+	if fileOf(squares[0]) > 3 {
+		for i := range squares {
+			squares[i] ^= 7
+		}
+	}
+
+	if t.hasPawns {
+		idx = leadPawnIdx[leadPawnsCnt][squares[0]]
+		rest := squares[1:leadPawnsCnt]
+		sort.SliceStable(rest, func(i, j int) bool { return mapPawns[rest[i]] < mapPawns[rest[j]] })
+		for i := 1; i < leadPawnsCnt; i++ {
+			idx += binomial[i][mapPawns[squares[i]]]
+		}
+	} else {
+		// Without pawns, also mirror the leading piece onto ranks 1-4, and
+		// then below the a1-h8 diagonal.
+		if rankOf(squares[0]) > 3 {
+			for i := range squares {
+				squares[i] ^= 56
+			}
+		}
+		for i := 0; i < d.groupLen[0]; i++ {
+			if offA1H8(squares[i]) == 0 {
+				continue
+			}
+			if offA1H8(squares[i]) > 0 {
+				for j := i; j < size; j++ {
+					squares[j] = ((squares[j] >> 3) | (squares[j] << 3)) & 63
+				}
+			}
+			break
+		}
+		idx = t.encodeLeadingPieces(squares)
+	}
+
+	// Encode the remaining groups, each as a combination of squares.
+	idx *= d.groupIdx[0]
+	group := d.groupLen[0]
+	remainingPawns := t.hasPawns && t.pawnCount[1] > 0
+	for next := 1; d.groupLen[next] != 0; next++ {
+		groupSq := squares[group : group+d.groupLen[next]]
+		sort.Ints(groupSq)
+		var n uint64
+		for i, sq := range groupSq {
+			adjust := 0
+			for _, prev := range squares[:group] {
+				if sq > prev {
+					adjust++
+				}
+			}
+			pawnAdjust := 0
+			if remainingPawns {
+				pawnAdjust = 8
+			}
+			n += binomial[i+1][sq-adjust-pawnAdjust]
+		}
+		remainingPawns = false
+		idx += n * d.groupIdx[next]
+		group += d.groupLen[next]
+	}
+	return d, file, idx, true
+}
+
+// Encodes the leading group of a pawnless table: three unique pieces, or the
+// two kings.
+func (t *table) encodeLeadingPieces(sq []int) uint64 {
+	if !t.hasUniquePieces {
+		return uint64(mapKK[mapA1D1D4[sq[0]]][sq[1]])
+	}
+	adjust1, adjust2 := 0, 0
+	if sq[1] > sq[0] {
+		adjust1 = 1
+	}
+	if sq[2] > sq[0] {
+		adjust2++
+	}
+	if sq[2] > sq[1] {
+		adjust2++
+	}
+	switch {
+	case offA1H8(sq[0]) != 0:
+		// The first piece is below the diagonal, in the b1-d1-d3 triangle.
+		return uint64((mapA1D1D4[sq[0]]*63+sq[1]-adjust1)*62 + sq[2] - adjust2)
+	case offA1H8(sq[1]) != 0:
+		// The first piece is on the diagonal, the second below.
+		return uint64((6*63+rankOf(sq[0])*28+mapB1H1H7[sq[1]])*62 + sq[2] - adjust2)
+	case offA1H8(sq[2]) != 0:
+		// The first two pieces are on the diagonal, the third below.
+		return uint64(6*63*62 + 4*28*62 + rankOf(sq[0])*7*28 + (rankOf(sq[1])-adjust1)*28 + mapB1H1H7[sq[2]])
+	}
+	// All three pieces are on the diagonal.
+	return uint64(6*63*62 + 4*28*62 + 4*7*28 + rankOf(sq[0])*7*6 + (rankOf(sq[1])-adjust1)*6 + rankOf(sq[2]) - adjust2)
+}
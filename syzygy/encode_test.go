@@ -0,0 +1,164 @@
+package syzygy
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/noahklein/dragon"
+)
+
+// Sets up a table's subtables as a table file would, with the same piece
+// order for every side and file.
+func testTable(t *testing.T, kind tableKind, name string, pieces ...uint8) *table {
+	tb, err := newTable(kind, name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for s := 0; s < 2; s++ {
+		for f := 0; f < 4; f++ {
+			d := &tb.items[s][f]
+			copy(d.pieces[:], pieces)
+			tb.setGroups(d, [2]int{0, 15}, f)
+		}
+	}
+	return tb
+}
+
+// Builds a board from piece codes and squares.
+func boardOf(wtomove bool, pieces []uint8, squares []int) dragon.Board {
+	b := dragon.Board{Wtomove: wtomove}
+	for i, pc := range pieces {
+		color := dragon.White
+		if pc&blackBit != 0 {
+			color = dragon.Black
+		}
+		b.PutPiece(dragon.Square(squares[i]), dragon.Piece(pc&^blackBit), color)
+	}
+	return b
+}
+
+// Applies one of the board's 8 symmetries to a square.
+func transform(sq, sym int) int {
+	if sym&1 != 0 {
+		sq ^= 7
+	}
+	if sym&2 != 0 {
+		sq ^= 56
+	}
+	if sym&4 != 0 {
+		sq = ((sq >> 3) | (sq << 3)) & 63
+	}
+	return sq
+}
+
+func TestEncodingTables(t *testing.T) {
+	max := 0
+	for _, row := range mapKK {
+		for _, code := range row {
+			if code > max {
+				max = code
+			}
+		}
+	}
+	if max != 461 {
+		t.Error("Expected 462 king placements, got", max+1)
+	}
+	if binomial[2][4] != 6 || binomial[3][10] != 120 || binomial[5][63] != 7028847 {
+		t.Error("Bad binomial coefficients")
+	}
+	var sum uint64
+	for f := 0; f < 4; f++ {
+		sum += leadPawnsSize[1][f]
+	}
+	if sum != 24 {
+		t.Error("Expected 24 squares for a single leading pawn, got", sum)
+	}
+	if mapPawns[8] != 47 || mapPawns[15] != 46 || mapA1D1D4[1] != 0 || mapA1D1D4[0] != 6 {
+		t.Error("Bad square maps")
+	}
+}
+
+// Checks that positions are encoded within the table, and that positions
+// sharing an index are images of each other under the table's symmetries.
+func TestEncodeIndex(t *testing.T) {
+	cases := []struct {
+		name   string
+		pieces []uint8
+		syms   int // the number of symmetries that apply
+	}{
+		{"KRvK", []uint8{6, 4, 14}, 8},
+		{"KPvK", []uint8{1, 6, 14}, 2},
+	}
+	for _, c := range cases {
+		tb := testTable(t, wdl, c.name, c.pieces...)
+		seen := map[[3]uint64]int{}
+		for n := 0; n < 64*64*64*2; n++ {
+			sq := []int{n >> 13 & 63, n >> 7 & 63, n >> 1 & 63}
+			if sq[0] == sq[1] || sq[0] == sq[2] || sq[1] == sq[2] {
+				continue
+			}
+			if c.pieces[0] == 1 && (sq[0] < 8 || sq[0] >= 56) {
+				continue
+			}
+			b := boardOf(n&1 == 0, c.pieces, sq)
+			d, file, idx, _ := tb.encode(&b)
+			if idx >= d.size() {
+				t.Fatalf("%v: index %v of %v is out of range", c.name, idx, sq)
+			}
+			canon := 1 << 30
+			for sym := 0; sym < c.syms; sym++ {
+				code := transform(sq[0], sym)<<12 | transform(sq[1], sym)<<6 | transform(sq[2], sym)
+				if code < canon {
+					canon = code
+				}
+			}
+			key := [3]uint64{uint64(n & 1), uint64(file), idx}
+			if prev, ok := seen[key]; ok && prev != canon {
+				t.Fatalf("%v: %v shares index %v with another position", c.name, sq, idx)
+			}
+			seen[key] = canon
+		}
+	}
+}
+
+// Checks that symmetric images of positions, and colour-flipped positions,
+// share an index, for a table with kings as the leading group.
+func TestEncodeSymmetry(t *testing.T) {
+	tb := testTable(t, wdl, "KRRvK", 6, 14, 4, 4)
+	r := rand.New(rand.NewSource(1))
+	pieces := []uint8{6, 14, 4, 4}
+	flipped := []uint8{14, 6, 12, 12}
+	for n := 0; n < 5000; n++ {
+		sq := r.Perm(64)[:4]
+		if kingReach(sq[0])&(1<<sq[1]) != 0 {
+			continue
+		}
+		b := boardOf(true, pieces, sq)
+		d, _, idx, _ := tb.encode(&b)
+		if idx >= d.size() {
+			t.Fatalf("Index %v of %v is out of range", idx, sq)
+		}
+		// With both kings on a diagonal, mirroring on it isn't undone.
+		syms := 8
+		if offA1H8(sq[0]) == 0 || offA1H8(sq[0]^7) == 0 {
+			syms = 4
+		}
+		for sym := 1; sym < syms; sym++ {
+			img := make([]int, 4)
+			for i := range sq {
+				img[i] = transform(sq[i], sym)
+			}
+			b := boardOf(true, pieces, img)
+			if _, _, got, _ := tb.encode(&b); got != idx {
+				t.Errorf("Symmetry %v of %v: index %v, expected %v", sym, sq, got, idx)
+			}
+			for i := range img {
+				img[i] ^= 56
+			}
+			b = boardOf(false, flipped, img)
+			if _, _, got, _ := tb.encode(&b); got != idx {
+				t.Errorf("Colour flip of %v: index %v, expected %v", img, got, idx)
+			}
+		}
+	}
+}
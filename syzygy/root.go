@@ -0,0 +1,99 @@
+package syzygy
+
+import "github.com/noahklein/dragon"
+
+// Ranks above this win despite the 50-move rule; see rootRank.
+const maxDTZ = 1 << 18
+
+// Returns the legal moves that keep the best result reachable from a
+// position, and that result, taking the 50-move rule into account from the
+// board's Halfmoveclock.
+//
+// When winning, these are the moves with the lowest DTZ, so that playing
+// them always makes progress; a win that the 50-move rule would spoil is a
+// cursed win, and the moves nearest to zeroing are kept. When losing, the
+// moves that resist longest are kept. When drawing, all drawing moves are.
+//
+// Repetitions are not detected, as the board holds no history.
+func (tb *Tablebase) RootMoves(b *dragon.Board) ([]dragon.Move, WDL, error) {
+	if err := tb.probeable(b); err != nil {
+		return nil, Draw, err
+	}
+	moves, _ := b.GenerateLegalMoves()
+	ranks := make([]int, len(moves))
+	best := -maxDTZ - 1
+	for i, m := range moves {
+		dtz, err := tb.moveDTZ(b, m)
+		if err != nil {
+			return nil, Draw, err
+		}
+		ranks[i] = rootRank(dtz, int(b.Halfmoveclock))
+		if ranks[i] > best {
+			best = ranks[i]
+		}
+	}
+	var optimal []dragon.Move
+	for i, m := range moves {
+		if ranks[i] == best {
+			optimal = append(optimal, m)
+		}
+	}
+	return optimal, rankWDL(best), nil
+}
+
+// Returns the DTZ of a position after a move, counted from before the move.
+func (tb *Tablebase) moveDTZ(b *dragon.Board, m dragon.Move) (int, error) {
+	unapply := b.Apply(m)
+	defer unapply()
+	var dtz int
+	if b.Halfmoveclock == 0 {
+		// A zeroing move: only the result after it matters.
+		w, _, err := tb.search(b, false)
+		if err != nil {
+			return 0, err
+		}
+		dtz = dtzBeforeZeroing(-w)
+	} else if b.Halfmoveclock >= 100 && !isMate(b) {
+		dtz = 0 // the move claims a 50-move draw
+	} else {
+		d, err := tb.probeDTZ(b)
+		if err != nil {
+			return 0, err
+		}
+		dtz = -d
+		dtz += sign(dtz)
+	}
+	// A mating move has a DTZ of 1.
+	if dtz == 2 && isMate(b) {
+		dtz = 1
+	}
+	return dtz, nil
+}
+
+// Ranks a move by its DTZ and the 50-move counter before it. Wins rank above
+// maxDTZ-100 if they come before the 50-move rule draws, and faster wins
+// rank higher; losses rank below -maxDTZ+100 unless the 50-move rule saves
+// them, and slower losses rank higher.
+func rootRank(dtz, halfmoves int) int {
+	switch {
+	case dtz > 0:
+		return maxDTZ - dtz - halfmoves
+	case dtz < 0:
+		return -maxDTZ - dtz + halfmoves
+	}
+	return 0
+}
+
+func rankWDL(rank int) WDL {
+	switch {
+	case rank >= maxDTZ-100:
+		return Win
+	case rank > 0:
+		return CursedWin
+	case rank == 0:
+		return Draw
+	case rank > -maxDTZ+100:
+		return BlessedLoss
+	}
+	return Loss
+}
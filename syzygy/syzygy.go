@@ -0,0 +1,310 @@
+// Package syzygy probes Syzygy endgame tablebases.
+//
+// WDL tables (.rtbw) give the win/draw/loss result of a position, and DTZ
+// tables (.rtbz) give the distance to the next capture or pawn move
+// ("zeroing" the 50-move counter) on an optimal path. Tables are read into
+// memory when first probed.
+//
+// Positions with castling rights are not in the tables. En passant captures
+// are handled by searching them.
+package syzygy
+
+import (
+	"errors"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/noahklein/dragon"
+)
+
+var (
+	ErrNoTable  = errors.New("syzygy: no table for position")
+	ErrCastling = errors.New("syzygy: position has castling rights")
+)
+
+// A game-theoretic result, for the side to move. Cursed wins and blessed
+// losses are wins and losses that the 50-move rule turns into draws.
+type WDL int
+
+const (
+	Loss        WDL = -2
+	BlessedLoss WDL = -1
+	Draw        WDL = 0
+	CursedWin   WDL = 1
+	Win         WDL = 2
+)
+
+func (w WDL) String() string {
+	switch w {
+	case Loss:
+		return "loss"
+	case BlessedLoss:
+		return "blessed loss"
+	case Draw:
+		return "draw"
+	case CursedWin:
+		return "cursed win"
+	case Win:
+		return "win"
+	}
+	return "unknown"
+}
+
+// A set of tablebase files. Safe for concurrent use.
+type Tablebase struct {
+	tables    map[materialKey]*entry
+	maxPieces int
+}
+
+// The WDL and DTZ tables for a material signature; dtz may be nil.
+type entry struct {
+	wdl, dtz *table
+}
+
+// Opens the tables in a directory. Only files are listed here; each table is
+// read when first probed. A DTZ table is used only with its WDL table.
+func Open(dir string) (*Tablebase, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	tb := &Tablebase{tables: make(map[materialKey]*entry)}
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasSuffix(name, extensions[wdl]) {
+			continue
+		}
+		name = strings.TrimSuffix(name, extensions[wdl])
+		t, err := newTable(wdl, name, filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		e := &entry{wdl: t}
+		dtzPath := filepath.Join(dir, name+extensions[dtz])
+		if _, err := os.Stat(dtzPath); err == nil {
+			if e.dtz, err = newTable(dtz, name, dtzPath); err != nil {
+				return nil, err
+			}
+		}
+		tb.tables[t.key] = e
+		tb.tables[t.key2] = e
+		if t.pieceCount > tb.maxPieces {
+			tb.maxPieces = t.pieceCount
+		}
+	}
+	return tb, nil
+}
+
+// The largest number of pieces, kings included, in any table.
+func (tb *Tablebase) MaxPieces() int {
+	return tb.maxPieces
+}
+
+// Returns the result of a position, from the side to move's point of view,
+// assuming the 50-move counter is zero.
+func (tb *Tablebase) ProbeWDL(b *dragon.Board) (WDL, error) {
+	if err := tb.probeable(b); err != nil {
+		return Draw, err
+	}
+	w, _, err := tb.search(b, false)
+	return w, err
+}
+
+// Returns the number of plies to the next zeroing move on an optimal path,
+// positive when the side to move wins and negative when it loses, or 0 for a
+// draw. Cursed wins and blessed losses are counted beyond 100. A mated
+// position has a DTZ of -1.
+//
+// Wins and losses are exact when the 50-move counter is zero; otherwise DTZ
+// may be off by one, but always preserves the result.
+func (tb *Tablebase) ProbeDTZ(b *dragon.Board) (int, error) {
+	if err := tb.probeable(b); err != nil {
+		return 0, err
+	}
+	return tb.probeDTZ(b)
+}
+
+func (tb *Tablebase) probeable(b *dragon.Board) error {
+	if wk, wq, bk, bq := b.CastlingRights(); wk || wq || bk || bq {
+		return ErrCastling
+	}
+	if popcount(b.White.All|b.Black.All) > tb.maxPieces {
+		return ErrNoTable
+	}
+	return nil
+}
+
+// Tables store "don't care" values for positions where the side to move has
+// a winning capture, and may store a loss where a capture draws; en passant
+// is not stored at all. So the result of a position is the best of probing
+// it and searching its captures; zeroing is true when a capture is that best
+// move, or when the DTZ table can't be trusted. With pawnMoves, pawn moves
+// are searched too, as DTZ tables need.
+func (tb *Tablebase) search(b *dragon.Board, pawnMoves bool) (best WDL, zeroing bool, err error) {
+	moves, _ := b.GenerateLegalMoves()
+	best = Loss
+	searched := 0
+	for _, m := range moves {
+		if !dragon.IsCapture(m, b) && (!pawnMoves || !isPawnMove(b, m)) {
+			continue
+		}
+		searched++
+		unapply := b.Apply(m)
+		v, _, err := tb.search(b, false)
+		unapply()
+		if err != nil {
+			return Draw, false, err
+		}
+		if -v > best {
+			best = -v
+			if best == Win {
+				return Win, true, nil
+			}
+		}
+	}
+
+	// If every move was searched the stored value can be wrong, eg: if the
+	// only legal move is en passant.
+	noMoreMoves := searched > 0 && searched == len(moves)
+	var v WDL
+	if noMoreMoves {
+		v = best
+	} else if v, err = tb.probeWDLTable(b); err != nil {
+		return Draw, false, err
+	}
+	if best >= v {
+		return best, best > Draw || noMoreMoves, nil
+	}
+	return v, false, nil
+}
+
+func (tb *Tablebase) probeWDLTable(b *dragon.Board) (WDL, error) {
+	if popcount(b.White.All|b.Black.All) == 2 {
+		return Draw, nil
+	}
+	e := tb.tables[materialKeyOf(b)]
+	if e == nil {
+		return Draw, ErrNoTable
+	}
+	if err := e.wdl.load(); err != nil {
+		return Draw, err
+	}
+	d, _, idx, _ := e.wdl.encode(b)
+	return WDL(d.decompress(e.wdl.buf, idx) - 2), nil
+}
+
+// Probes the DTZ table, which reports false if it stores the other side to
+// move.
+func (tb *Tablebase) probeDTZTable(b *dragon.Board, w WDL) (int, bool, error) {
+	e := tb.tables[materialKeyOf(b)]
+	if e == nil || e.dtz == nil {
+		return 0, false, ErrNoTable
+	}
+	if err := e.dtz.load(); err != nil {
+		return 0, false, err
+	}
+	d, _, idx, ok := e.dtz.encode(b)
+	if !ok {
+		return 0, false, nil
+	}
+	return e.dtz.mapScore(d, d.decompress(e.dtz.buf, idx), w), true, nil
+}
+
+func (tb *Tablebase) probeDTZ(b *dragon.Board) (int, error) {
+	w, zeroing, err := tb.search(b, true)
+	if err != nil || w == Draw {
+		return 0, err
+	}
+	if zeroing {
+		return dtzBeforeZeroing(w), nil
+	}
+	dtz, ok, err := tb.probeDTZTable(b, w)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		if w == BlessedLoss || w == CursedWin {
+			dtz += 100
+		}
+		if w < Draw {
+			dtz = -dtz
+		}
+		return dtz, nil
+	}
+
+	// The table stores the other side to move: take the best move's DTZ.
+	moves, _ := b.GenerateLegalMoves()
+	best := 0xffff
+	for _, m := range moves {
+		zeroing := dragon.IsCapture(m, b) || isPawnMove(b, m)
+		unapply := b.Apply(m)
+		var dtz int
+		if zeroing {
+			// The DTZ of a zeroing move counts from before it.
+			var v WDL
+			v, _, err = tb.search(b, false)
+			dtz = -dtzBeforeZeroing(v)
+		} else {
+			dtz, err = tb.probeDTZ(b)
+			dtz = -dtz
+		}
+		if dtz == 1 && isMate(b) {
+			best = 1
+		}
+		unapply()
+		if err != nil {
+			return 0, err
+		}
+		if !zeroing {
+			dtz += sign(dtz)
+		}
+		// Skip draws, and when winning, moves that don't win.
+		if dtz < best && sign(dtz) == sign(int(w)) {
+			best = dtz
+		}
+	}
+	if best == 0xffff {
+		return -1, nil // mated
+	}
+	return best, nil
+}
+
+// The DTZ of a position whose best move zeroes the 50-move counter.
+func dtzBeforeZeroing(w WDL) int {
+	switch w {
+	case Win:
+		return 1
+	case CursedWin:
+		return 101
+	case BlessedLoss:
+		return -101
+	case Loss:
+		return -1
+	}
+	return 0
+}
+
+func isPawnMove(b *dragon.Board, m dragon.Move) bool {
+	return (b.White.Pawns|b.Black.Pawns)&(uint64(1)<<m.From()) != 0
+}
+
+func isMate(b *dragon.Board) bool {
+	moves, inCheck := b.GenerateLegalMoves()
+	return inCheck && len(moves) == 0
+}
+
+func popcount(bb uint64) int {
+	return bits.OnesCount64(bb)
+}
+
+func sign(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
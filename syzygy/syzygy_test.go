@@ -0,0 +1,714 @@
+package syzygy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/noahklein/dragon"
+)
+
+// KRvK positions, indexed by wk<<12 | wr<<6 | bk.
+const krkSize = 64 * 64 * 64
+
+const (
+	unknown = -1
+	drawn   = -2
+	illegal = -3
+)
+
+// The number of plies to mate in every KRvK position, by side to move, or
+// drawn or illegal, solved by retrograde analysis.
+type krk struct {
+	white, black [krkSize]int8
+}
+
+func bit(sq int) uint64 { return uint64(1) << sq }
+
+// The squares a rook attacks, with the first blocker on each ray.
+func rookReach(sq int, occ uint64) uint64 {
+	var reach uint64
+	for _, dir := range [4][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+		r, f := rankOf(sq)+dir[0], fileOf(sq)+dir[1]
+		for r >= 0 && r < 8 && f >= 0 && f < 8 {
+			reach |= bit(8*r + f)
+			if occ&bit(8*r+f) != 0 {
+				break
+			}
+			r, f = r+dir[0], f+dir[1]
+		}
+	}
+	return reach
+}
+
+func krkSquares(s int) (wk, wr, bk int) { return s >> 12, s >> 6 & 63, s & 63 }
+
+func krkIndex(wk, wr, bk int) int { return wk<<12 | wr<<6 | bk }
+
+// Returns the positions after each of White's moves.
+func krkWhiteMoves(s int) []int {
+	wk, wr, bk := krkSquares(s)
+	var moves []int
+	for to := kingReach(wk) &^ bit(wk) &^ bit(wr) &^ kingReach(bk); to != 0; to &= to - 1 {
+		moves = append(moves, krkIndex(bits.TrailingZeros64(to), wr, bk))
+	}
+	for to := rookReach(wr, bit(wk)|bit(bk)) &^ bit(wk) &^ bit(bk); to != 0; to &= to - 1 {
+		moves = append(moves, krkIndex(wk, bits.TrailingZeros64(to), bk))
+	}
+	return moves
+}
+
+// Returns the positions after each of Black's moves, other than capturing
+// the rook, and whether capturing it is legal.
+func krkBlackMoves(s int) (moves []int, capture bool) {
+	wk, wr, bk := krkSquares(s)
+	for to := kingReach(bk) &^ bit(bk) &^ kingReach(wk); to != 0; to &= to - 1 {
+		sq := bits.TrailingZeros64(to)
+		if sq == wr {
+			capture = true
+		} else if rookReach(wr, bit(wk))&bit(sq) == 0 {
+			moves = append(moves, krkIndex(wk, wr, sq))
+		}
+	}
+	return moves, capture
+}
+
+var (
+	krkOnce     sync.Once
+	krkSolution *krk
+)
+
+func solveKRK() *krk {
+	krkOnce.Do(func() {
+		k := &krk{}
+		for s := 0; s < krkSize; s++ {
+			wk, wr, bk := krkSquares(s)
+			k.white[s], k.black[s] = unknown, unknown
+			if wk == wr || wk == bk || wr == bk || kingReach(wk)&bit(bk) != 0 {
+				k.white[s], k.black[s] = illegal, illegal
+				continue
+			}
+			check := rookReach(wr, bit(wk)|bit(bk))&bit(bk) != 0
+			if check {
+				k.white[s] = illegal
+			}
+			moves, capture := krkBlackMoves(s)
+			switch {
+			case capture:
+				k.black[s] = drawn
+			case len(moves) == 0 && check:
+				k.black[s] = 0
+			case len(moves) == 0:
+				k.black[s] = drawn
+			}
+		}
+		// Successors of every position, as ranges of a flat list.
+		var whiteMoves, blackMoves []int32
+		whiteEnd, blackEnd := make([]int32, krkSize), make([]int32, krkSize)
+		for s := 0; s < krkSize; s++ {
+			if k.white[s] == unknown {
+				for _, next := range krkWhiteMoves(s) {
+					whiteMoves = append(whiteMoves, int32(next))
+				}
+			}
+			if k.black[s] == unknown {
+				moves, _ := krkBlackMoves(s)
+				for _, next := range moves {
+					blackMoves = append(blackMoves, int32(next))
+				}
+			}
+			whiteEnd[s], blackEnd[s] = int32(len(whiteMoves)), int32(len(blackMoves))
+		}
+		for ply := 1; ; ply++ {
+			changed := false
+			for s := 0; s < krkSize; s++ {
+				if ply%2 == 1 && k.white[s] == unknown {
+					start := int32(0)
+					if s > 0 {
+						start = whiteEnd[s-1]
+					}
+					for _, next := range whiteMoves[start:whiteEnd[s]] {
+						if int(k.black[next]) == ply-1 {
+							k.white[s] = int8(ply)
+							changed = true
+							break
+						}
+					}
+				} else if ply%2 == 0 && k.black[s] == unknown {
+					start := int32(0)
+					if s > 0 {
+						start = blackEnd[s-1]
+					}
+					max := 0
+					for _, next := range blackMoves[start:blackEnd[s]] {
+						if k.white[next] < 0 {
+							max = -1
+							break
+						}
+						if int(k.white[next]) > max {
+							max = int(k.white[next])
+						}
+					}
+					if max == ply-1 {
+						k.black[s] = int8(ply)
+						changed = true
+					}
+				}
+			}
+			if !changed && ply%2 == 0 {
+				break
+			}
+		}
+		for s := range k.black {
+			if k.white[s] == unknown {
+				k.white[s] = drawn
+			}
+			if k.black[s] == unknown {
+				k.black[s] = drawn
+			}
+		}
+		krkSolution = k
+	})
+	return krkSolution
+}
+
+// The expected WDL and DTZ of a KRvK position.
+func (k *krk) result(s int, wtomove bool) (WDL, int) {
+	if wtomove {
+		return Win, int(k.white[s])
+	}
+	switch v := int(k.black[s]); v {
+	case drawn:
+		return Draw, 0
+	case 0:
+		return Loss, -1
+	default:
+		return Loss, -v
+	}
+}
+
+// A subtable's values compressed as the table generator does it: adjacent
+// pairs of symbols are repeatedly replaced by new symbols, and the symbols
+// are then Huffman coded, longest codes first, into blocks.
+type compressed struct {
+	pairs          [][2]int // each symbol's pair, or its value and 0xfff
+	minLen, maxLen int
+	lowest         []int    // the lowest symbol with each code length from minLen
+	blocks         [][]byte // the coded symbols, which don't span blocks
+	blockValues    []int    // the number of values in each block
+	sparse         [][2]int // the block and offset of the middle of each span
+}
+
+func compress(vals []int, blockBits, spanBits int) (*compressed, error) {
+	c := &compressed{}
+	leaves := map[int]int{}
+	seq := make([]int, len(vals))
+	for i, v := range vals {
+		sym, ok := leaves[v]
+		if !ok {
+			sym = len(c.pairs)
+			leaves[v] = sym
+			c.pairs = append(c.pairs, [2]int{v, 0xfff})
+		}
+		seq[i] = sym
+	}
+	// The number of values each symbol stands for.
+	values := make([]int, len(c.pairs))
+	for i := range values {
+		values[i] = 1
+	}
+
+	// Pair the most frequent adjacent symbols while that saves something,
+	// keeping symbols short enough that blocks can always be filled.
+	for len(c.pairs) < 0xfff {
+		counts := map[[2]int]int{}
+		best, bestCount := [2]int{}, 0
+		for i := 0; i+1 < len(seq); i++ {
+			pair := [2]int{seq[i], seq[i+1]}
+			if values[pair[0]]+values[pair[1]] > 256 {
+				continue
+			}
+			counts[pair]++
+			if n := counts[pair]; n > bestCount || n == bestCount && (pair[0] < best[0] || pair[0] == best[0] && pair[1] < best[1]) {
+				best, bestCount = pair, n
+			}
+		}
+		if bestCount < 16 {
+			break
+		}
+		sym := len(c.pairs)
+		c.pairs = append(c.pairs, best)
+		values = append(values, values[best[0]]+values[best[1]])
+		n := 0
+		for i := 0; i < len(seq); i++ {
+			if i+1 < len(seq) && seq[i] == best[0] && seq[i+1] == best[1] {
+				seq[n] = sym
+				i++
+			} else {
+				seq[n] = seq[i]
+			}
+			n++
+		}
+		seq = seq[:n]
+	}
+
+	// Huffman code lengths, for the symbols that appear in the sequence.
+	freq := make([]int, len(c.pairs))
+	for _, sym := range seq {
+		freq[sym]++
+	}
+	type node struct{ freq, left, right int } // leaves have left == -1, right the symbol
+	var nodes, roots []node
+	for sym, f := range freq {
+		if f > 0 {
+			roots = append(roots, node{f, -1, sym})
+		}
+	}
+	for len(roots) > 1 {
+		sort.SliceStable(roots, func(i, j int) bool { return roots[i].freq < roots[j].freq })
+		nodes = append(nodes, roots[0], roots[1])
+		roots = append(roots[2:], node{roots[0].freq + roots[1].freq, len(nodes) - 2, len(nodes) - 1})
+	}
+	codeLen := make([]int, len(c.pairs))
+	var walk func(n node, depth int)
+	walk = func(n node, depth int) {
+		if n.left == -1 {
+			codeLen[n.right] = depth
+			return
+		}
+		walk(nodes[n.left], depth+1)
+		walk(nodes[n.right], depth+1)
+	}
+	walk(roots[0], 0)
+	if roots[0].left == -1 {
+		codeLen[roots[0].right] = 1 // the only symbol
+	}
+
+	// Number the symbols with codes by decreasing code length, then the
+	// rest, and renumber the pairs to match.
+	order := make([]int, len(c.pairs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		li, lj := codeLen[order[i]], codeLen[order[j]]
+		return li > lj && lj != 0 || li != 0 && lj == 0
+	})
+	renumber := make([]int, len(order))
+	for sym, old := range order {
+		renumber[old] = sym
+	}
+	pairs := make([][2]int, len(c.pairs))
+	for old, pair := range c.pairs {
+		if pair[1] != 0xfff {
+			pair = [2]int{renumber[pair[0]], renumber[pair[1]]}
+		}
+		pairs[renumber[old]] = pair
+	}
+	c.pairs = pairs
+	lens := make([]int, len(order))
+	symValues := make([]int, len(order))
+	for old, sym := range renumber {
+		lens[sym], symValues[sym] = codeLen[old], values[old]
+	}
+	for i := range seq {
+		seq[i] = renumber[seq[i]]
+	}
+
+	// Canonical codes, as the reader computes them: the longest codes are
+	// numbered from zero, and each shorter length starts after them.
+	c.minLen, c.maxLen = 64, 0
+	count := make([]int, 65)
+	for _, l := range lens {
+		if l != 0 {
+			count[l]++
+			if l < c.minLen {
+				c.minLen = l
+			}
+			if l > c.maxLen {
+				c.maxLen = l
+			}
+		}
+	}
+	if c.maxLen > 32 {
+		return nil, fmt.Errorf("code length %d is too long", c.maxLen)
+	}
+	c.lowest = make([]int, c.maxLen-c.minLen+1)
+	base := make([]int, len(c.lowest))
+	for i := len(c.lowest) - 2; i >= 0; i-- {
+		l := c.minLen + i
+		c.lowest[i] = c.lowest[i+1] + count[l+1]
+		if (base[i+1]+count[l+1])&1 != 0 {
+			return nil, fmt.Errorf("code lengths are not canonical at %d", l)
+		}
+		base[i] = (base[i+1] + count[l+1]) / 2
+	}
+	code := make([]uint64, len(lens))
+	for sym, l := range lens {
+		if l != 0 {
+			i := l - c.minLen
+			code[sym] = uint64(base[i] + sym - c.lowest[i])
+		}
+	}
+
+	// Fill blocks with whole symbols.
+	blockSize := 1 << blockBits
+	var starts []int // the index of each block's first value
+	var block []byte
+	bit, start, inBlock := 0, 0, 0
+	flush := func() {
+		c.blocks = append(c.blocks, block)
+		c.blockValues = append(c.blockValues, inBlock)
+		starts = append(starts, start)
+		start += inBlock
+	}
+	for _, sym := range seq {
+		if block == nil || bit+lens[sym] > 8*blockSize || inBlock+symValues[sym] > 1<<15 {
+			if block != nil {
+				flush()
+			}
+			block, bit, inBlock = make([]byte, blockSize), 0, 0
+		}
+		for b := lens[sym] - 1; b >= 0; b-- {
+			if code[sym]>>b&1 != 0 {
+				block[bit/8] |= 0x80 >> (bit % 8)
+			}
+			bit++
+		}
+		inBlock += symValues[sym]
+	}
+	flush()
+
+	span := 1 << spanBits
+	for k, b := 0, 0; k*span < len(vals); k++ {
+		// Past the last value, point into the last block.
+		mid := k*span + span/2
+		for b+1 < len(starts) && starts[b+1] <= mid {
+			b++
+		}
+		c.sparse = append(c.sparse, [2]int{b, mid - starts[b]})
+	}
+	return c, nil
+}
+
+// Writes a pawnless table in the table file format, compressing each
+// subtable's values.
+func writeTable(t *table, values [][]int, flags uint8) ([]byte, error) {
+	const blockBits, spanBits = 6, 6
+	le16 := func(buf []byte, v int) []byte { return binary.LittleEndian.AppendUint16(buf, uint16(v)) }
+
+	buf := append([]byte{}, magics[t.kind][:]...)
+	buf = append(buf, 1, 0) // split; the leading group comes first
+	for k := 0; k < t.pieceCount; k++ {
+		buf = append(buf, t.items[0][0].pieces[k]|t.items[1][0].pieces[k]<<4)
+	}
+	if len(buf)&1 != 0 {
+		buf = append(buf, 0)
+	}
+	subtables := make([]*compressed, len(values))
+	for side, vals := range values {
+		c, err := compress(vals, blockBits, spanBits)
+		if err != nil {
+			return nil, err
+		}
+		subtables[side] = c
+		buf = append(buf, flags, blockBits, spanBits, 0)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(c.blocks)))
+		buf = append(buf, byte(c.maxLen), byte(c.minLen))
+		for _, sym := range c.lowest {
+			buf = le16(buf, sym)
+		}
+		buf = le16(buf, len(c.pairs))
+		for _, pair := range c.pairs {
+			buf = append(buf, byte(pair[0]), byte(pair[0]>>8)|byte(pair[1]<<4), byte(pair[1]>>4))
+		}
+		if len(c.pairs)&1 != 0 {
+			buf = append(buf, 0)
+		}
+	}
+	for _, c := range subtables {
+		for _, entry := range c.sparse {
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(entry[0]))
+			buf = le16(buf, entry[1])
+		}
+	}
+	for _, c := range subtables {
+		for _, n := range c.blockValues {
+			buf = le16(buf, n-1)
+		}
+	}
+	for _, c := range subtables {
+		for len(buf)%64 != 0 {
+			buf = append(buf, 0)
+		}
+		for _, block := range c.blocks {
+			buf = append(buf, block...)
+		}
+	}
+	return buf, nil
+}
+
+var (
+	krkFilesOnce sync.Once
+	krkFiles     map[string][]byte
+	krkFilesErr  error
+)
+
+// Writes KRvK tables for the solved positions to a directory: WDL for both
+// sides to move, and DTZ for White to move, in plies.
+func writeKRK(t *testing.T, dir string) {
+	krkFilesOnce.Do(func() {
+		krkFiles, krkFilesErr = encodeKRK(t)
+	})
+	if krkFilesErr != nil {
+		t.Fatal(krkFilesErr)
+	}
+	for name, data := range krkFiles {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func encodeKRK(t *testing.T) (map[string][]byte, error) {
+	k := solveKRK()
+	pieces := []uint8{6, 4, 14}
+	wdlTable := testTable(t, wdl, "KRvK", pieces...)
+	dtzTable := testTable(t, dtz, "KRvK", pieces...)
+	size := wdlTable.items[0][0].size()
+	wdlValues := [][]int{make([]int, size), make([]int, size)}
+	dtzValues := [][]int{make([]int, size)}
+	for i := range wdlValues[0] {
+		wdlValues[0][i], wdlValues[1][i] = -1, -1
+	}
+	for s := 0; s < krkSize; s++ {
+		wk, wr, bk := krkSquares(s)
+		for side, wtomove := range []bool{true, false} {
+			if (wtomove && k.white[s] == illegal) || (!wtomove && k.black[s] == illegal) {
+				continue
+			}
+			w, dtz := k.result(s, wtomove)
+			b := boardOf(wtomove, pieces, []int{wk, wr, bk})
+			_, _, idx, _ := wdlTable.encode(&b)
+			if prev := wdlValues[side][idx]; prev != -1 && prev != int(w)+2 {
+				return nil, fmt.Errorf("positions with different results share index %v", idx)
+			}
+			wdlValues[side][idx] = int(w) + 2
+			if wtomove {
+				dtzValues[0][idx] = dtz - 1
+			}
+		}
+	}
+	for side := range wdlValues {
+		for i, v := range wdlValues[side] {
+			if v == -1 {
+				wdlValues[side][i] = 2
+			}
+		}
+	}
+	wdlFile, err := writeTable(wdlTable, wdlValues, 0)
+	if err != nil {
+		return nil, err
+	}
+	dtzFile, err := writeTable(dtzTable, dtzValues, flagWinPlies)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{"KRvK.rtbw": wdlFile, "KRvK.rtbz": dtzFile}, nil
+}
+
+func openKRK(t *testing.T) *Tablebase {
+	dir := t.TempDir()
+	writeKRK(t, dir)
+	tb, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tb
+}
+
+func TestSolveKRK(t *testing.T) {
+	k := solveKRK()
+	max := 0
+	for _, v := range k.white {
+		if int(v) > max {
+			max = int(v)
+		}
+	}
+	// The longest KRvK mate is in 16 moves.
+	if max != 31 {
+		t.Error("Expected the longest win to take 31 plies, got", max)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	tb := openKRK(t)
+	if tb.MaxPieces() != 3 {
+		t.Error("Expected 3 pieces, got", tb.MaxPieces())
+	}
+	checkKRK(t, tb, true)
+}
+
+// The published KRvK tables, which aren't written by writeTable, so that the
+// reader is checked against the real format rather than our reading of it.
+// They are copied from the Syzygy 3-4-5 piece set into testdata.
+func TestPublishedTables(t *testing.T) {
+	for _, name := range []string{"KRvK.rtbw", "KRvK.rtbz"} {
+		if _, err := os.Stat(filepath.Join("testdata", name)); err != nil {
+			t.Skip("Published table not in testdata:", name)
+		}
+	}
+	tb, err := Open("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The published DTZ tables store wins in moves, so DTZ may be off by one.
+	checkKRK(t, tb, false)
+}
+
+// Checks a KRvK tablebase against the solved positions, for a sample of
+// positions and their colour-swapped twins, and a few positions whose
+// results are known. Unless exact, DTZ may be off by one, as ProbeDTZ allows.
+func checkKRK(t *testing.T, tb *Tablebase, exact bool) {
+	cases := []struct {
+		fen string
+		wdl WDL
+		dtz int
+	}{
+		{"8/8/8/8/8/2k5/1R6/K7 w - - 0 1", Win, 31}, // the longest win
+		{"8/8/8/8/8/8/1k6/R3K3 b - - 0 1", Draw, 0}, // Kxa1
+		{"k7/8/1K6/8/8/8/8/7R b - - 0 1", Loss, -2}, // Kb8 Rh8#
+	}
+	for _, c := range cases {
+		b := dragon.ParseFen(c.fen)
+		w, werr := tb.ProbeWDL(&b)
+		dtz, derr := tb.ProbeDTZ(&b)
+		if off := dtz - c.dtz; werr != nil || derr != nil || w != c.wdl || off != 0 && (exact || off > 1 || off < -1) {
+			t.Errorf("%v: got %v %v (%v, %v), expected %v %v", c.fen, w, dtz, werr, derr, c.wdl, c.dtz)
+		}
+	}
+
+	k := solveKRK()
+	for s := 0; s < krkSize; s += 61 {
+		wk, wr, bk := krkSquares(s)
+		for _, wtomove := range []bool{true, false} {
+			if (wtomove && k.white[s] == illegal) || (!wtomove && k.black[s] == illegal) {
+				continue
+			}
+			wantWDL, wantDTZ := k.result(s, wtomove)
+			// The same position, and with colours swapped.
+			boards := []dragon.Board{
+				boardOf(wtomove, []uint8{6, 4, 14}, []int{wk, wr, bk}),
+				boardOf(!wtomove, []uint8{14, 12, 6}, []int{wk ^ 56, wr ^ 56, bk ^ 56}),
+			}
+			for _, b := range boards {
+				fen := b.ToFen()
+				if w, err := tb.ProbeWDL(&b); err != nil || w != wantWDL {
+					t.Errorf("WDL of %v: got %v (%v), expected %v", fen, w, err, wantWDL)
+				}
+				dtz, err := tb.ProbeDTZ(&b)
+				if off := dtz - wantDTZ; err != nil || off != 0 && (exact || off > 1 || off < -1 || sign(dtz) != sign(wantDTZ)) {
+					t.Errorf("DTZ of %v: got %v (%v), expected %v", fen, dtz, err, wantDTZ)
+				}
+			}
+		}
+	}
+}
+
+func TestProbeErrors(t *testing.T) {
+	tb := openKRK(t)
+	fens := map[string]error{
+		"8/8/8/8/8/8/8/K6k w - - 0 1":                           nil,
+		"8/8/8/8/8/8/Q7/K6k w - - 0 1":                          ErrNoTable,
+		"8/8/8/8/8/8/8/R3K2k w Q - 0 1":                         ErrCastling,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w - - 0 1": ErrNoTable,
+	}
+	for fen, want := range fens {
+		b := dragon.ParseFen(fen)
+		if _, err := tb.ProbeWDL(&b); err != want {
+			t.Errorf("Probing %v: got %v, expected %v", fen, err, want)
+		}
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "KQvK.rtbw"), []byte("not a table"), 0o644)
+	bad, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := dragon.ParseFen("8/8/8/8/8/8/Q7/K6k w - - 0 1")
+	if _, err := bad.ProbeWDL(&b); err == nil {
+		t.Error("Expected an error probing a bad table")
+	}
+
+	// A bad DTZ table is an error, and not a fallback to probing without one.
+	dir = t.TempDir()
+	writeKRK(t, dir)
+	os.WriteFile(filepath.Join(dir, "KRvK.rtbz"), []byte("not a table"), 0o644)
+	if bad, err = Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	b = dragon.ParseFen("8/8/8/4k3/8/8/8/R3K3 w - - 0 1")
+	if _, err := bad.ProbeDTZ(&b); err == nil {
+		t.Error("Expected an error probing a bad DTZ table")
+	}
+}
+
+func TestRootMoves(t *testing.T) {
+	tb := openKRK(t)
+	k := solveKRK()
+	cases := []struct {
+		fen  string
+		want WDL
+	}{
+		{"8/8/8/4k3/8/8/8/R3K3 w - - 0 1", Win},
+		{"8/8/8/4k3/8/8/8/R3K3 w - - 80 1", CursedWin},
+		{"8/8/8/8/8/8/1k6/R3K3 b - - 0 1", Draw}, // Kxa1
+		{"8/8/8/8/8/2k5/8/R3K3 b - - 0 1", Loss},
+		{"8/8/8/8/8/2k5/8/R3K3 b - - 90 1", BlessedLoss},
+	}
+	for _, c := range cases {
+		b := dragon.ParseFen(c.fen)
+		moves, w, err := tb.RootMoves(&b)
+		if err != nil || w != c.want || len(moves) == 0 {
+			t.Errorf("%v: got %v %v (%v), expected %v", c.fen, moves, w, err, c.want)
+			continue
+		}
+		dtz, _ := tb.ProbeDTZ(&b)
+		for _, m := range moves {
+			unapply := b.Apply(m)
+			after, _ := tb.ProbeDTZ(&b)
+			// Winning moves take the shortest path, and losing moves the
+			// longest.
+			if c.want != Draw && -after-sign(after) != dtz {
+				t.Errorf("%v: %v leads to DTZ %v, from %v", c.fen, &m, after, dtz)
+			}
+			unapply()
+		}
+	}
+	// Every optimal winning move in a sample of positions mates fastest.
+	for s := 0; s < krkSize; s += 997 {
+		if k.white[s] <= 0 {
+			continue
+		}
+		wk, wr, bk := krkSquares(s)
+		b := boardOf(true, []uint8{6, 4, 14}, []int{wk, wr, bk})
+		moves, _, err := tb.RootMoves(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range moves {
+			unapply := b.Apply(m)
+			next := krkIndex(bits.TrailingZeros64(b.White.Kings), bits.TrailingZeros64(b.White.Rooks), bk)
+			if int(k.black[next]) != int(k.white[s])-1 {
+				t.Errorf("%v is not the fastest win in %v", &m, b.ToFen())
+			}
+			unapply()
+		}
+	}
+}
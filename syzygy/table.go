@@ -0,0 +1,525 @@
+package syzygy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/noahklein/dragon"
+)
+
+type tableKind int
+
+const (
+	wdl tableKind = iota
+	dtz
+)
+
+var (
+	magics     = [2][4]byte{{0x71, 0xe8, 0x23, 0x5d}, {0xd7, 0x66, 0x0c, 0xa5}}
+	extensions = [2]string{".rtbw", ".rtbz"}
+)
+
+// Subtable flags.
+const (
+	flagSTM         = 1 // DTZ: the side to move stored
+	flagMapped      = 2 // DTZ: values go through the table's map
+	flagWinPlies    = 4 // DTZ: wins are stored in plies rather than moves
+	flagLossPlies   = 8 // DTZ: losses are stored in plies rather than moves
+	flagWide        = 16
+	flagSingleValue = 128 // every position has the same value
+)
+
+// A material signature: the number of each kind of piece, 4 bits per kind,
+// with White's pieces in the low bits.
+type materialKey uint64
+
+func materialKeyOf(b *dragon.Board) materialKey {
+	var key materialKey
+	for color, bb := range [2]*dragon.Bitboards{&b.White, &b.Black} {
+		for piece, pieces := range [6]uint64{bb.Pawns, bb.Knights, bb.Bishops, bb.Rooks, bb.Queens, bb.Kings} {
+			key += materialKey(popcount(pieces)) << (4 * (6*color + piece))
+		}
+	}
+	return key
+}
+
+// The pieces of one side, as named in a table: eg: "KRP".
+func sideKey(pieces string, color int) (materialKey, error) {
+	var key materialKey
+	for _, c := range pieces {
+		piece := strings.IndexRune("PNBRQK", c)
+		if piece < 0 {
+			return 0, fmt.Errorf("syzygy: bad piece %q in table name", c)
+		}
+		key += 1 << (4 * (6*color + piece))
+	}
+	return key, nil
+}
+
+func (k materialKey) count(color, piece int) int {
+	return int(k >> (4 * (6*color + piece - 1)) & 15)
+}
+
+// A compressed subtable: the positions of one side to move, and for tables
+// with pawns, one file of the leading pawn.
+type pairsData struct {
+	flags    uint8
+	pieces   [7]uint8 // the order in which pieces are encoded
+	groupLen [8]int   // the sizes of the groups of pieces, zero-terminated
+	groupIdx [8]uint64
+
+	sizeofBlock     uint64
+	span            uint64 // positions between sparse index entries
+	sparseIndexSize uint64
+	blocksNum       uint64
+	blockLengthSize uint64
+	minSymLen       int // or, with flagSingleValue, the value
+	lowestSym       int
+	base64          []uint64
+	symlen          []int
+	btree           int
+	sparseIndex     int
+	blockLength     int
+	data            int
+	mapIdx          [4]int
+}
+
+// A WDL or DTZ table file, read into memory when first probed.
+type table struct {
+	kind            tableKind
+	path            string
+	key, key2       materialKey // with the stronger side as White, and as Black
+	pieceCount      int
+	hasPawns        bool
+	hasUniquePieces bool
+	pawnCount       [2]int // of the leading colour, and the other
+
+	once   sync.Once
+	err    error
+	buf    []byte
+	items  [2][4]pairsData // by side to move and file
+	dtzMap int
+}
+
+// Creates a table from its name, like "KRPvKR", and the path of its file.
+func newTable(kind tableKind, name, path string) (*table, error) {
+	sides := strings.Split(name, "v")
+	if len(sides) != 2 || !strings.HasPrefix(sides[0], "K") || !strings.HasPrefix(sides[1], "K") {
+		return nil, fmt.Errorf("syzygy: bad table name %q", name)
+	}
+	t := &table{kind: kind, path: path}
+	for color, pieces := range sides {
+		k1, err := sideKey(pieces, color)
+		if err != nil {
+			return nil, err
+		}
+		k2, _ := sideKey(pieces, 1-color)
+		t.key += k1
+		t.key2 += k2
+	}
+	for color := 0; color < 2; color++ {
+		for piece := int(dragon.Pawn); piece <= int(dragon.King); piece++ {
+			n := t.key.count(color, piece)
+			t.pieceCount += n
+			if piece != int(dragon.King) && n == 1 {
+				t.hasUniquePieces = true
+			}
+		}
+	}
+	// If both sides have pawns, the side with fewer pawns leads, for better
+	// compression.
+	white, black := t.key.count(0, int(dragon.Pawn)), t.key.count(1, int(dragon.Pawn))
+	t.hasPawns = white+black > 0
+	if black == 0 || (white > 0 && black >= white) {
+		t.pawnCount = [2]int{white, black}
+	} else {
+		t.pawnCount = [2]int{black, white}
+	}
+	return t, nil
+}
+
+// Returns the subtable for a side to move and file.
+func (t *table) get(stm, file int) *pairsData {
+	if t.kind == dtz {
+		stm = 0
+	}
+	if !t.hasPawns {
+		file = 0
+	}
+	return &t.items[stm][file]
+}
+
+// Reports whether a DTZ table stores positions with a given side to move.
+func (t *table) dtzStoresSide(stm, file int) bool {
+	return int(t.get(stm, file).flags&flagSTM) == stm || (t.key == t.key2 && !t.hasPawns)
+}
+
+// Reads the table file, once.
+func (t *table) load() error {
+	t.once.Do(func() {
+		data, err := os.ReadFile(t.path)
+		if err == nil {
+			err = t.parse(data)
+		}
+		t.err = err
+	})
+	return t.err
+}
+
+// Parses a table file. Offsets are aligned relative to the start of the file.
+func (t *table) parse(data []byte) (err error) {
+	if len(data) < 5 || string(data[:4]) != string(magics[t.kind][:]) {
+		return fmt.Errorf("syzygy: %v is not a %v file", t.path, extensions[t.kind])
+	}
+	defer func() {
+		// Parsing indexes into the file where its header says; a truncated or
+		// corrupt file shows up as an out of range index.
+		if recover() != nil {
+			err = fmt.Errorf("syzygy: %v is corrupt", t.path)
+		}
+	}()
+	const split, hasPawns = 1, 2
+	if (data[4]&hasPawns != 0) != t.hasPawns || (data[4]&split != 0) != (t.key != t.key2) {
+		return fmt.Errorf("syzygy: %v does not match its name", t.path)
+	}
+	p := 5
+
+	sides := 1
+	if t.kind == wdl && t.key != t.key2 {
+		sides = 2
+	}
+	maxFile := 0
+	if t.hasPawns {
+		maxFile = 3
+	}
+	pp := t.hasPawns && t.pawnCount[1] > 0 // pawns on both sides
+
+	for f := 0; f <= maxFile; f++ {
+		order := [2][2]int{{int(data[p] & 15), 15}, {int(data[p] >> 4), 15}}
+		if pp {
+			order[0][1], order[1][1] = int(data[p+1]&15), int(data[p+1]>>4)
+			p++
+		}
+		p++
+		for k := 0; k < t.pieceCount; k, p = k+1, p+1 {
+			t.items[0][f].pieces[k] = data[p] & 15
+			t.items[1][f].pieces[k] = data[p] >> 4
+		}
+		for i := 0; i < sides; i++ {
+			t.setGroups(&t.items[i][f], order[i], f)
+		}
+	}
+	p += p & 1
+
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			p = t.items[i][f].setSizes(data, p)
+		}
+	}
+	if t.kind == dtz {
+		p = t.setDTZMap(data, p, maxFile)
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			d := &t.items[i][f]
+			d.sparseIndex = p
+			p += int(d.sparseIndexSize) * 6
+		}
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			d := &t.items[i][f]
+			d.blockLength = p
+			p += int(d.blockLengthSize) * 2
+		}
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			d := &t.items[i][f]
+			p = (p + 63) &^ 63
+			d.data = p
+			p += int(d.blocksNum * d.sizeofBlock)
+		}
+	}
+	if p > len(data) {
+		return fmt.Errorf("syzygy: %v is truncated", t.path)
+	}
+	t.buf = data
+	return nil
+}
+
+// Sets up the groups a subtable's pieces are encoded in. The leading group
+// holds the leading pawns, or the three unique pieces or the kings; each
+// other group holds identical pieces. order gives the position of the
+// leading group and the remaining pawns in the encoding.
+func (t *table) setGroups(d *pairsData, order [2]int, file int) {
+	firstLen := 2
+	if t.hasPawns {
+		firstLen = 0
+	} else if t.hasUniquePieces {
+		firstLen = 3
+	}
+	n := 0
+	d.groupLen[0] = 1
+	for i := 1; i < t.pieceCount; i++ {
+		firstLen--
+		if firstLen > 0 || d.pieces[i] == d.pieces[i-1] {
+			d.groupLen[n]++
+		} else {
+			n++
+			d.groupLen[n] = 1
+		}
+	}
+	n++
+	d.groupLen[n] = 0
+
+	// The encoding is g1*N(g2)*N(g3)... + g2*N(g3)... + g3..., where N(g) is
+	// the number of placements of group g, with groups in the table's order.
+	pp := t.hasPawns && t.pawnCount[1] > 0
+	next := 1
+	if pp {
+		next = 2
+	}
+	freeSquares := 64 - d.groupLen[0]
+	if pp {
+		freeSquares -= d.groupLen[1]
+	}
+	idx := uint64(1)
+	for k := 0; next < n || k == order[0] || k == order[1]; k++ {
+		switch k {
+		case order[0]: // leading pawns or pieces
+			d.groupIdx[0] = idx
+			switch {
+			case t.hasPawns:
+				idx *= leadPawnsSize[d.groupLen[0]][file]
+			case t.hasUniquePieces:
+				idx *= 31332
+			default:
+				idx *= 462
+			}
+		case order[1]: // remaining pawns
+			d.groupIdx[1] = idx
+			idx *= binomial[d.groupLen[1]][48-d.groupLen[0]]
+		default: // remaining pieces
+			d.groupIdx[next] = idx
+			idx *= binomial[d.groupLen[next]][freeSquares]
+			freeSquares -= d.groupLen[next]
+			next++
+		}
+	}
+	d.groupIdx[n] = idx
+}
+
+// The number of positions in a subtable.
+func (d *pairsData) size() uint64 {
+	n := 0
+	for d.groupLen[n] != 0 {
+		n++
+	}
+	return d.groupIdx[n]
+}
+
+// Reads a subtable's compression parameters, starting at data[p], and
+// returns the offset after them.
+//
+// Values are compressed by recursive pairing: symbols stand for a value or a
+// pair of symbols, and the sequence of symbols is Huffman coded with a
+// canonical code.
+func (d *pairsData) setSizes(data []byte, p int) int {
+	d.flags = data[p]
+	p++
+	if d.flags&flagSingleValue != 0 {
+		d.minSymLen = int(data[p])
+		return p + 1
+	}
+	tbSize := d.size()
+	d.sizeofBlock = 1 << data[p]
+	d.span = 1 << data[p+1]
+	d.sparseIndexSize = (tbSize + d.span - 1) / d.span
+	padding := uint64(data[p+2])
+	d.blocksNum = uint64(binary.LittleEndian.Uint32(data[p+3:]))
+	d.blockLengthSize = d.blocksNum + padding
+	maxSymLen := int(data[p+7])
+	d.minSymLen = int(data[p+8])
+	p += 9
+	d.lowestSym = p
+
+	// Longer codes have lower values, so base64[i] is the lowest code of
+	// length minSymLen+i, padded to 64 bits; codes of that length are at
+	// least base64[i] and less than base64[i-1].
+	d.base64 = make([]uint64, maxSymLen-d.minSymLen+1)
+	for i := len(d.base64) - 2; i >= 0; i-- {
+		d.base64[i] = (d.base64[i+1] + uint64(d.lowest(data, i)) - uint64(d.lowest(data, i+1))) / 2
+	}
+	for i := range d.base64 {
+		d.base64[i] <<= 64 - i - d.minSymLen
+	}
+	p += len(d.base64) * 2
+
+	d.symlen = make([]int, binary.LittleEndian.Uint16(data[p:]))
+	p += 2
+	d.btree = p
+	visited := make([]bool, len(d.symlen))
+	for sym := range d.symlen {
+		if !visited[sym] {
+			d.symlen[sym] = d.setSymlen(data, sym, visited)
+		}
+	}
+	return p + len(d.symlen)*3 + len(d.symlen)&1
+}
+
+// The lowest symbol with a code of length minSymLen+i.
+func (d *pairsData) lowest(data []byte, i int) uint16 {
+	return binary.LittleEndian.Uint16(data[d.lowestSym+2*i:])
+}
+
+// Returns the pair of symbols a symbol stands for. A symbol with a right
+// half of 0xfff stands for the value in its left half.
+func (d *pairsData) pair(data []byte, sym int) (left, right int) {
+	lr := data[d.btree+3*sym:]
+	return int(lr[1]&15)<<8 | int(lr[0]), int(lr[2])<<4 | int(lr[1]>>4)
+}
+
+// Computes the number of values a symbol stands for, minus one.
+func (d *pairsData) setSymlen(data []byte, sym int, visited []bool) int {
+	visited[sym] = true
+	left, right := d.pair(data, sym)
+	if right == 0xfff {
+		return 0
+	}
+	if !visited[left] {
+		d.symlen[left] = d.setSymlen(data, left, visited)
+	}
+	if !visited[right] {
+		d.symlen[right] = d.setSymlen(data, right, visited)
+	}
+	return d.symlen[left] + d.symlen[right] + 1
+}
+
+// Reads the maps that DTZ subtables translate their values through.
+func (t *table) setDTZMap(data []byte, p, maxFile int) int {
+	t.dtzMap = p
+	for f := 0; f <= maxFile; f++ {
+		d := &t.items[0][f]
+		if d.flags&flagMapped == 0 {
+			continue
+		}
+		if d.flags&flagWide != 0 {
+			p += p & 1
+			for i := range d.mapIdx {
+				d.mapIdx[i] = (p-t.dtzMap)/2 + 1
+				p += 2*int(binary.LittleEndian.Uint16(data[p:])) + 2
+			}
+		} else {
+			for i := range d.mapIdx {
+				d.mapIdx[i] = p - t.dtzMap + 1
+				p += int(data[p]) + 1
+			}
+		}
+	}
+	return p + p&1
+}
+
+// Returns the value stored at an index of a subtable.
+func (d *pairsData) decompress(data []byte, idx uint64) int {
+	if d.flags&flagSingleValue != 0 {
+		return d.minSymLen
+	}
+
+	// Block n holds blockLength[n]+1 values. Sparse index entry k gives the
+	// block and offset of value k*span + span/2; find the block from there.
+	k := idx / d.span
+	entry := data[d.sparseIndex+6*int(k):]
+	block := int(binary.LittleEndian.Uint32(entry))
+	offset := int(binary.LittleEndian.Uint16(entry[4:]))
+	offset += int(idx%d.span) - int(d.span/2)
+	blockLength := func(i int) int {
+		return int(binary.LittleEndian.Uint16(data[d.blockLength+2*i:]))
+	}
+	for offset < 0 {
+		block--
+		offset += blockLength(block) + 1
+	}
+	for offset > blockLength(block) {
+		offset -= blockLength(block) + 1
+		block++
+	}
+
+	// Decode symbols until reaching the one that holds the value.
+	ptr := d.data + block*int(d.sizeofBlock)
+	buf := be64(data, ptr)
+	ptr += 8
+	bufSize := 64
+	var sym int
+	for {
+		n := 0
+		for buf < d.base64[n] {
+			n++
+		}
+		sym = int((buf-d.base64[n])>>(64-n-d.minSymLen)) + int(d.lowest(data, n))
+		if offset < d.symlen[sym]+1 {
+			break
+		}
+		offset -= d.symlen[sym] + 1
+		n += d.minSymLen
+		buf <<= n
+		bufSize -= n
+		if bufSize <= 32 {
+			bufSize += 32
+			buf |= uint64(be32(data, ptr)) << (64 - bufSize)
+			ptr += 4
+		}
+	}
+
+	// Expand the symbol's pairs down to the value.
+	for d.symlen[sym] != 0 {
+		left, right := d.pair(data, sym)
+		if offset < d.symlen[left]+1 {
+			sym = left
+		} else {
+			offset -= d.symlen[left] + 1
+			sym = right
+		}
+	}
+	value, _ := d.pair(data, sym)
+	return value
+}
+
+// Big-endian reads that treat bytes past the end of the data as zero, since
+// the last block may end before a full read.
+func be64(data []byte, p int) uint64 {
+	return uint64(be32(data, p))<<32 | uint64(be32(data, p+4))
+}
+
+func be32(data []byte, p int) uint32 {
+	var v uint32
+	for i := 0; i < 4; i++ {
+		v <<= 8
+		if p+i < len(data) {
+			v |= uint32(data[p+i])
+		}
+	}
+	return v
+}
+
+// Converts a DTZ table value into plies, given the position's WDL.
+func (t *table) mapScore(d *pairsData, value int, w WDL) int {
+	wdlMap := [5]int{1, 3, 0, 2, 0}
+	if d.flags&flagMapped != 0 {
+		i := d.mapIdx[wdlMap[w+2]] + value
+		if d.flags&flagWide != 0 {
+			value = int(binary.LittleEndian.Uint16(t.buf[t.dtzMap+2*i:]))
+		} else {
+			value = int(t.buf[t.dtzMap+i])
+		}
+	}
+	if (w == Win && d.flags&flagWinPlies == 0) ||
+		(w == Loss && d.flags&flagLossPlies == 0) ||
+		w == CursedWin || w == BlessedLoss {
+		value *= 2
+	}
+	return value + 1
+}
@@ -14,26 +14,83 @@ package dragon
 // H8 G8 F8 E8 D8 C8 B8 A8 H7 ... A2 H1 G1 F1 E1 D1 C1 B1 A1
 
 // The board type, which uses little-endian rank-file mapping.
+//
+// The board also keeps the piece on each square, and its hash, in step with
+// the White and Black bitboards. PutPiece, RemovePiece, FEN parsing and
+// making moves keep them so; after writing the bitboards directly, call Sync
+// before using the board.
 type Board struct {
 	Wtomove       bool
 	enpassant     uint8 // square id (16-23 or 40-47) where en passant capture is possible
 	castlerights  uint8
+	rookFiles     [4]uint8 // files of the castling rooks, indexed like the castlerights bits
 	Halfmoveclock uint8
 	Fullmoveno    uint16
 	White         Bitboards
 	Black         Bitboards
 	hash          uint64
+	// The piece on each square, with blackPiece set for black's, or 0 if the
+	// square is empty; kept in step with the bitboards for O(1) lookups.
+	squares [64]uint8
+	// Chess960 makes castling moves encode as the king capturing its own rook
+	// (eg: e1h1), as UCI_Chess960 requires; otherwise they encode as the king's
+	// two-square move (eg: e1g1), where that is unambiguous. ParseFen sets it for
+	// positions with castling rights that standard chess can't have, and for
+	// Shredder-FEN castling fields.
+	Chess960 bool
 }
 
+// The version of the Zobrist keys used by Board.Hash. Hash values are stable
+// across processes, platforms and releases of this package as long as
+// HashVersion is unchanged, so they may be persisted; any change to the keys
+// will increment it.
+const HashVersion = 1
+
 // Return the Zobrist hash value for the board.
 // The hash value does NOT change with the turn number, nor the draw move counter.
+// The en passant square only affects the hash when a pawn of the side to move
+// stands ready to make the capture, so that positions which differ only by an
+// unusable en passant square hash equally (as in Polyglot).
 // All other elements of the Board type affect the hash.
 // This function is cheap to call, since the hash is incrementally updated.
 func (b *Board) Hash() uint64 {
-	//b.hash = recomputeBoardHash(b)
 	return b.hash
 }
 
+// The en passant component of the hash: the key for the file of the e.p.
+// square, if a pawn of the side to move is adjacent to the pawn that just
+// double-pushed, or zero otherwise.
+func (b *Board) enpassantZobrist() uint64 {
+	if b.enpassant == 0 {
+		return 0
+	}
+	ep := uint64(1) << b.enpassant
+	var capturers uint64
+	if b.Wtomove {
+		capturers = ((ep>>9)&^FileMasks[7] | (ep>>7)&^FileMasks[0]) & b.White.Pawns
+	} else {
+		capturers = ((ep<<7)&^FileMasks[7] | (ep<<9)&^FileMasks[0]) & b.Black.Pawns
+	}
+	if capturers == 0 {
+		return 0
+	}
+	return enpassantZobristC[b.enpassant%8]
+}
+
+// The en passant target square, eg: e3 after 1. e4, or 0 if there is none.
+// As in FEN, the square is set after any double pawn push, whether or not an
+// en passant capture is possible.
+func (b *Board) EnPassant() Square {
+	return Square(b.enpassant)
+}
+
+// Reports which castling rights remain. A right only means that the king and
+// rook have not moved, not that castling is currently legal.
+func (b *Board) CastlingRights() (whiteKingside, whiteQueenside, blackKingside, blackQueenside bool) {
+	return b.whiteCanCastleKingside(), b.whiteCanCastleQueenside(),
+		b.blackCanCastleKingside(), b.blackCanCastleQueenside()
+}
+
 // Castle rights helpers. Data stored inside, from LSB:
 // 1 bit: White castle queenside
 // 1 bit: White castle kingside
@@ -41,6 +98,73 @@ func (b *Board) Hash() uint64 {
 // 1 bit: Black castle kingside
 // This just indicates whether castling rights have been lost, not whether
 // castling is actually possible.
+// In Chess960, the rooks may start on any file: the "kingside" rook is the one
+// on the h-file side of the king, and rookFiles records which file it is on.
+// Castling always ends with the king on the c- or g-file and the rook beside it
+// on the d- or f-file, as in standard chess.
+
+// Castling rights indices, as bit positions in castlerights.
+const (
+	whiteQueenside = iota
+	whiteKingside
+	blackQueenside
+	blackKingside
+)
+
+// Returns the castling right that a move uses, if it is a castling move.
+// Castling is recognised either as the king capturing its own castling rook, or
+// (as in standard chess) as a two-square king move to the c- or g-file.
+func (b *Board) castlingRight(m Move) (int, bool) {
+	kings := b.White.Kings
+	if !b.Wtomove {
+		kings = b.Black.Kings
+	}
+	if kings&(uint64(1)<<m.From()) == 0 {
+		return 0, false
+	}
+	return b.castlingRightOf(m)
+}
+
+// Like castlingRight, but supposes that the king is on the move's from square,
+// as it was before the move was made.
+func (b *Board) castlingRightOf(m Move) (int, bool) {
+	rank, right := uint8(0), whiteQueenside
+	if !b.Wtomove {
+		rank, right = 56, blackQueenside
+	}
+	if m.From()&^7 != rank || m.To()&^7 != rank {
+		return 0, false
+	}
+	for _, r := range [2]int{right, right + 1} {
+		if b.castlerights&(1<<r) == 0 {
+			continue
+		}
+		if m.To() == rank+b.rookFiles[r] {
+			return r, true
+		}
+		kingTo, _ := castlingTargets(r)
+		if rank+kingTo == m.To() && (m.To() == m.From()+2 || m.From() == m.To()+2) {
+			return r, true
+		}
+	}
+	return 0, false
+}
+
+// The files that the king and rook move to when castling with a right.
+func castlingTargets(right int) (kingFile, rookFile uint8) {
+	if right == whiteKingside || right == blackKingside {
+		return 6, 5
+	}
+	return 2, 3
+}
+
+// The mask of squares on a rank from one square to another, inclusive.
+func rankSpan(from, to uint8) uint64 {
+	if from > to {
+		from, to = to, from
+	}
+	return (uint64(1)<<(to-from+1) - 1) << from
+}
 
 // Castling helper functions for all 16 possible scenarios
 func (b *Board) whiteCanCastleQueenside() bool {
@@ -191,6 +315,108 @@ func (m *Move) String() string {
 	return result
 }
 
+// A move together with what kind of move it is in the position it was made
+// from: the piece that moves, the piece it captures, and whether it castles,
+// captures en passant or is a pawn's double push. Moves stay small, and equal
+// when they have the same squares and promotion, so that they can be compared
+// with parsed moves and stored in tables; a MoveInfo is made for a position
+// by Board.MoveInfo or GenerateLegalMoveInfos.
+//
+// Data stored inside, from LSB
+// 16 bits: the move
+// 3 bits: moving piece
+// 3 bits: captured piece (Pawn for en passant)
+// 3 bits: flags
+type MoveInfo uint32
+
+const (
+	moveInfoCastle MoveInfo = 1 << (22 + iota)
+	moveInfoEnPassant
+	moveInfoDoublePush
+)
+
+// The move, without its information.
+func (mi MoveInfo) Move() Move {
+	return Move(mi & 0xFFFF)
+}
+
+// The piece that moves; King when castling.
+func (mi MoveInfo) Piece() Piece {
+	return Piece((mi >> 16) & 7)
+}
+
+// The piece captured, or Nothing. An en passant capture captures a Pawn.
+func (mi MoveInfo) Captured() Piece {
+	return Piece((mi >> 19) & 7)
+}
+
+func (mi MoveInfo) IsCapture() bool {
+	return mi.Captured() != Nothing
+}
+
+func (mi MoveInfo) IsCastle() bool {
+	return mi&moveInfoCastle != 0
+}
+
+func (mi MoveInfo) IsEnPassant() bool {
+	return mi&moveInfoEnPassant != 0
+}
+
+func (mi MoveInfo) IsDoublePush() bool {
+	return mi&moveInfoDoublePush != 0
+}
+
+func (mi MoveInfo) IsPromotion() bool {
+	m := mi.Move()
+	return m.Promote() != Nothing
+}
+
+// The move in pure coordinate notation, as Move.String writes it, so that
+// ParseMove reads it back.
+func (mi MoveInfo) String() string {
+	m := mi.Move()
+	return m.String()
+}
+
+// Describes a legal move in this position.
+func (b *Board) MoveInfo(m Move) MoveInfo {
+	piece := Piece(b.squares[m.From()] & 7)
+	info := MoveInfo(m) | MoveInfo(piece)<<16
+	switch {
+	case piece == King:
+		if _, ok := b.castlingRight(m); ok {
+			return info | moveInfoCastle // in Chess960, the rook "captured" is our own
+		}
+	case piece == Pawn && m.To() == b.enpassant && b.enpassant != 0:
+		return info | MoveInfo(Pawn)<<19 | moveInfoEnPassant
+	case piece == Pawn && (m.To() == m.From()+16 || m.From() == m.To()+16):
+		return info | moveInfoDoublePush
+	}
+	captured := Piece(b.squares[m.To()] & 7) // legal moves only land on our own pieces when castling
+	return info | MoveInfo(captured)<<19
+}
+
+// The most moves that can be legal in any position (218 are known to be
+// possible), with room to spare.
+const MaxMoves = 256
+
+// A fixed-capacity list of moves, which callers can keep on the stack or reuse
+// to generate moves without allocating.
+type MoveList struct {
+	Moves [MaxMoves]Move
+	Count int
+}
+
+// The moves in the list. The slice shares the list's storage.
+func (l *MoveList) Slice() []Move {
+	return l.Moves[:l.Count]
+}
+
+func (l *MoveList) push(m Move) {
+	l.Moves[l.Count] = m
+	l.Count++
+}
+
 // Square index values from 0-63.
 type Square uint8
 
@@ -206,3 +432,83 @@ const (
 	Queen
 	King
 )
+
+// A side.
+type Color uint8
+
+const (
+	White Color = iota
+	Black
+)
+
+func (c Color) String() string {
+	if c == Black {
+		return "black"
+	}
+	return "white"
+}
+
+// Set in Board.squares for black's pieces.
+const blackPiece = 8
+
+// The piece on a square, and its color; false if the square is empty.
+func (b *Board) PieceAt(sq Square) (Piece, Color, bool) {
+	p := b.squares[sq]
+	return Piece(p & 7), Color(p / blackPiece), p != 0
+}
+
+// Rebuilds what the board derives from its bitboards, after they have been
+// written directly: each side's All bitboard, the piece on each square, and
+// the hash.
+func (b *Board) Sync() {
+	for _, side := range [2]*Bitboards{&b.White, &b.Black} {
+		side.All = side.Pawns | side.Knights | side.Bishops | side.Rooks | side.Queens | side.Kings
+	}
+	for sq := range b.squares {
+		b.squares[sq] = 0
+		if p, _ := determinePieceType(&b.White, uint64(1)<<sq); p != Nothing {
+			b.squares[sq] = uint8(p)
+		} else if p, _ := determinePieceType(&b.Black, uint64(1)<<sq); p != Nothing {
+			b.squares[sq] = uint8(p) | blackPiece
+		}
+	}
+	b.hash = recomputeBoardHash(b)
+}
+
+// Puts a piece on a square, replacing any piece there, for setting up
+// positions; putting Nothing empties it. The hash is updated, but castling
+// rights and the en passant square are left as they are.
+func (b *Board) PutPiece(sq Square, p Piece, c Color) {
+	b.RemovePiece(sq)
+	if p == Nothing {
+		return
+	}
+	b.hash ^= b.enpassantZobrist()
+	bitboards, zobristIndex := &(b.White), int(p)-1
+	if c == Black {
+		bitboards, zobristIndex = &(b.Black), int(p)+5
+	}
+	*pieceBitboard(bitboards, p) |= uint64(1) << sq
+	bitboards.All |= uint64(1) << sq
+	b.squares[sq] = uint8(p) | uint8(c)*blackPiece
+	b.hash ^= pieceSquareZobristC[zobristIndex][sq]
+	b.hash ^= b.enpassantZobrist()
+}
+
+// Empties a square, as PutPiece fills one.
+func (b *Board) RemovePiece(sq Square) {
+	p, c, ok := b.PieceAt(sq)
+	if !ok {
+		return
+	}
+	b.hash ^= b.enpassantZobrist()
+	bitboards, zobristIndex := &(b.White), int(p)-1
+	if c == Black {
+		bitboards, zobristIndex = &(b.Black), int(p)+5
+	}
+	*pieceBitboard(bitboards, p) &^= uint64(1) << sq
+	bitboards.All &^= uint64(1) << sq
+	b.squares[sq] = 0
+	b.hash ^= pieceSquareZobristC[zobristIndex][sq]
+	b.hash ^= b.enpassantZobrist()
+}
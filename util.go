@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math/bits"
 	"strconv"
 	"strings"
 )
@@ -25,7 +26,7 @@ func recomputeBoardHash(b *Board) uint64 {
 	if b.blackCanCastleQueenside() {
 		hash ^= castleRightsZobristC[3]
 	}
-	hash ^= uint64(b.enpassant)
+	hash ^= b.enpassantZobrist()
 	for i := uint8(0); i < 64; i++ {
 		whitePiece, _ := determinePieceType(&(b.White), uint64(1)<<i)
 		blackPiece, _ := determinePieceType(&(b.Black), uint64(1)<<i)
@@ -41,7 +42,12 @@ func recomputeBoardHash(b *Board) uint64 {
 
 func IsCapture(m Move, b *Board) bool {
 	toBitboard := (uint64(1) << m.To())
-	if (toBitboard&b.White.All != 0) || (toBitboard&b.Black.All != 0) {
+	// Only the opponent's pieces: in Chess960, castling captures our own rook.
+	opponentPieces := b.Black.All
+	if !b.Wtomove {
+		opponentPieces = b.White.All
+	}
+	if toBitboard&opponentPieces != 0 {
 		return true
 	}
 	// Is it an en passant capture?
@@ -50,38 +56,10 @@ func IsCapture(m Move, b *Board) bool {
 	return originIsPawn && (toBitboard&(uint64(1)<<b.enpassant) != 0)
 }
 
+// The piece on a square, and whether it is white; Nothing if the square is empty.
 func GetPieceType(square uint8, b *Board) (int, bool) {
-	squareMask := uint64(1) << square
-	if b.White.All&squareMask != 0 {
-		if b.White.Pawns&squareMask != 0 {
-			return Pawn, true
-		} else if b.White.Knights&squareMask != 0 {
-			return Knight, true
-		} else if b.White.Bishops&squareMask != 0 {
-			return Bishop, true
-		} else if b.White.Rooks&squareMask != 0 {
-			return Rook, true
-		} else if b.White.Queens&squareMask != 0 {
-			return Queen, true
-		} else if b.White.Kings&squareMask != 0 {
-			return King, true
-		}
-	} else {
-		if b.Black.Pawns&squareMask != 0 {
-			return Pawn, false
-		} else if b.Black.Knights&squareMask != 0 {
-			return Knight, false
-		} else if b.Black.Bishops&squareMask != 0 {
-			return Bishop, false
-		} else if b.Black.Rooks&squareMask != 0 {
-			return Rook, false
-		} else if b.Black.Queens&squareMask != 0 {
-			return Queen, false
-		} else if b.Black.Kings&squareMask != 0 {
-			return King, false
-		}
-	}
-	return Nothing, false
+	piece, color, _ := b.PieceAt(Square(square))
+	return int(piece), piece != Nothing && color == White
 }
 
 // A testing-use function that ignores the error output
@@ -136,6 +114,11 @@ func pieceFromRune(r rune) pieceColor {
 	return pieceColor{Nothing, false}
 }
 
+var fenPieceLetters = [2][7]string{
+	{"", "P", "N", "B", "R", "Q", "K"},
+	{"", "p", "n", "b", "r", "q", "k"},
+}
+
 var pieceStrings = [2][7]string{
 	{".", "♙", "♘", "♗", "♖", "♕", "♔"},
 	{".", "♟", "♞", "♝", "♜", "♛", "♚"},
@@ -149,17 +132,12 @@ func (b *Board) String() string {
 		s.WriteString(fmt.Sprintf(" %v  ", rank+1))
 		for file := 0; file <= 7; file++ {
 			sq := uint8(8*rank + file)
-			piece, isWhite := GetPieceType(sq, b)
-			if piece < Pawn {
+			piece, color, ok := b.PieceAt(Square(sq))
+			if !ok {
 				s.WriteString(" . ")
 				continue
 			}
 
-			color := 0
-			if !isWhite {
-				color = 1
-			}
-
 			char := pieceStrings[color][piece]
 			s.WriteString(" " + char + " ")
 		}
@@ -173,7 +151,7 @@ func (b *Board) String() string {
 
 // Some example valid move strings:
 // e1e2 b4d6 e7e8q a2a1n
-// TODO(noahklein): Make the parser more forgiving. Eg: 0-0, O-O-O, a2-a3, D3D4
+// For castling notation and other human-friendly input, see Board.ParseSAN.
 func ParseMove(movestr string) (Move, error) {
 	if movestr == "0000" {
 		return 0, nil
@@ -258,7 +236,20 @@ func IndexToAlgebraic(id Square) string {
 }
 
 // Serializes a board position to a Fen string.
+// Castling rights are written as in X-FEN: KQkq, unless the castling rook is
+// not the outermost rook on its side of the king, when its file letter is used.
+// For standard chess positions, this is plain FEN.
 func (b *Board) ToFen() string {
+	return b.toFen(false)
+}
+
+// Serializes a board position to a Shredder-FEN string, which is FEN with the
+// castling rights written as the files of the castling rooks (eg: HAha).
+func (b *Board) ToShredderFen() string {
+	return b.toFen(true)
+}
+
+func (b *Board) toFen(shredder bool) string {
 	b.White.sanityCheck()
 	b.Black.sanityCheck()
 	var position string
@@ -266,33 +257,10 @@ func (b *Board) ToFen() string {
 	for i := 63; i >= 0; i-- {
 		// Loop file A to H, within ranks 8 to 1
 		currIdx := (i/8)*8 + (7 - (i % 8))
-		currMask := uint64(1) << currIdx
 
 		toprint := ""
-		if b.White.Pawns&currMask != 0 {
-			toprint += "P"
-		} else if b.White.Knights&currMask != 0 {
-			toprint += "N"
-		} else if b.White.Bishops&currMask != 0 {
-			toprint += "B"
-		} else if b.White.Rooks&currMask != 0 {
-			toprint += "R"
-		} else if b.White.Queens&currMask != 0 {
-			toprint += "Q"
-		} else if b.White.Kings&currMask != 0 {
-			toprint += "K"
-		} else if b.Black.Pawns&currMask != 0 {
-			toprint += "p"
-		} else if b.Black.Knights&currMask != 0 {
-			toprint += "n"
-		} else if b.Black.Bishops&currMask != 0 {
-			toprint += "b"
-		} else if b.Black.Rooks&currMask != 0 {
-			toprint += "r"
-		} else if b.Black.Queens&currMask != 0 {
-			toprint += "q"
-		} else if b.Black.Kings&currMask != 0 {
-			toprint += "k"
+		if piece, color, ok := b.PieceAt(Square(currIdx)); ok {
+			toprint = fenPieceLetters[color][piece]
 		} else {
 			empty++
 		}
@@ -321,20 +289,11 @@ func (b *Board) ToFen() string {
 	}
 	position += " "
 	castleCount := 0
-	if b.whiteCanCastleKingside() {
-		position += "K"
-		castleCount++
-	}
-	if b.whiteCanCastleQueenside() {
-		position += "Q"
-		castleCount++
-	}
-	if b.blackCanCastleKingside() {
-		position += "k"
-		castleCount++
-	}
-	if b.blackCanCastleQueenside() {
-		position += "q"
+	for _, right := range [4]int{whiteKingside, whiteQueenside, blackKingside, blackQueenside} {
+		if b.castlerights&(1<<right) == 0 {
+			continue
+		}
+		position += b.castlingLetter(right, shredder)
 		castleCount++
 	}
 	if castleCount == 0 {
@@ -351,91 +310,288 @@ func (b *Board) ToFen() string {
 }
 
 // Parse a board from a FEN string.
+// This is a lenient wrapper around ParseFenStrict: malformed FEN strings produce a
+// blank Board, and positions that parse but fail validation are returned as-is.
 func ParseFen(fen string) Board {
-	// BUG(noahklein): This FEN parsing implementation doesn't handle malformed inputs.
-	tokens := strings.Fields(fen)
-	var b Board
-	// replace digits with the appropriate number of dashes
-	for i := 1; i <= 8; i++ {
-		var replacement string
-		for j := 0; j < i; j++ {
-			replacement += "-"
-		}
-		tokens[0] = strings.Replace(tokens[0], strconv.Itoa(i), replacement, -1)
+	b, _ := ParseFenStrict(fen)
+	return b
+}
+
+// Errors reported by ParseFenStrict. The returned error is always a *FenError
+// wrapping one of these, so callers can test for them with errors.Is.
+var (
+	ErrFenFieldCount      = errors.New("wrong number of fields")
+	ErrFenRankCount       = errors.New("wrong number of ranks")
+	ErrFenBadPiece        = errors.New("invalid piece letter")
+	ErrFenRankOverflow    = errors.New("rank does not contain exactly 8 squares")
+	ErrFenSideToMove      = errors.New("invalid side to move")
+	ErrFenCastling        = errors.New("invalid castling field")
+	ErrFenEnPassant       = errors.New("invalid en passant field")
+	ErrFenClock           = errors.New("invalid move counter")
+	ErrFenKingCount       = errors.New("each side must have exactly one king")
+	ErrFenPawnOnBackRank  = errors.New("pawn on the first or eighth rank")
+	ErrFenCastlingRights  = errors.New("castling rights without king and rook on their home squares")
+	ErrFenEnPassantSquare = errors.New("en passant square inconsistent with the position")
+	ErrFenOpponentInCheck = errors.New("side not to move is in check")
+)
+
+// A FenError describes why ParseFenStrict rejected a FEN string.
+type FenError struct {
+	Fen    string // the input string
+	Err    error  // one of the ErrFen* values
+	Detail string // the offending token, if any
+}
+
+func (e *FenError) Error() string {
+	if e.Detail == "" {
+		return "dragon: bad FEN " + strconv.Quote(e.Fen) + ": " + e.Err.Error()
 	}
-	// reverse the order of the ranks, removing slashes
-	ranks := strings.Split(tokens[0], "/")
-	for i := 0; i < len(ranks)/2; i++ {
-		j := len(ranks) - i - 1
-		ranks[i], ranks[j] = ranks[j], ranks[i]
+	return "dragon: bad FEN " + strconv.Quote(e.Fen) + ": " + e.Err.Error() + " (" + e.Detail + ")"
+}
+
+func (e *FenError) Unwrap() error {
+	return e.Err
+}
+
+// Parse and validate a board from a FEN string.
+// The halfmove clock and fullmove number may be omitted, as in EPD.
+// If the string is malformed, a blank Board is returned along with the error.
+// If the string is well-formed but describes an illegal position (missing kings,
+// impossible castling rights, the side not to move in check, etc.), the parsed
+// Board is returned along with the error.
+func ParseFenStrict(fen string) (Board, error) {
+	var b Board
+	fail := func(err error, detail string) (Board, error) {
+		return Board{}, &FenError{Fen: fen, Err: err, Detail: detail}
 	}
-	tokens[0] = ranks[0]
-	for i := 1; i < len(ranks); i++ {
-		tokens[0] += ranks[i]
+	tokens := strings.Fields(fen)
+	if len(tokens) < 4 || len(tokens) > 6 {
+		return fail(ErrFenFieldCount, strconv.Itoa(len(tokens)))
 	}
-	// add every piece to the board
-	for i := uint8(0); i < 64; i++ {
-		switch tokens[0][i] {
-		case 'p':
-			b.Black.Pawns |= 1 << i
-		case 'n':
-			b.Black.Knights |= 1 << i
-		case 'b':
-			b.Black.Bishops |= 1 << i
-		case 'r':
-			b.Black.Rooks |= 1 << i
-		case 'q':
-			b.Black.Queens |= 1 << i
-		case 'k':
-			b.Black.Kings |= 1 << i
-		case 'P':
-			b.White.Pawns |= 1 << i
-		case 'N':
-			b.White.Knights |= 1 << i
-		case 'B':
-			b.White.Bishops |= 1 << i
-		case 'R':
-			b.White.Rooks |= 1 << i
-		case 'Q':
-			b.White.Queens |= 1 << i
-		case 'K':
-			b.White.Kings |= 1 << i
+
+	// Piece placement, from rank 8 down to rank 1.
+	ranks := strings.Split(tokens[0], "/")
+	if len(ranks) != 8 {
+		return fail(ErrFenRankCount, strconv.Itoa(len(ranks)))
+	}
+	for i, rank := range ranks {
+		rankIdx := 7 - i
+		file := 0
+		for _, r := range rank {
+			if r >= '1' && r <= '8' {
+				file += int(r - '0')
+				if file > 8 {
+					return fail(ErrFenRankOverflow, rank)
+				}
+				continue
+			}
+			pc := pieceFromRune(r)
+			if pc.piece == Nothing {
+				return fail(ErrFenBadPiece, string(r))
+			}
+			if file >= 8 {
+				return fail(ErrFenRankOverflow, rank)
+			}
+			mask := uint64(1) << uint8(rankIdx*8+file)
+			side := &b.Black
+			if pc.side {
+				side = &b.White
+			}
+			switch pc.piece {
+			case Pawn:
+				side.Pawns |= mask
+			case Knight:
+				side.Knights |= mask
+			case Bishop:
+				side.Bishops |= mask
+			case Rook:
+				side.Rooks |= mask
+			case Queen:
+				side.Queens |= mask
+			case King:
+				side.Kings |= mask
+			}
+			file++
+		}
+		if file != 8 {
+			return fail(ErrFenRankOverflow, rank)
 		}
 	}
 	b.White.All = b.White.Pawns | b.White.Knights | b.White.Bishops | b.White.Rooks | b.White.Queens | b.White.Kings
 	b.Black.All = b.Black.Pawns | b.Black.Knights | b.Black.Bishops | b.Black.Rooks | b.Black.Queens | b.Black.Kings
 
-	b.Wtomove = tokens[1] == "w" || tokens[1] == "W"
-	if strings.Contains(tokens[2], "K") {
-		b.flipWhiteKingsideCastle()
+	switch tokens[1] {
+	case "w", "W":
+		b.Wtomove = true
+	case "b", "B":
+		b.Wtomove = false
+	default:
+		return fail(ErrFenSideToMove, tokens[1])
 	}
-	if strings.Contains(tokens[2], "Q") {
-		b.flipWhiteQueensideCastle()
-	}
-	if strings.Contains(tokens[2], "k") {
-		b.flipBlackKingsideCastle()
-	}
-	if strings.Contains(tokens[2], "q") {
-		b.flipBlackQueensideCastle()
+
+	if tokens[2] != "-" {
+		for _, r := range tokens[2] {
+			if !b.parseCastlingRight(r) {
+				return fail(ErrFenCastling, tokens[2])
+			}
+		}
 	}
+
 	if tokens[3] != "-" {
+		if len(tokens[3]) != 2 {
+			return fail(ErrFenEnPassant, tokens[3])
+		}
 		res, err := AlgebraicToIndex(tokens[3])
 		if err != nil {
-			var b2 Board
-			return b2 // TODO(noahklein): return error instead of blank board
+			return fail(ErrFenEnPassant, tokens[3])
 		}
 		b.enpassant = res
 	}
 
 	if len(tokens) > 4 {
-		result, _ := strconv.Atoi(tokens[4])
+		result, err := strconv.Atoi(tokens[4])
+		if err != nil || result < 0 || result > 255 {
+			return fail(ErrFenClock, tokens[4])
+		}
 		b.Halfmoveclock = uint8(result)
 	}
-
 	if len(tokens) > 5 {
-		result, _ := strconv.Atoi(tokens[5])
+		result, err := strconv.Atoi(tokens[5])
+		if err != nil || result < 0 || result > 65535 {
+			return fail(ErrFenClock, tokens[5])
+		}
 		b.Fullmoveno = uint16(result)
 	}
-	b.hash = recomputeBoardHash(&b)
-	return b
+	b.Sync()
+
+	if detail, err := b.validatePosition(); err != nil {
+		return b, &FenError{Fen: fen, Err: err, Detail: detail}
+	}
+	return b, nil
+}
+
+// The letter for a castling right in a FEN castling field.
+func (b *Board) castlingLetter(right int, shredder bool) string {
+	rooks, kingside := uint8(b.White.Rooks), right == whiteKingside || right == blackKingside
+	if right >= blackQueenside {
+		rooks = uint8(b.Black.Rooks >> 56)
+	}
+	file := b.rookFiles[right]
+	// Is there another rook beyond the castling rook?
+	beyond := rooks & (1<<file - 1)
+	if kingside {
+		beyond = rooks &^ (2<<file - 1)
+	}
+	letter := string(rune('A' + file))
+	if !shredder && beyond == 0 {
+		letter = "Q"
+		if kingside {
+			letter = "K"
+		}
+	}
+	if right >= blackQueenside {
+		return strings.ToLower(letter)
+	}
+	return letter
+}
+
+// Sets the castling right named by a letter of a FEN castling field, and the
+// file of its rook, reporting false if the letter is invalid. KQkq name the
+// outermost rook on either side of the king (as in X-FEN), and file letters
+// name the rook's file (as in Shredder-FEN and X-FEN). Positions with castling
+// rights that standard chess can't have are marked as Chess960.
+func (b *Board) parseCastlingRight(r rune) bool {
+	ours, rank, right := &b.White, uint8(0), whiteQueenside
+	if r >= 'a' && r <= 'z' {
+		ours, rank, right = &b.Black, 56, blackQueenside
+		r -= 'a' - 'A'
+	}
+	// Without a king on the back rank, validation will reject any right.
+	kingFile := uint8(4)
+	if backRankKings := ours.Kings & (uint64(0xFF) << rank); backRankKings != 0 {
+		kingFile = uint8(bits.TrailingZeros64(backRankKings)) % 8
+	}
+	rooks := uint8(ours.Rooks >> rank)
+	var rookFile uint8
+	switch {
+	case r == 'K':
+		right++
+		rookFile = 7
+		if outer := rooks &^ (2<<kingFile - 1); outer != 0 {
+			rookFile = uint8(7 - bits.LeadingZeros8(outer))
+		}
+	case r == 'Q':
+		rookFile = 0
+		if outer := rooks & (1<<kingFile - 1); outer != 0 {
+			rookFile = uint8(bits.TrailingZeros8(outer))
+		}
+	case r >= 'A' && r <= 'H':
+		rookFile = uint8(r - 'A')
+		if rookFile > kingFile {
+			right++
+		}
+		b.Chess960 = true
+	default:
+		return false
+	}
+	b.castlerights |= 1 << right
+	b.rookFiles[right] = rookFile
+	if kingFile != 4 || rookFile != [2]uint8{0, 7}[right%2] {
+		b.Chess960 = true
+	}
+	return true
+}
+
+// Check that a parsed board describes a position reachable under the rules of chess,
+// as far as can be cheaply verified. Returns the offending detail (if any) and the reason.
+func (b *Board) validatePosition() (string, error) {
+	if bits.OnesCount64(b.White.Kings) != 1 || bits.OnesCount64(b.Black.Kings) != 1 {
+		return "", ErrFenKingCount
+	}
+	if backRankPawns := (b.White.Pawns | b.Black.Pawns) & (RankMasks[0] | RankMasks[7]); backRankPawns != 0 {
+		return IndexToAlgebraic(Square(bits.TrailingZeros64(backRankPawns))), ErrFenPawnOnBackRank
+	}
+	for right, letter := range [4]string{"Q", "K", "q", "k"} {
+		if b.castlerights&(1<<right) == 0 {
+			continue
+		}
+		ours, rank := &b.White, 0
+		if right >= blackQueenside {
+			ours, rank = &b.Black, 7
+		}
+		// The king must be on its back rank, with the rook on the named side of it.
+		backRankKings := ours.Kings & RankMasks[rank]
+		kingFile := uint8(bits.TrailingZeros64(backRankKings)) % 8
+		rookFile := b.rookFiles[right]
+		kingside := right == whiteKingside || right == blackKingside
+		if backRankKings == 0 || ours.Rooks&(uint64(1)<<(uint8(rank*8)+rookFile)) == 0 ||
+			kingside != (rookFile > kingFile) {
+			return letter, ErrFenCastlingRights
+		}
+	}
+	if b.enpassant != 0 {
+		// The double-pushed pawn sits one rank beyond the e.p. square, from the
+		// mover's point of view; the e.p. square and the pawn's origin must be empty.
+		var wantRank uint8 = 5
+		pushedPawns := b.Black.Pawns
+		pawnSq, originSq := b.enpassant-8, b.enpassant+8
+		if !b.Wtomove {
+			wantRank = 2
+			pushedPawns = b.White.Pawns
+			pawnSq, originSq = b.enpassant+8, b.enpassant-8
+		}
+		allPieces := b.White.All | b.Black.All
+		if b.enpassant/8 != wantRank || pushedPawns&(uint64(1)<<pawnSq) == 0 ||
+			allPieces&((uint64(1)<<b.enpassant)|(uint64(1)<<originSq)) != 0 {
+			return IndexToAlgebraic(Square(b.enpassant)), ErrFenEnPassantSquare
+		}
+	}
+	oppKing := b.Black.Kings
+	if !b.Wtomove {
+		oppKing = b.White.Kings
+	}
+	if b.UnderDirectAttack(!b.Wtomove, uint8(bits.TrailingZeros64(oppKing))) {
+		return "", ErrFenOpponentInCheck
+	}
+	return "", nil
 }
@@ -1,6 +1,7 @@
 package dragon
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -108,11 +109,95 @@ func TestToFen(t *testing.T) {
 		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 0",
 		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b KQkq - 0 10",
 		"6nq/6p1/2B4n/1rB2r1R/5q2/2P5/1Q4n1/2B5 w - h8 6 12",
-		"6nq/6p1/2B4n/1rB2r1R/5q2/2P5/1Q4n1/2B5 b - - 2 999"}
+		"6nq/6p1/2B4n/1rB2r1R/5q2/2P5/1Q4n1/2B5 b - - 2 999",
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w KQkq - 2 9", // X-FEN
+		"1r2k1rr/8/8/8/8/8/8/RR2K2R w KBgq - 0 1"}
 	for _, fen := range fenTests {
 		b := ParseFen(fen)
 		if b.ToFen() != fen {
 			t.Error("Error serializing FEN.\nOutput:  ", b.ToFen(), "\nExpected:", fen)
 		}
 	}
+
+	// Shredder-FEN names every castling rook by its file.
+	shredderTests := map[string]string{
+		Startpos: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w HAha - 0 1",
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9": "bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9",
+		"1r2k1rr/8/8/8/8/8/8/RR2K2R w KBgq - 0 1":                           "1r2k1rr/8/8/8/8/8/8/RR2K2R w HBgb - 0 1",
+	}
+	for fen, want := range shredderTests {
+		b := ParseFen(fen)
+		if b.ToShredderFen() != want {
+			t.Error("Error serializing Shredder-FEN.\nOutput:  ", b.ToShredderFen(), "\nExpected:", want)
+		}
+	}
+}
+
+func TestChess960Detection(t *testing.T) {
+	positions := map[string]bool{
+		Startpos: false,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w HAha - 0 1":          true,
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w KQkq - 2 9": true,
+		"4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1":                                  false,
+		"4k3/8/8/8/8/8/8/R3KR2 w K - 0 1":                                   true,
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w - - 2 9":    false,
+	}
+	for fen, want := range positions {
+		if b := ParseFen(fen); b.Chess960 != want {
+			t.Error("Wrong Chess960 flag for", fen)
+		}
+	}
+}
+
+func TestParseFenStrict(t *testing.T) {
+	fenErrors := map[string]error{
+		Startpos: nil,
+		"rnbqkbnr/ppp1pppp/8/8/3pP3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 3":     nil,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq -": nil, // EPD-style, no clocks
+		"": ErrFenFieldCount,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w":               ErrFenFieldCount,
+		"rnbqkbnr/pppppppp/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1":      ErrFenRankCount,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNX w KQkq - 0 1":    ErrFenBadPiece,
+		"rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1":    ErrFenBadPiece,
+		"rnbqkbnr/ppppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1":   ErrFenRankOverflow,
+		"rnbqkbnr/pppppppp/8/8/44/8/PPPPPPPP/RNBQKBN w KQkq - 0 1":    ErrFenRankOverflow,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1":    ErrFenSideToMove,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQxq - 0 1":    ErrFenCastling,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e9 0 1":   ErrFenEnPassant,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e 0 1":    ErrFenEnPassant,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - x 1":    ErrFenClock,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 -1":   ErrFenClock,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 300 1":  ErrFenClock,
+		"8/8/8/3r4/8/8/8/8 w - - 0 1":                                 ErrFenKingCount,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKKNR w kq - 0 1":      ErrFenKingCount,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNP w kq - 0 1":      ErrFenPawnOnBackRank,
+		"4k3/8/8/8/8/8/8/4K3 w K - 0 1":                               ErrFenCastlingRights,
+		"4k3/8/8/8/8/8/3K4/R6R w Q - 0 1":                             ErrFenCastlingRights,
+		"4k3/8/8/8/8/8/8/R2K3R w C - 0 1":                             ErrFenCastlingRights,
+		"4k3/8/8/8/8/8/8/R2K3R w Q - 0 1":                             nil, // Chess960
+		"rkrbbqnn/pppppppp/8/8/8/8/PPPPPPPP/RKRBBQNN w CAca - 0 1":    nil, // Shredder-FEN
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQIq - 0 1":    ErrFenCastling,
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e3 0 1": ErrFenEnPassantSquare,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b KQkq e3 0 1":   ErrFenEnPassantSquare,
+		"4k3/8/8/8/8/8/8/4K2R w - - 0 1":                              nil,
+		"4k2R/8/8/8/8/8/8/4K3 w - - 0 1":                              ErrFenOpponentInCheck,
+	}
+	for fen, want := range fenErrors {
+		_, err := ParseFenStrict(fen)
+		if want == nil && err != nil {
+			t.Error("Unexpected error for FEN", fen, ":", err)
+		} else if want != nil && !errors.Is(err, want) {
+			t.Error("Wrong error for FEN", fen, "\nExpected:", want, "\nGot:     ", err)
+		}
+		var fenErr *FenError
+		if err != nil && !errors.As(err, &fenErr) {
+			t.Error("Error is not a *FenError for FEN", fen)
+		}
+	}
+
+	// Semantically invalid positions are still returned for lenient callers.
+	b, err := ParseFenStrict("8/8/8/3r4/8/8/8/8 b - - 0 1")
+	if err == nil || b.Black.Rooks != 1<<35 {
+		t.Error("Invalid position was not returned alongside its error")
+	}
 }